@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// session is the REPL state that commands act on
+type session struct {
+	backend backend
+	path string // file being run, empty at the prompt
+}
+
+// command is a REPL meta-command, typed as ":name argument"
+type command struct {
+	name string
+	argument string // shown in help, empty if the command takes none
+	help string
+	run func(s *session, argument string)
+}
+
+var commands []command
+
+// Set up in init, since :help refers back to the list
+func init() {
+	commands = []command{
+		{"env", "", "List global variables and their values", (*session).env},
+		{"ast", "<expr>", "Show the syntax tree of an expression", (*session).ast},
+		{"tokens", "<source>", "Show the tokens the scanner produces", (*session).tokens},
+		{"load", "<file>", "Run a file in this session", (*session).load},
+		{"reset", "", "Start over with a fresh interpreter", (*session).reset},
+		{"time", "<code>", "Run code and show how long it took", (*session).time},
+		{"help", "", "List commands", (*session).help},
+	}
+}
+
+// Runs a line starting with ':'
+func (s *session) command(line string) {
+	name, argument, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	argument = strings.TrimSpace(argument)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if c.argument != "" && argument == "" {
+			fmt.Fprintf(os.Stderr, "Usage: :%s %s\n", c.name, c.argument)
+			return
+		}
+		c.run(s, argument)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command ':%s'. Type :help for a list of commands.\n", name)
+}
+
+func (s *session) env(string) {
+	globals := s.backend.Globals()
+	if len(globals) == 0 {
+		fmt.Println("No globals defined.")
+		return
+	}
+
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s = %s\n", name, show(globals[name]))
+	}
+}
+
+func (s *session) ast(source string) {
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		report(err, source)
+		return
+	}
+
+	tree, err := parser.NewParser(tokens).PrintExpression()
+	if err != nil {
+		report(err, source)
+		return
+	}
+	fmt.Println(tree)
+}
+
+func (s *session) tokens(source string) {
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		report(err, source)
+		return
+	}
+
+	for _, tok := range tokens {
+		position := fmt.Sprintf("%d:%d", tok.Line, tok.Column)
+		line := fmt.Sprintf("%-6s %-14s %q", position, tok.Type, tok.Lexeme)
+		if tok.Literal != nil {
+			line += " " + show(tok.Literal)
+		}
+		fmt.Println(line)
+	}
+}
+
+func (s *session) load(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		return
+	}
+
+	// Imports resolve relative to the file while it runs, then relative to
+	// whatever was running before
+	previous := s.path
+	err = s.backend.SetPath(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		return
+	}
+	s.path = path
+	defer func() {
+		s.path = previous
+		s.backend.SetPath(previous)
+	}()
+
+	err = run(string(data), s.backend, false)
+	if err != nil {
+		report(err, string(data))
+	}
+}
+
+func (s *session) reset(string) {
+	s.backend = newBackend()
+	s.path = ""
+	fmt.Println("Session reset.")
+}
+
+func (s *session) time(source string) {
+	start := time.Now()
+	err := run(source, s.backend, true)
+	elapsed := time.Since(start)
+	if err != nil {
+		report(err, source)
+	}
+	fmt.Printf("Took %s\n", elapsed.Round(time.Microsecond))
+}
+
+func (s *session) help(string) {
+	for _, c := range commands {
+		usage := ":" + c.name
+		if c.argument != "" {
+			usage += " " + c.argument
+		}
+		fmt.Printf("  %-18s %s\n", usage, c.help)
+	}
+}
+
+// Formats a value for display, quoting strings so "1" and 1 can be told apart
+func show(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(value)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		setup string // run before the command
+		line string
+		output string
+		errors string
+	}{
+		{"env empty", "", ":env", "No globals defined.\n", ""},
+		{"env", "var b = \"two\";\nvar a = 1;\nvar c = nil;", ":env", "a = 1\nb = \"two\"\nc = nil\n", ""},
+		{"ast", "", ":ast 1 + 2 * -x", "(+ 1 (* 2 (- (var x))))\n", ""},
+		{"ast grouping", "", ":ast (1 + 2) * 3", "(* (group (+ 1 2)) 3)\n", ""},
+		{"ast error", "", ":ast 1 +", "", "Syntax error at [line 1, column 4] at '': Expecting expression.\n    1 | 1 +\n      |    ^\n"},
+		{"ast trailing tokens", "", ":ast 1 2", "", "Syntax error at [line 1, column 3] at '2': Expect end of expression.\n    1 | 1 2\n      |   ^\n"},
+		{"tokens", "", ":tokens var x = \"hi\";", "1:1    VAR            \"var\"\n1:5    IDENTIFIER     \"x\"\n1:7    EQUAL          \"=\"\n1:9    STRING         \"\\\"hi\\\"\" \"hi\"\n1:13   SEMICOLON      \";\"\n1:14   EOF            \"\"\n", ""},
+		{"reset", "var a = 1;", ":reset", "Session reset.\n", ""},
+		{"time", "var a = 20;", ":time print a + 1;", "21\nTook (time)\n", ""},
+		{"time error", "", ":time print nil - 1;", "Took (time)\n", "Runtime error at [line 1, column 11]: Operands must be numbers.\n    1 | print nil - 1;\n      |           ^\n"},
+		{"help", "", ":help", "  :env               List global variables and their values\n  :ast <expr>        Show the syntax tree of an expression\n  :tokens <source>   Show the tokens the scanner produces\n  :load <file>       Run a file in this session\n  :reset             Start over with a fresh interpreter\n  :time <code>       Run code and show how long it took\n  :help              List commands\n", ""},
+		{"missing argument", "", ":ast", "", "Usage: :ast <expr>\n"},
+		{"unknown", "", ":nope", "", "Unknown command ':nope'. Type :help for a list of commands.\n"},
+	}
+
+	defer func(vm bool) { *useVM = vm }(*useVM)
+	for _, vm := range []bool{false, true} {
+		*useVM = vm
+		for _, test := range tests {
+			t.Run(backendName(vm) + "/" + test.name, func(t *testing.T) {
+				var output string
+				errors := captureStderr(t, func() {
+					output = captureStdout(t, func() {
+						s := &session{backend: newBackend()}
+						if test.setup != "" {
+							err := run(test.setup, s.backend, false)
+							if err != nil {
+								t.Error(err)
+							}
+						}
+						s.command(test.line)
+					})
+				})
+
+				output = tookDuration.ReplaceAllString(output, "Took (time)")
+				if output != test.output {
+					t.Errorf("expected output %q, got %q", test.output, output)
+				}
+				if errors != test.errors {
+					t.Errorf("expected errors %q, got %q", test.errors, errors)
+				}
+			})
+		}
+	}
+}
+
+// :reset forgets everything defined before it
+func TestReset(t *testing.T) {
+	captureStdout(t, func() {
+		s := &session{backend: newBackend()}
+		run("var a = 1;", s.backend, false)
+		s.command(":reset")
+		if globals := s.backend.Globals(); len(globals) != 0 {
+			t.Errorf("globals after :reset: %v", globals)
+		}
+	})
+}
+
+var tookDuration = regexp.MustCompile(`Took [0-9.]+[µnm]?s`)
+
+func backendName(vm bool) string {
+	if vm {
+		return "vm"
+	}
+	return "interpreter"
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "lib"), 0755)
+	files := map[string]string{
+		"lib/util.lox": "fun twice(x) {\n  return x * 2;\n}\n",
+		"lib/main.lox": "import \"util.lox\" as u;\nprint u.twice(21);\n",
+	}
+	for name, source := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(vm bool) { *useVM = vm }(*useVM)
+	for _, vm := range []bool{false, true} {
+		*useVM = vm
+		var err error
+		output := captureStdout(t, func() {
+			s := &session{backend: newBackend()}
+			s.load(filepath.Join(dir, "lib", "main.lox"))
+			if s.path != "" {
+				t.Errorf("vm %v: path %q after :load", vm, s.path)
+			}
+
+			// Back at the prompt, imports resolve relative to the working
+			// directory again
+			err = run("import \"util.lox\" as u;", s.backend, true)
+		})
+		if output != "42\n" {
+			t.Errorf("vm %v: output %q", vm, output)
+		}
+		if err == nil {
+			t.Errorf("vm %v: import resolved relative to the loaded file", vm)
+		}
+	}
+}
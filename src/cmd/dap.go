@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lidanielm/glox/src/pkg/dap"
+)
+
+// Serves the Debug Adapter Protocol over stdin and stdout until the editor
+// disconnects, returning the exit status
+func runDAP() int {
+	err := dap.NewAdapter(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
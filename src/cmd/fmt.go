@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/format"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+// Formats the .lox files named by args, printing the result unless -w or
+// -d is given, and returns the exit status
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to each file instead of printing it")
+	showDiff := flags.Bool("d", false, "print a diff of the changes instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox fmt [-w] [-d] path ...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 64
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 64
+	}
+
+	files, err := loxFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	status := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			status = 1
+			continue
+		}
+
+		source := string(data)
+		formatted, err := format.Source(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%s\n", path, lox_error.Render(err, source))
+			status = 1
+			continue
+		}
+
+		if *showDiff && formatted != source {
+			fmt.Print(diffLines(path, source, formatted))
+		}
+		if *write {
+			if formatted != source {
+				err = os.WriteFile(path, []byte(formatted), 0644)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Error:", err)
+					status = 1
+				}
+			}
+		} else if !*showDiff {
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
+
+// Expands directories in paths to the .lox files inside them
+func loxFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && filepath.Ext(path) == ".lox" {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Returns a unified-style diff between the lines of before and after. Hunks
+// aren't merged or given context; each run of changed lines gets its own
+// header.
+func diffLines(path string, before string, after string) string {
+	a := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a) + 1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b) + 1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i + 1][j + 1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i + 1][j], lcs[i][j + 1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", path, path)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+
+		// Collect the run of removed and added lines up to the next common line
+		startA, startB := i, j
+		for i < len(a) || j < len(b) {
+			if i < len(a) && j < len(b) && a[i] == b[j] {
+				break
+			}
+			if j == len(b) || (i < len(a) && lcs[i + 1][j] >= lcs[i][j + 1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", startA + 1, i - startA, startB + 1, j - startB)
+		for _, line := range a[startA:i] {
+			out.WriteString("-" + line + "\n")
+		}
+		for _, line := range b[startB:j] {
+			out.WriteString("+" + line + "\n")
+		}
+	}
+	return out.String()
+}
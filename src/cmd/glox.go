@@ -1,87 +1,176 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/lidanielm/glox/src/pkg/interpreter"
 	"github.com/lidanielm/glox/src/pkg/lox_error"
 	"github.com/lidanielm/glox/src/pkg/parser"
 	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/vm"
 )
 
+var useVM = flag.Bool("vm", false, "run on the bytecode virtual machine instead of the tree-walking interpreter")
+var diagnosticsFormat = flag.String("diagnostics", "text", "how to report errors from scripts and lint: text, json or sarif")
+
+// backend runs parsed programs: an *interpreter.Interpreter or a *vm.VM
+type backend interface {
+	SetPath(path string) error
+	SetSource(source string)
+	Globals() map[string]any
+}
+
+func newBackend() backend {
+	if *useVM {
+		return vm.New()
+	}
+	return interpreter.NewInterpreter()
+}
+
+// Like newBackend, but errors are left to the caller and warnings are passed
+// to warn instead of being written out
+func newQuietBackend(warn func(err error)) backend {
+	if *useVM {
+		return vm.New(vm.WithDiagnostics(io.Discard), vm.WithWarnings(warn))
+	}
+	return interpreter.NewInterpreter(interpreter.WithDiagnostics(io.Discard), interpreter.WithWarnings(warn))
+}
+
 func main() {
-	// fmt.Println(os.Args)
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: golox [script]")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox [--vm] [--diagnostics=text|json|sarif] [script]")
+		fmt.Fprintln(os.Stderr, "       glox test [path ...]")
+		fmt.Fprintln(os.Stderr, "       glox fmt [-w] [-d] path ...")
+		fmt.Fprintln(os.Stderr, "       glox lint [-config file] path ...")
+		fmt.Fprintln(os.Stderr, "       glox lsp")
+		fmt.Fprintln(os.Stderr, "       glox dap")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *diagnosticsFormat != "text" && *diagnosticsFormat != "json" && *diagnosticsFormat != "sarif" {
+		fmt.Fprintf(os.Stderr, "Unknown diagnostics format %q.\n", *diagnosticsFormat)
+		flag.Usage()
+		os.Exit(64)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "test" {
+		os.Exit(runTests(flag.Args()[1:]))
+	} else if flag.NArg() > 0 && flag.Arg(0) == "fmt" {
+		os.Exit(runFmt(flag.Args()[1:]))
+	} else if flag.NArg() > 0 && flag.Arg(0) == "lint" {
+		os.Exit(runLint(flag.Args()[1:]))
+	} else if flag.NArg() == 1 && flag.Arg(0) == "lsp" {
+		os.Exit(runLSP())
+	} else if flag.NArg() == 1 && flag.Arg(0) == "dap" {
+		os.Exit(runDAP())
+	} else if flag.NArg() > 1 {
+		flag.Usage()
 		os.Exit(64)
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+	} else if flag.NArg() == 1 {
+		runFile(flag.Arg(0))
 	} else {
-		runPrompt()
+		runPrompt(os.Stdin)
 	}
 }
 
 func runFile(path string) error {
+	if *diagnosticsFormat != "text" {
+		return runFileStructured(path)
+	}
+
 	// Wrapper for run if given file path
-	interpreter := interpreter.NewInterpreter()
+	interpreter := newBackend()
 	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		return err
+	}
+	err = interpreter.SetPath(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
 		return err
 	}
-	err = run(string(data), interpreter)
+	err = run(string(data), interpreter, false)
 	if err != nil {
-		if runtimeError, ok := err.(*lox_error.RuntimeError); ok {
-			fmt.Println(runtimeError.Error())
-			os.Exit(1)
-		} else if loxError, ok := err.(*lox_error.LoxError); ok {
-			fmt.Println(loxError.Error())
-			os.Exit(1)
-		} else if parseError, ok := err.(*lox_error.ParseError); ok {
-			fmt.Println(parseError.Error())
-			os.Exit(1)
-		} else {
-			fmt.Println("Error:", err)
-			os.Exit(1)
-		}
+		report(err, string(data))
+		os.Exit(1)
 	}
 	return nil
 }
 
-func runPrompt() error {
-	// Wrapper for run in repl environment
-	reader := bufio.NewReader(os.Stdin)
-
-	interpreter := interpreter.NewInterpreter()
-
-	for {
-		fmt.Print("> ")
-		line, _, _ := reader.ReadLine()
-		if line == nil {
-			break
-		}
-		err := run(string(line), interpreter)
-		if err != nil {
-			if runtimeError, ok := err.(*lox_error.RuntimeError); ok {
-				fmt.Println(runtimeError.Error())
-				os.Exit(1)
-			} else if loxError, ok := err.(*lox_error.LoxError); ok {
-				fmt.Println(loxError.Error())
-				os.Exit(1)
-			} else if parseError, ok := err.(*lox_error.ParseError); ok {
-				fmt.Println(parseError.Error())
-				os.Exit(1)
-			} else {
-				os.Exit(1)
-			}
-		}
+// Runs a file like runFile, but reports its errors and warnings all together
+// once it stops, in the format given by --diagnostics
+func runFileStructured(path string) error {
+	diagnostics := []lox_error.Diagnostic{}
+	b := newQuietBackend(func(err error) {
+		warning := lox_error.NewDiagnostic(err, path)
+		warning.Severity = "warning"
+		diagnostics = append(diagnostics, warning)
+	})
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = b.SetPath(path)
+	}
+	if err == nil {
+		err = run(string(data), b, false)
+	}
+	if r, ok := err.(reported); ok {
+		err = r.error
+	}
+	if err != nil {
+		diagnostics = append(diagnostics, lox_error.Diagnostics(err, path)...)
+	}
+
+	writeDiagnostics(diagnostics)
+	if err != nil {
+		os.Exit(1)
 	}
 	return nil
 }
 
-func run(source string, ip *interpreter.Interpreter) error {
+// Writes diagnostics to stderr in the format given by --diagnostics
+func writeDiagnostics(diagnostics []lox_error.Diagnostic) {
+	var err error
+	if *diagnosticsFormat == "sarif" {
+		err = lox_error.WriteSARIF(os.Stderr, diagnostics)
+	} else {
+		err = lox_error.WriteJSON(os.Stderr, diagnostics)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
+
+// reported is an error the backend wrote to its diagnostics as it returned
+// it, such as a runtime error or an error in an imported module
+type reported struct {
+	error
+}
+
+func (r reported) Unwrap() error {
+	return r.error
+}
+
+// Prints an error returned by run, unless the backend already reported it
+func report(err error, source string) {
+	switch err.(type) {
+	case reported:
+		// Already reported by the backend
+	case *lox_error.LoxError, *lox_error.ParseError, *lox_error.CompileError, lox_error.ErrorList:
+		// An ErrorList holds every syntax error in the source, one after another
+		fmt.Fprintln(os.Stderr, lox_error.Render(err, source))
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
+
+// Runs source on the backend. Interactive source comes from the REPL, which
+// shows the value of a final expression.
+func run(source string, b backend, interactive bool) error {
 	// Run interpreter
 	scan := scanner.NewScanner(source)
 	tokens, err := scan.ScanTokens()
@@ -91,20 +180,37 @@ func run(source string, ip *interpreter.Interpreter) error {
 	}
 
 	parser := parser.NewParser(tokens)
-	statements, err := parser.Parse()
+	parse := parser.Parse
+	if interactive {
+		parse = parser.ParseInteractive
+	}
+	statements, err := parse()
 
 	// Stop if there was a syntax error
 	if err != nil {
 		return err
 	}
 
+	b.SetSource(source)
+	if machine, ok := b.(*vm.VM); ok {
+		// The VM resolves programs itself as it compiles them
+		return interpreted(machine.Interpret(statements))
+	}
+
+	ip := b.(*interpreter.Interpreter)
 	resolver := interpreter.NewResolver(ip)
 	_, err = resolver.ResolveStmts(statements)
 	if err != nil {
 		return err
 	}
 
-	ip.Interpret(statements)
-	
+	return interpreted(ip.Interpret(statements))
+}
+
+// Marks an error returned by a backend's Interpret as reported
+func interpreted(err error) error {
+	if err != nil {
+		return reported{err}
+	}
 	return nil
 }
\ No newline at end of file
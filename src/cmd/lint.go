@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lidanielm/glox/src/pkg/lint"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+// Lints the .lox files named by args, printing what it finds, and returns
+// the exit status: 1 if anything is a warning or worse
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configPath := flags.String("config", "", "config file to use instead of the nearest "+lint.ConfigFile)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox lint [-config file] path ...")
+		flags.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nRules:")
+		for _, rule := range lint.Rules {
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n    \t%s\n", rule.ID, rule.Severity, rule.Description)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return 64
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 64
+	}
+
+	var config *lint.Config
+	if *configPath != "" {
+		var err error
+		config, err = lint.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+	}
+
+	files, err := loxFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	// Without -config, each file uses the config nearest to it
+	configs := make(map[string]*lint.Config)
+	structured := []lox_error.Diagnostic{}
+	status := 0
+	for _, path := range files {
+		fileConfig := config
+		if *configPath == "" {
+			dir := filepath.Dir(path)
+			if _, ok := configs[dir]; !ok {
+				if found, ok := lint.FindConfig(dir); ok {
+					configs[dir], err = lint.LoadConfig(found)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+						return 1
+					}
+				} else {
+					configs[dir] = nil
+				}
+			}
+			fileConfig = configs[dir]
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if *diagnosticsFormat != "text" {
+				structured = append(structured, lox_error.NewDiagnostic(err, path))
+			} else {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			status = 1
+			continue
+		}
+
+		source := string(data)
+		diagnostics, err := lint.Source(source, fileConfig)
+		if err != nil {
+			if *diagnosticsFormat != "text" {
+				structured = append(structured, lox_error.Diagnostics(err, path)...)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s:\n%s\n", path, lox_error.Render(err, source))
+			}
+			status = 1
+			continue
+		}
+		for _, d := range diagnostics {
+			if *diagnosticsFormat != "text" {
+				structured = append(structured, d.Structured(path, source))
+			} else {
+				fmt.Println(d.Format(path))
+			}
+			if d.Severity >= lint.WARNING {
+				status = 1
+			}
+		}
+	}
+
+	// Structured findings are the output of lint, so unlike a script's
+	// diagnostics they go to stdout
+	if *diagnosticsFormat == "sarif" {
+		err = lox_error.WriteSARIF(os.Stdout, structured)
+	} else if *diagnosticsFormat == "json" {
+		err = lox_error.WriteJSON(os.Stdout, structured)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return status
+}
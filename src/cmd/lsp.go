@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lidanielm/glox/src/pkg/lsp"
+)
+
+// Serves the Language Server Protocol over stdin and stdout until the
+// editor exits it, returning the exit status
+func runLSP() int {
+	err := lsp.NewServer(os.Stdin, os.Stdout, os.Stderr).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
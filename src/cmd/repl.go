@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How many lines of history are kept between sessions
+const historySize = 1000
+
+func runPrompt(in io.Reader) {
+	session := &session{backend: newBackend()}
+	reader := bufio.NewReader(in)
+	history := openHistory()
+	history.trim()
+	previous := "" // last line saved, so repeats aren't saved again
+
+	// Lines of an entry that isn't complete yet, e.g. an unclosed function
+	pending := ""
+	for {
+		if pending == "" {
+			fmt.Print("> ")
+		} else {
+			fmt.Print("... ")
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if strings.TrimSpace(line) != "" && line != previous {
+			history.add(line)
+			previous = line
+		}
+
+		// Commands such as :env are only recognised at the start of an entry
+		if pending == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			session.command(strings.TrimSpace(line))
+			continue
+		}
+
+		pending += line + "\n"
+		if unbalanced(pending) {
+			continue
+		}
+
+		source := pending
+		pending = ""
+		if strings.TrimSpace(source) == "" {
+			continue
+		}
+
+		err = run(source, session.backend, true)
+		if err != nil {
+			report(err, source)
+		}
+	}
+}
+
+// Reports whether source has brackets or a string still waiting to be
+// closed, so the REPL should read another line before running it
+func unbalanced(source string) bool {
+	depth := 0
+	quote := byte(0) // '"' or '`' inside a string
+	interpolations := []int{} // depth at each ${ being read, innermost last
+	for i := 0; i < len(source); i++ {
+		switch c := source[i]; {
+		case quote == '`':
+			if c == '`' {
+				quote = 0
+			}
+		case quote == '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			} else if c == '$' && strings.HasPrefix(source[i:], "${") {
+				i++
+				interpolations = append(interpolations, depth)
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '/' && strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case c == '}' && len(interpolations) > 0 && depth == interpolations[len(interpolations) - 1]:
+			// Back in the string the expression was interpolated into
+			interpolations = interpolations[:len(interpolations) - 1]
+			quote = '"'
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		}
+	}
+
+	return quote != 0 || len(interpolations) > 0 || depth > 0
+}
+
+// history is the file REPL lines are saved to, $GLOX_HISTORY or
+// ~/.glox_history. History is best-effort: if the file can't be used the
+// REPL still works, just without saving.
+type history struct {
+	path string
+}
+
+func openHistory() *history {
+	path := os.Getenv("GLOX_HISTORY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &history{}
+		}
+		path = filepath.Join(home, ".glox_history")
+	}
+	return &history{path: path}
+}
+
+// Keeps only the last historySize lines of the file
+func (h *history) trim() {
+	if h.path == "" {
+		return
+	}
+
+	file, err := os.Open(h.path)
+	if err != nil {
+		return
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	file.Close()
+
+	if len(lines) > historySize {
+		lines = lines[len(lines) - historySize:]
+		os.WriteFile(h.path, []byte(strings.Join(lines, "\n") + "\n"), 0600)
+	}
+}
+
+// Appends a line to the file as soon as it is entered, so it survives the
+// REPL being killed
+func (h *history) add(line string) {
+	if h.path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnbalanced(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		expected bool
+	}{
+		{"empty", "", false},
+		{"statement", "print 1;\n", false},
+		{"open brace", "fun f() {\n", true},
+		{"closed brace", "fun f() {\n}\n", false},
+		{"open call", "f(1,\n", true},
+		{"nested brackets", "[1, [2]\n", true},
+		{"extra closing bracket", ")\n", false},
+		{"bracket in a string", "print \"(\";\n", false},
+		{"open string", "print \"abc\n", true},
+		{"escaped quote", "print \"a\\\"(\";\n", false},
+		{"bracket in a comment", "// {\n", false},
+		{"bracket in a trailing comment", "print 1; // (\n", false},
+		{"slashes in a string", "print \"//\"; {\n", true},
+		{"open raw string", "print `raw\n", true},
+		{"backslash in a raw string", "print `a\\`;\n", false},
+		{"open interpolation", "print \"a ${\n", true},
+		{"unclosed interpolation", "print \"a ${x\n", true},
+		{"closed interpolation", "print \"a ${x}\";\n", false},
+		{"interpolation left in the string", "print \"a ${x} (\n", true},
+		{"braces in an interpolation", "print \"a ${ {1: 2}[1] }\";\n", false},
+		{"string in an interpolation", "print \"${f(\"}\")}\";\n", false},
+		{"nested interpolation", "print \"${\"${x}\"}\";\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := unbalanced(test.source); actual != test.expected {
+				t.Errorf("unbalanced(%q) = %v, expected %v", test.source, actual, test.expected)
+			}
+		})
+	}
+}
+
+// The value of a final expression is printed, and errors are reported
+// without ending the session
+func TestPrompt(t *testing.T) {
+	input := "1 + 2\nvar x = 10;\nx * 2;\nprint @;\nprint 1 +;\nprint nil - 1;\nfun add(a, b) {\n  return a + b;\n}\nadd(x, 5)\n"
+	t.Setenv("GLOX_HISTORY", filepath.Join(t.TempDir(), "history"))
+
+	defer func(vm bool) { *useVM = vm }(*useVM)
+	for _, vm := range []bool{false, true} {
+		*useVM = vm
+		var output string
+		errors := captureStderr(t, func() {
+			output = captureStdout(t, func() { runPrompt(strings.NewReader(input)) })
+		})
+
+		// Prompts are written without newlines, before each line is read
+		expected := "> 3\n> > 20\n> > > > ... ... > 15\n> "
+		if output != expected {
+			t.Errorf("vm %v: expected output %q, got %q", vm, expected, output)
+		}
+		for _, message := range []string{"Unexpected character.", "Expecting expression.", "Operands must be numbers."} {
+			if !strings.Contains(errors, message) {
+				t.Errorf("vm %v: %q not reported in %q", vm, message, errors)
+			}
+		}
+	}
+}
+
+// Lines entered are appended to the history file, without blank lines or
+// immediate repeats, and the file is kept to historySize lines
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	t.Setenv("GLOX_HISTORY", path)
+	old := strings.Repeat("print 0;\n", historySize)
+	err := os.WriteFile(path, []byte(old), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captureStdout(t, func() { runPrompt(strings.NewReader("print 1;\n\nprint 1;\nprint 2;\n")) })
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != historySize + 2 || lines[historySize] != "print 1;" || lines[historySize + 1] != "print 2;" {
+		t.Errorf("history ends %q, %d lines", lines[max(len(lines) - 3, 0):], len(lines))
+	}
+
+	// The next session trims it back down
+	captureStdout(t, func() { runPrompt(strings.NewReader("")) })
+	data, _ = os.ReadFile(path)
+	if count := strings.Count(string(data), "\n"); count != historySize {
+		t.Errorf("%d lines after trimming", count)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/testrunner"
+)
+
+// Runs the test_* functions in every *_test.lox file under paths, printing
+// a line per test and returning the exit status
+func runTests(paths []string) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testrunner.Discover(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	passed, failed := 0, 0
+	start := time.Now()
+	for _, path := range files {
+		fmt.Println("===", path)
+		file, err := testrunner.Load(path)
+		if err != nil {
+			// A file that doesn't parse fails as a whole
+			source, _ := os.ReadFile(path)
+			fmt.Println("--- FAIL:", path)
+			fmt.Println(indent(lox_error.Render(err, string(source))))
+			failed++
+			continue
+		}
+
+		for _, name := range file.Tests {
+			result := file.Run(name)
+			if result.Passed() {
+				fmt.Printf("--- PASS: %s (%s)\n", name, result.Elapsed.Round(time.Microsecond))
+				passed++
+				continue
+			}
+
+			fmt.Printf("--- FAIL: %s (%s)\n", name, result.Elapsed.Round(time.Microsecond))
+			if result.Output != "" {
+				fmt.Println(indent(strings.TrimRight(result.Output, "\n")))
+			}
+			fmt.Println(indent(lox_error.Render(result.Err, file.Source)))
+			failed++
+		}
+	}
+
+	elapsed := time.Since(start).Round(time.Microsecond)
+	if failed > 0 {
+		fmt.Printf("FAIL: %d passed, %d failed (%s)\n", passed, failed, elapsed)
+		return 1
+	}
+	fmt.Printf("PASS: %d passed (%s)\n", passed, elapsed)
+	return 0
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
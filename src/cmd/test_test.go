@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Returns what f writes to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, f)
+}
+
+// Returns what f writes to stderr
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stderr, f)
+}
+
+// Returns what f writes to file, with file redirected to a pipe while f runs
+func capture(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := *file
+	*file = writer
+	defer func() { *file = original }()
+
+	captured := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		captured <- string(data)
+	}()
+	f()
+	writer.Close()
+	return <-captured
+}
+
+// Durations vary from run to run
+var durations = regexp.MustCompile(`\([0-9.]+[µnm]?s\)`)
+
+func TestRunTests(t *testing.T) {
+	dir := filepath.Join("..", "pkg", "testrunner", "testdata")
+	var status int
+	output := captureStdout(t, func() { status = runTests([]string{dir}) })
+	output = durations.ReplaceAllString(output, "(time)")
+
+	if status != 1 {
+		t.Errorf("status %d", status)
+	}
+	for _, line := range []string{
+		"=== " + filepath.Join(dir, "math_test.lox"),
+		"--- PASS: test_add (time)",
+		"--- FAIL: test_fails (time)",
+		"    checking",
+		"    Runtime error at [line 27, column 29]: Assertion failed: expected [1, 3] but got [1, 2].",
+		"--- FAIL: " + filepath.Join(dir, "nested", "broken_test.lox"),
+		"    Syntax error at [line 2, column 7] at '=': Expect variable name.",
+		"--- FAIL: test_arguments (time)",
+		"FAIL: 5 passed, 3 failed (time)",
+	} {
+		if !strings.Contains(output, line + "\n") {
+			t.Errorf("output is missing %q:\n%s", line, output)
+		}
+	}
+}
+
+func TestRunTestsPassing(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "ok_test.lox"), []byte("fun test_ok() {\n  assertEqual([1], [1]);\n}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status int
+	output := captureStdout(t, func() { status = runTests([]string{dir}) })
+	if status != 0 || !strings.HasPrefix(durations.ReplaceAllString(output, "(time)"), "=== " + filepath.Join(dir, "ok_test.lox") + "\n--- PASS: test_ok (time)\nPASS: 1 passed (time)\n") {
+		t.Errorf("status %d, output:\n%s", status, output)
+	}
+
+	status = runTests([]string{filepath.Join(dir, "missing")})
+	if status != 1 {
+		t.Errorf("status %d for a missing path", status)
+	}
+}
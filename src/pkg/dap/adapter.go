@@ -0,0 +1,516 @@
+// Package dap is a Debug Adapter Protocol adapter for Lox, so editors can
+// run a script with breakpoints, step through it and inspect its variables
+// while it is paused. The script runs on the tree-walking interpreter,
+// which calls back into the adapter before each statement.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lidanielm/glox/src/pkg/internal/framing"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// Lox programs have a single thread
+const threadID = 1
+
+type stepMode int
+
+const (
+	RUN stepMode = iota
+	STEP_IN
+	STEP_OVER
+	STEP_OUT
+)
+
+// at is where a statement runs: its file, line and call depth
+type at struct {
+	path string
+	line int
+	depth int
+}
+
+type Adapter struct {
+	in *bufio.Reader
+	out io.Writer
+	writeLock sync.Mutex
+	seq int // of the last message sent
+
+	run func() error // runs the launched program
+	launched bool
+	configured bool
+	then func() // runs after the current response is sent
+
+	lock sync.Mutex // guards the fields below, shared with the program's goroutine
+	breakpoints map[string]map[int]bool // lines by canonical path
+	mode stepMode
+	from at // where the step started
+	last at // the statement run last
+	entry bool // stop before the first statement
+	pauseRequested bool
+	stopping bool
+	stopped *stopped // nil while the program runs
+
+	requests chan func() // run by the program's goroutine while it is paused
+	resume chan struct{}
+	done chan struct{} // closed when the program ends, nil until it starts
+}
+
+// stopped is the program paused before a statement. It's only used on the
+// program's goroutine.
+type stopped struct {
+	pause *interpreter.Pause
+	stack []interpreter.StackFrame
+	references []func() []interpreter.Variable // expandable values, numbered from 1
+}
+
+// Stops the program when the client disconnects
+var errStopped = lox_error.NewInterruptError("stopped by the debugger.")
+
+func NewAdapter(in io.Reader, out io.Writer) *Adapter {
+	return &Adapter{
+		in: bufio.NewReader(in),
+		out: out,
+		breakpoints: make(map[string]map[int]bool),
+		requests: make(chan func()),
+		resume: make(chan struct{}),
+	}
+}
+
+// Handles requests until the client disconnects or closes the input
+func (a *Adapter) Serve() error {
+	for {
+		req, err := readRequest(a.in)
+		if err == io.EOF {
+			a.stop()
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		body, err := a.handle(req)
+		resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		a.send(resp)
+
+		if a.then != nil {
+			then := a.then
+			a.then = nil
+			then()
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// Writes a response or event, numbering it
+func (a *Adapter) send(msg any) {
+	a.writeLock.Lock()
+	defer a.writeLock.Unlock()
+
+	a.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = a.seq
+	case *event:
+		msg.Seq = a.seq
+	}
+	framing.Write(a.out, msg)
+}
+
+func (a *Adapter) event(name string, body any) {
+	a.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (a *Adapter) handle(req *request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		a.then = func() { a.event("initialized", nil) }
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers": true,
+			"supportsTerminateRequest": true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, a.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return a.setBreakpoints(args), nil
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		a.configured = true
+		a.then = a.start
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "main"}}}, nil
+	case "stackTrace":
+		return a.whilePaused(a.stackTrace)
+	case "scopes":
+		var args frameArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return a.whilePaused(func(s *stopped) (any, error) { return a.scopes(s, args.FrameID) })
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return a.whilePaused(func(s *stopped) (any, error) { return a.variables(s, args.VariablesReference) })
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return a.whilePaused(func(s *stopped) (any, error) { return a.evaluate(s, args) })
+	case "continue":
+		a.then = func() { a.continueWith(RUN) }
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next":
+		a.then = func() { a.continueWith(STEP_OVER) }
+		return nil, nil
+	case "stepIn":
+		a.then = func() { a.continueWith(STEP_IN) }
+		return nil, nil
+	case "stepOut":
+		a.then = func() { a.continueWith(STEP_OUT) }
+		return nil, nil
+	case "pause":
+		a.lock.Lock()
+		a.pauseRequested = a.stopped == nil
+		a.lock.Unlock()
+		return nil, nil
+	case "terminate", "disconnect":
+		a.stop()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported request '%s'.", req.Command)
+}
+
+// Loads the program, reporting syntax and resolution errors. It starts
+// running once the client has finished setting breakpoints.
+func (a *Adapter) launch(args launchArguments) error {
+	path := canonical(args.Program)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := string(data)
+
+	ip := interpreter.NewInterpreter(
+		interpreter.WithOutput(output{a, "stdout"}),
+		interpreter.WithDiagnostics(output{a, "stderr"}),
+		interpreter.WithInput(strings.NewReader("")),
+		interpreter.WithDebugger(a),
+	)
+	ip.SetSource(source)
+	err = ip.SetPath(path)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		return errors.New(lox_error.Render(err, source))
+	}
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return errors.New(lox_error.Render(err, source))
+	}
+	_, err = interpreter.NewResolver(ip).ResolveStmts(statements)
+	if err != nil {
+		return errors.New(lox_error.Render(err, source))
+	}
+
+	a.run = func() error { return ip.Interpret(statements) }
+	a.launched = true
+	a.entry = args.StopOnEntry
+	a.then = a.start
+	return nil
+}
+
+// Runs the program on its own goroutine once it's launched and configured
+func (a *Adapter) start() {
+	if !a.launched || !a.configured || a.done != nil {
+		return
+	}
+
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		exitCode := 0
+		if err := a.run(); err != nil {
+			exitCode = 1
+		}
+		a.event("exited", map[string]any{"exitCode": exitCode})
+		a.event("terminated", nil)
+	}()
+}
+
+// Ends the program, waiting for it to finish
+func (a *Adapter) stop() {
+	if a.done == nil {
+		return
+	}
+
+	a.lock.Lock()
+	a.stopping = true
+	paused := a.stopped != nil
+	a.stopped = nil
+	a.lock.Unlock()
+
+	if paused {
+		a.resume <- struct{}{}
+	}
+	<-a.done
+}
+
+func (a *Adapter) setBreakpoints(args setBreakpointsArguments) map[string]any {
+	lines := make(map[int]bool)
+	breakpoints := []breakpoint{}
+	for _, requested := range args.Breakpoints {
+		lines[requested.Line] = true
+		breakpoints = append(breakpoints, breakpoint{Verified: true, Line: requested.Line})
+	}
+
+	a.lock.Lock()
+	a.breakpoints[canonical(args.Source.Path)] = lines
+	a.lock.Unlock()
+	return map[string]any{"breakpoints": breakpoints}
+}
+
+// Paths are compared the way the interpreter names files, after resolving
+// symlinks
+func canonical(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+	return resolved
+}
+
+// Before is called by the interpreter before each statement, and blocks
+// while the program is paused there
+func (a *Adapter) Before(pause *interpreter.Pause) error {
+	a.lock.Lock()
+	if a.stopping {
+		a.lock.Unlock()
+		return errStopped
+	}
+
+	here := at{path: pause.Path, line: pause.Line, depth: pause.Depth}
+	reason := a.stopReason(here)
+	a.last = here
+	if reason == "" {
+		a.lock.Unlock()
+		return nil
+	}
+
+	s := &stopped{pause: pause, stack: pause.Stack()}
+	a.stopped = s
+	a.mode = RUN
+	a.pauseRequested = false
+	a.entry = false
+	a.lock.Unlock()
+
+	a.event("stopped", stoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+	for {
+		select {
+		case request := <-a.requests:
+			request()
+		case <-a.resume:
+			a.lock.Lock()
+			defer a.lock.Unlock()
+			if a.stopping {
+				return errStopped
+			}
+			return nil
+		}
+	}
+}
+
+// Returns why the program should stop at here, or "" if it shouldn't
+func (a *Adapter) stopReason(here at) string {
+	switch {
+	case a.pauseRequested:
+		return "pause"
+	case a.entry:
+		return "entry"
+	case a.mode == STEP_IN && here != a.from:
+		return "step"
+	case a.mode == STEP_OVER && (here.depth < a.from.depth || here.depth == a.from.depth && here != a.from):
+		return "step"
+	case a.mode == STEP_OUT && here.depth < a.from.depth:
+		return "step"
+	case a.breakpoints[here.path][here.line] && here != a.last:
+		// Statements nested on a line, like the body of a one-line if,
+		// don't stop again
+		return "breakpoint"
+	}
+	return ""
+}
+
+// Lets the paused program go on, stepping or running to the next breakpoint
+func (a *Adapter) continueWith(mode stepMode) {
+	a.lock.Lock()
+	s := a.stopped
+	if s == nil {
+		a.lock.Unlock()
+		return
+	}
+	a.mode = mode
+	a.from = at{path: s.pause.Path, line: s.pause.Line, depth: s.pause.Depth}
+	a.stopped = nil
+	a.lock.Unlock()
+
+	a.resume <- struct{}{}
+}
+
+// Runs f on the program's goroutine if the program is paused
+func (a *Adapter) whilePaused(f func(*stopped) (any, error)) (any, error) {
+	a.lock.Lock()
+	s := a.stopped
+	a.lock.Unlock()
+	if s == nil {
+		return nil, errors.New("The program isn't paused.")
+	}
+
+	var body any
+	var err error
+	done := make(chan struct{})
+	a.requests <- func() {
+		body, err = f(s)
+		close(done)
+	}
+	<-done
+	return body, err
+}
+
+func (a *Adapter) stackTrace(s *stopped) (any, error) {
+	frames := make([]stackFrame, len(s.stack))
+	for i, frame := range s.stack {
+		frames[i] = stackFrame{ID: i + 1, Name: frame.Function, Line: frame.Line, Column: 1}
+		if frame.Path != "" {
+			frames[i].Source = &source{Name: filepath.Base(frame.Path), Path: frame.Path}
+		}
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *stopped) frame(id int) (interpreter.StackFrame, error) {
+	if id == 0 {
+		// Evaluating without a frame, e.g. from a console
+		return s.stack[0], nil
+	} else if id < 1 || id > len(s.stack) {
+		return interpreter.StackFrame{}, fmt.Errorf("No stack frame %d.", id)
+	}
+	return s.stack[id - 1], nil
+}
+
+// Numbers a list of variables the client can ask for
+func (s *stopped) reference(variables func() []interpreter.Variable) int {
+	s.references = append(s.references, variables)
+	return len(s.references)
+}
+
+func (a *Adapter) scopes(s *stopped, frameID int) (any, error) {
+	frame, err := s.frame(frameID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"scopes": []scope{
+		{Name: "Locals", VariablesReference: s.reference(frame.Locals)},
+		{Name: "Globals", VariablesReference: s.reference(frame.Globals)},
+	}}, nil
+}
+
+func (a *Adapter) variables(s *stopped, reference int) (any, error) {
+	if reference < 1 || reference > len(s.references) {
+		return nil, fmt.Errorf("No variables %d.", reference)
+	}
+
+	variables := []variable{}
+	for _, v := range s.references[reference - 1]() {
+		value, ref := s.describe(v.Value)
+		variables = append(variables, variable{Name: v.Name, Value: value, VariablesReference: ref})
+	}
+	return map[string]any{"variables": variables}, nil
+}
+
+func (a *Adapter) evaluate(s *stopped, args evaluateArguments) (any, error) {
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := frame.Evaluate(args.Expression)
+	if err != nil {
+		return nil, errors.New(errorMessage(err))
+	}
+	result, ref := s.describe(value)
+	return map[string]any{"result": result, "variablesReference": ref}, nil
+}
+
+// Formats a value for the client, numbering its members if it has any
+func (s *stopped) describe(value any) (string, int) {
+	text := interpreter.Stringify(value)
+	if _, ok := value.(string); ok {
+		text = fmt.Sprintf("%q", value)
+	}
+
+	if interpreter.Members(value) == nil {
+		return text, 0
+	}
+	return text, s.reference(func() []interpreter.Variable { return interpreter.Members(value) })
+}
+
+// An error's message without the line it's on, which doesn't mean anything
+// for an expression typed into the debugger
+func errorMessage(err error) string {
+	switch err := err.(type) {
+	case *lox_error.RuntimeError:
+		return err.Message
+	case *lox_error.ParseError:
+		return err.Message
+	}
+	return err.Error()
+}
+
+// output sends what the program writes to the client
+type output struct {
+	a *Adapter
+	category string // stdout or stderr
+}
+
+func (o output) Write(p []byte) (int, error) {
+	o.a.event("output", outputEvent{Category: o.category, Output: string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,235 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lidanielm/glox/src/pkg/internal/framing"
+)
+
+const program = `fun square(n) {
+  var result = n * n;
+  return result;
+}
+
+var total = 0;
+for (var i = 1; i <= 3; i = i + 1) {
+  total = total + square(i);
+}
+print total;
+`
+
+// client drives an adapter the way an editor would
+type client struct {
+	t *testing.T
+	out io.Writer
+	seq int
+	responses chan map[string]any
+	events chan map[string]any
+}
+
+func newClient(t *testing.T) *client {
+	fromAdapter, adapterOut := io.Pipe()
+	adapterIn, toAdapter := io.Pipe()
+	c := &client{t: t, out: toAdapter, responses: make(chan map[string]any, 16), events: make(chan map[string]any, 64)}
+
+	go NewAdapter(adapterIn, adapterOut).Serve()
+	go func() {
+		reader := bufio.NewReader(fromAdapter)
+		for {
+			body, err := framing.Read(reader)
+			if err != nil {
+				return
+			}
+
+			var msg map[string]any
+			json.Unmarshal(body, &msg)
+			if msg["type"] == "event" {
+				c.events <- msg
+			} else {
+				c.responses <- msg
+			}
+		}
+	}()
+	t.Cleanup(func() { toAdapter.Close() })
+	return c
+}
+
+func receive(t *testing.T, messages chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the adapter")
+		return nil
+	}
+}
+
+// Sends a request and returns the body of its response, failing the test if
+// it doesn't succeed
+func (c *client) request(command string, arguments any) map[string]any {
+	c.t.Helper()
+	c.seq++
+	framing.Write(c.out, map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+
+	resp := receive(c.t, c.responses)
+	if resp["command"] != command || resp["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, resp)
+	}
+	body, _ := resp["body"].(map[string]any)
+	return body
+}
+
+// Waits for an event, skipping others such as output
+func (c *client) await(name string) map[string]any {
+	c.t.Helper()
+	for {
+		msg := receive(c.t, c.events)
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]any)
+			return body
+		}
+	}
+}
+
+// Returns the name and line of each frame of the paused program
+func (c *client) stack() []string {
+	c.t.Helper()
+	frames := []string{}
+	for _, frame := range c.request("stackTrace", map[string]any{"threadId": threadID})["stackFrames"].([]any) {
+		frame := frame.(map[string]any)
+		frames = append(frames, frame["name"].(string) + ":" + strconv.Itoa(int(frame["line"].(float64))))
+	}
+	return frames
+}
+
+func (c *client) evaluate(expression string) string {
+	c.t.Helper()
+	return c.request("evaluate", map[string]any{"expression": expression, "frameId": 1})["result"].(string)
+}
+
+func TestDebugging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "squares.lox")
+	err := os.WriteFile(path, []byte(program), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]any{"adapterID": "glox"})
+	c.await("initialized")
+	c.request("launch", map[string]any{"program": path})
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{map[string]any{"line": 3}}})
+	c.request("configurationDone", nil)
+
+	stopped := c.await("stopped")
+	if stopped["reason"] != "breakpoint" {
+		t.Errorf("stopped for %v", stopped["reason"])
+	}
+	if stack := c.stack(); len(stack) != 2 || stack[0] != "square:3" || stack[1] != "<script>:8" {
+		t.Errorf("stack: %v", stack)
+	}
+
+	scopes := c.request("scopes", map[string]any{"frameId": 1})["scopes"].([]any)
+	locals := c.request("variables", map[string]any{"variablesReference": scopes[0].(map[string]any)["variablesReference"]})
+	values := map[string]any{}
+	for _, v := range locals["variables"].([]any) {
+		v := v.(map[string]any)
+		values[v["name"].(string)] = v["value"]
+	}
+	if values["result"] != "1" || values["n"] != "1" {
+		t.Errorf("locals: %v", values)
+	}
+
+	// Watch expressions see the paused frame's locals and can change them
+	if result := c.evaluate("n * 10"); result != "10" {
+		t.Errorf("n * 10 = %s", result)
+	}
+	c.evaluate("result = 100")
+
+	// Stepping over the return goes back to the caller, where the loop
+	// increment isn't a statement so the next stop is in the loop body
+	c.request("next", map[string]any{"threadId": threadID})
+	c.await("stopped")
+	if stack := c.stack(); len(stack) != 1 || stack[0] != "<script>:8" {
+		t.Errorf("stack after stepping out of square: %v", stack)
+	}
+	if total := c.evaluate("total"); total != "100" {
+		t.Errorf("total is %s after changing result", total)
+	}
+
+	// Stepping in enters the next call
+	c.request("stepIn", map[string]any{"threadId": threadID})
+	c.await("stopped")
+	if stack := c.stack(); len(stack) != 2 || stack[0] != "square:2" {
+		t.Errorf("stack after stepping in: %v", stack)
+	}
+
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{}})
+	c.request("continue", map[string]any{"threadId": threadID})
+	for {
+		msg := receive(t, c.events)
+		if msg["event"] == "output" {
+			if output := msg["body"].(map[string]any)["output"]; output != "113\n" {
+				t.Errorf("output %q", output)
+			}
+		} else if msg["event"] == "exited" {
+			break
+		}
+	}
+	c.await("terminated")
+	c.request("disconnect", nil)
+}
+
+func TestStopOnEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "point.lox")
+	err := os.WriteFile(path, []byte("class Point {\n  init(x) {\n    this.x = x;\n  }\n}\nvar p = Point(3);\nprint p.x;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]any{"adapterID": "glox"})
+	c.request("launch", map[string]any{"program": path, "stopOnEntry": true})
+	c.request("configurationDone", nil)
+	if stopped := c.await("stopped"); stopped["reason"] != "entry" {
+		t.Errorf("stopped for %v", stopped["reason"])
+	}
+
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{map[string]any{"line": 3}}})
+	c.request("continue", map[string]any{"threadId": threadID})
+	c.await("stopped")
+	if result := c.evaluate("x + 1"); result != "4" {
+		t.Errorf("x + 1 = %s", result)
+	}
+	c.evaluate("this")
+
+	// Instances can be expanded into their fields
+	c.request("next", map[string]any{"threadId": threadID})
+	c.await("stopped")
+	point := c.request("evaluate", map[string]any{"expression": "p", "frameId": 1})
+	fields := c.request("variables", map[string]any{"variablesReference": point["variablesReference"]})["variables"].([]any)
+	if len(fields) != 1 || fields[0].(map[string]any)["name"] != "x" || fields[0].(map[string]any)["value"] != "3" {
+		t.Errorf("fields of p: %v", fields)
+	}
+
+	// Disconnecting while paused ends the program
+	c.request("disconnect", nil)
+}
+
+// A malformed frame stops the adapter with an error instead of a panic
+func TestBadContentLength(t *testing.T) {
+	in := strings.NewReader("Content-Length: -1\r\n\r\n{}")
+	err := NewAdapter(in, io.Discard).Serve()
+	if err == nil || err.Error() != `bad Content-Length header: "-1"` {
+		t.Errorf("error %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+
+	"github.com/lidanielm/glox/src/pkg/internal/framing"
+)
+
+// The parts of the Debug Adapter Protocol the adapter uses. See
+// https://microsoft.github.io/debug-adapter-protocol/specification
+
+type request struct {
+	Seq int `json:"seq"`
+	Command string `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"` // always "response"
+	RequestSeq int `json:"request_seq"`
+	Command string `json:"command"`
+	Success bool `json:"success"`
+	Message string `json:"message,omitempty"`
+	Body any `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"` // always "event"
+	Event string `json:"event"`
+	Body any `json:"body,omitempty"`
+}
+
+// Reads a request framed by a Content-Length header
+func readRequest(r *bufio.Reader) (*request, error) {
+	body, err := framing.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request{}
+	err = json.Unmarshal(body, req)
+	return req, err
+}
+
+type launchArguments struct {
+	Program string `json:"program"`
+	StopOnEntry bool `json:"stopOnEntry"`
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type setBreakpointsArguments struct {
+	Source source `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+}
+
+type breakpoint struct {
+	Verified bool `json:"verified"`
+	Line int `json:"line"`
+	Message string `json:"message,omitempty"`
+}
+
+type stackFrame struct {
+	ID int `json:"id"`
+	Name string `json:"name"`
+	Source *source `json:"source,omitempty"`
+	Line int `json:"line"`
+	Column int `json:"column"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+	VariablesReference int `json:"variablesReference"`
+	Expensive bool `json:"expensive"`
+}
+
+type variable struct {
+	Name string `json:"name"`
+	Value string `json:"value"`
+	VariablesReference int `json:"variablesReference"`
+}
+
+type frameArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+type variablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type evaluateArguments struct {
+	Expression string `json:"expression"`
+	FrameID int `json:"frameId"`
+}
+
+type stoppedEvent struct {
+	Reason string `json:"reason"`
+	ThreadID int `json:"threadId"`
+	AllThreadsStopped bool `json:"allThreadsStopped"`
+}
+
+type outputEvent struct {
+	Category string `json:"category"`
+	Output string `json:"output"`
+}
@@ -0,0 +1,493 @@
+// Package format prints Lox programs in a canonical style: two-space
+// indents, one statement per line, braces on the line that opens them and
+// single spaces around binary operators. Comments are kept, and at most one
+// blank line is kept between statements.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/internal/ast"
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+const indentation = "  "
+
+// Formats Lox source. Source that doesn't parse is returned with its
+// syntax errors instead.
+func Source(source string) (string, error) {
+	scan := scanner.NewScanner(source)
+	tokens, err := scan.ScanTokens()
+	if err != nil {
+		return "", err
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return "", err
+	}
+
+	p := &printer{source: source, out: &bytes.Buffer{}, comments: scan.Comments()}
+	p.lineStarts = append(p.lineStarts, 0)
+	for i, c := range source {
+		if c == '\n' {
+			p.lineStarts = append(p.lineStarts, i + 1)
+		}
+	}
+
+	for _, statement := range statements {
+		p.statement(statement)
+	}
+	p.flushComments(len(source))
+	return p.out.String(), nil
+}
+
+// printer writes statements a line at a time. Comments aren't part of the
+// syntax tree, so each is written before the first statement that follows
+// it, or at the end of the line of the statement it trails. A comment
+// inside a statement stays after the element it follows, and the statement
+// goes on at a deeper indent on the next line.
+type printer struct {
+	source string
+	lineStarts []int // offset of the start of each source line
+	out *bytes.Buffer
+	depth int
+	comments []token.Token
+	next int // first comment not yet written
+	lastLine int // source line the last statement or comment ended on, 0 at the start of a block
+}
+
+// Line of the source the byte at offset is on
+func (p *printer) lineOf(offset int) int {
+	return sort.Search(len(p.lineStarts), func(i int) bool { return p.lineStarts[i] > offset })
+}
+
+func (p *printer) indent() {
+	p.out.WriteString(strings.Repeat(indentation, p.depth))
+}
+
+// Keeps one blank line where the source had one or more before line
+func (p *printer) gap(line int) {
+	if p.lastLine > 0 && line > p.lastLine + 1 {
+		p.out.WriteString("\n")
+	}
+}
+
+// Writes the comments that start before offset, each on its own line
+func (p *printer) flushComments(offset int) {
+	for p.next < len(p.comments) && p.comments[p.next].Start < offset {
+		comment := p.comments[p.next]
+		p.gap(comment.Line)
+		p.indent()
+		p.out.WriteString(strings.TrimRight(comment.Lexeme, " \t\r") + "\n")
+		p.lastLine = comment.Line
+		p.next++
+	}
+}
+
+// Takes the comments that start before offset, inside a statement, and
+// returns them ending lines that each go on at depth
+func (p *printer) commentsBefore(offset int, depth int) string {
+	comments := ""
+	for p.next < len(p.comments) && p.comments[p.next].Start < offset {
+		comment := p.comments[p.next]
+		comments += strings.TrimRight(comment.Lexeme, " \t\r") + "\n" + strings.Repeat(indentation, depth)
+		p.next++
+	}
+	return comments
+}
+
+// The comments before the closing bracket at offset, after a space
+func (p *printer) commentsBeforeClose(offset int) string {
+	if comments := p.commentsBefore(offset, p.depth); comments != "" {
+		return " " + comments
+	}
+	return ""
+}
+
+func (p *printer) statement(s stmt.Stmt) {
+	p.lines(s.Span(), func() { s.Accept(p) })
+}
+
+// Writes a statement or method on its own lines using write, with the
+// comments before it and any comment trailing it on its last line
+func (p *printer) lines(span token.Span, write func()) {
+	p.flushComments(span.Start)
+	p.gap(span.Line)
+	p.indent()
+	write()
+
+	endLine := p.lineOf(span.End - 1)
+	if p.next < len(p.comments) {
+		comment := p.comments[p.next]
+		// A comment after a closing brace trails the enclosing statement, not
+		// the last one in its block
+		between := p.source[min(span.End, comment.Start):comment.Start]
+		if comment.Start >= span.End && comment.Line == endLine && strings.TrimSpace(between) == "" {
+			p.out.WriteString(" " + strings.TrimRight(comment.Lexeme, " \t\r"))
+			p.next++
+		}
+	}
+	p.out.WriteString("\n")
+	p.lastLine = endLine
+}
+
+// Writes statements between braces, ending at the offset of the closing brace
+func (p *printer) block(statements []stmt.Stmt, end int) {
+	if len(statements) == 0 && (p.next >= len(p.comments) || p.comments[p.next].Start >= end) {
+		p.out.WriteString("{}")
+		return
+	}
+
+	p.out.WriteString("{\n")
+	p.depth++
+	p.lastLine = 0
+	p.braceComments(end)
+	for _, statement := range statements {
+		p.statement(statement)
+	}
+	p.flushComments(end)
+	p.depth--
+	p.indent()
+	p.out.WriteString("}")
+}
+
+// Writes the comments between a header and the opening brace of a block
+// that ends at end, which start the block with no blank line after them
+func (p *printer) braceComments(end int) {
+	last := p.next
+	for last < len(p.comments) && p.comments[last].Start < end {
+		rest := strings.TrimLeft(p.source[p.comments[last].End:], " \t\r\n")
+		if strings.HasPrefix(rest, "{") {
+			p.flushComments(p.comments[last].End)
+			p.lastLine = p.lineOf(len(p.source) - len(rest))
+			return
+		}
+		if !strings.HasPrefix(rest, "//") {
+			return
+		}
+		last++
+	}
+}
+
+// Writes the body of an if, else or loop: blocks after a space, anything
+// else on the same line unless a comment comes before it
+func (p *printer) body(s stmt.Stmt) {
+	p.out.WriteString(" ")
+	if block, ok := s.(*stmt.Block); ok && !isForLoop(block) {
+		p.block(block.Statements, block.Span().End - 1)
+		return
+	}
+	p.out.WriteString(p.commentsBefore(s.Span().Start, p.depth + 1))
+	s.Accept(p)
+}
+
+// The parser wraps a for-loop with an initializer in a block starting at
+// the same place as the loop
+func isForLoop(block *stmt.Block) bool {
+	if len(block.Statements) != 2 {
+		return false
+	}
+	loop, ok := block.Statements[1].(*stmt.While)
+	return ok && loop.Keyword.Type == token.FOR && loop.Span().Start == block.Span().Start
+}
+
+func (p *printer) VisitExpressionStmt(s stmt.Expression) error {
+	p.out.WriteString(p.expr(s.Expr) + ";")
+	return nil
+}
+
+func (p *printer) VisitPrintStmt(s stmt.Print) error {
+	p.out.WriteString("print " + p.expr(s.Expr) + ";")
+	return nil
+}
+
+func (p *printer) VisitVarStmt(s stmt.Var) error {
+	p.out.WriteString(p.varDeclaration(s))
+	return nil
+}
+
+func (p *printer) varDeclaration(s stmt.Var) string {
+	if s.Initializer == nil {
+		return "var " + s.Name.Lexeme + ";"
+	}
+	return "var " + s.Name.Lexeme + " = " + p.expr(s.Initializer) + ";"
+}
+
+func (p *printer) VisitBlockStmt(s stmt.Block) error {
+	if isForLoop(&s) {
+		p.forLoop(s.Statements[0], s.Statements[1].(*stmt.While))
+		return nil
+	}
+	p.block(s.Statements, s.Span().End - 1)
+	return nil
+}
+
+func (p *printer) VisitIfStmt(s stmt.If) error {
+	p.out.WriteString("if (" + p.expr(s.Condition) + ")")
+	p.body(s.ThenBranch)
+	if s.ElseBranch == nil {
+		return nil
+	}
+
+	if _, ok := s.ThenBranch.(*stmt.Block); ok {
+		p.out.WriteString(" else")
+	} else {
+		p.out.WriteString("\n")
+		p.indent()
+		p.out.WriteString("else")
+	}
+	p.body(s.ElseBranch)
+	return nil
+}
+
+func (p *printer) VisitWhileStmt(s stmt.While) error {
+	if s.Keyword.Type == token.FOR {
+		p.forLoop(nil, &s)
+		return nil
+	}
+
+	p.out.WriteString("while (" + p.expr(s.Condition) + ")")
+	p.body(s.Body)
+	return nil
+}
+
+func (p *printer) forLoop(initializer stmt.Stmt, loop *stmt.While) {
+	clauses := ";"
+	switch initializer := initializer.(type) {
+	case *stmt.Var:
+		clauses = p.varDeclaration(*initializer)
+	case *stmt.Expression:
+		clauses = p.expr(initializer.Expr) + ";"
+	}
+
+	// A missing condition is filled in by the parser, so has no position
+	if loop.Condition.Span() != (token.Span{}) {
+		clauses += " " + p.expr(loop.Condition)
+	}
+	clauses += ";"
+	if loop.Increment != nil {
+		clauses += " " + p.expr(loop.Increment)
+	}
+
+	p.out.WriteString("for (" + clauses + ")")
+	p.body(loop.Body)
+}
+
+func (p *printer) VisitBreakStmt(s stmt.Break) error {
+	p.out.WriteString("break;")
+	return nil
+}
+
+func (p *printer) VisitContinueStmt(s stmt.Continue) error {
+	p.out.WriteString("continue;")
+	return nil
+}
+
+func (p *printer) VisitFunctionStmt(s stmt.Function) error {
+	p.out.WriteString("fun ")
+	p.function(s)
+	return nil
+}
+
+// Writes a function or method from its name on
+func (p *printer) function(s stmt.Function) {
+	p.out.WriteString(s.Name.Lexeme + "(" + joinNames(s.Params) + ") ")
+	p.block(s.Body, s.Span().End - 1)
+}
+
+func (p *printer) VisitReturnStmt(s stmt.Return) error {
+	if s.Value == nil {
+		p.out.WriteString("return;")
+		return nil
+	}
+	p.out.WriteString("return " + p.expr(s.Value) + ";")
+	return nil
+}
+
+func (p *printer) VisitClassStmt(s stmt.Class) error {
+	p.out.WriteString("class " + s.Name.Lexeme)
+	if s.Superclass != nil {
+		p.out.WriteString(" < " + s.Superclass.Name.Lexeme)
+	}
+
+	end := s.Span().End - 1
+	if len(s.Methods) == 0 && (p.next >= len(p.comments) || p.comments[p.next].Start >= end) {
+		p.out.WriteString(" {}")
+		return nil
+	}
+
+	p.out.WriteString(" {\n")
+	p.depth++
+	p.lastLine = 0
+	p.braceComments(end)
+	for _, method := range s.Methods {
+		p.lines(method.Span(), func() { p.function(method) })
+	}
+	p.flushComments(end)
+	p.depth--
+	p.indent()
+	p.out.WriteString("}")
+	return nil
+}
+
+func (p *printer) VisitImportStmt(s stmt.Import) error {
+	if len(s.Names) == 0 {
+		p.out.WriteString("import " + s.Path.Lexeme + " as " + s.Alias.Lexeme + ";")
+		return nil
+	}
+	p.out.WriteString("from " + s.Path.Lexeme + " import " + joinNames(s.Names) + ";")
+	return nil
+}
+
+func (p *printer) VisitThrowStmt(s stmt.Throw) error {
+	p.out.WriteString("throw " + p.expr(s.Value) + ";")
+	return nil
+}
+
+func (p *printer) VisitTryStmt(s stmt.Try) error {
+	p.out.WriteString("try ")
+	p.block(s.Body.Statements, s.Body.Span().End - 1)
+	if s.Catch != nil {
+		p.out.WriteString(" catch (" + s.CatchName.Lexeme + ") ")
+		p.block(s.Catch.Statements, s.Catch.Span().End - 1)
+	}
+	if s.Finally != nil {
+		p.out.WriteString(" finally ")
+		p.block(s.Finally.Statements, s.Finally.Span().End - 1)
+	}
+	return nil
+}
+
+func (p *printer) expr(e ast.Expr) string {
+	comments := p.commentsBefore(e.Span().Start, p.depth + 1)
+	s, _ := e.Accept(p)
+	return comments + s.(string)
+}
+
+func (p *printer) exprs(es []ast.Expr) string {
+	printed := make([]string, len(es))
+	for i, e := range es {
+		printed[i] = p.expr(e)
+	}
+	return strings.Join(printed, ", ")
+}
+
+func joinNames(names []token.Token) string {
+	lexemes := make([]string, len(names))
+	for i, name := range names {
+		lexemes[i] = name.Lexeme
+	}
+	return strings.Join(lexemes, ", ")
+}
+
+func (p *printer) VisitBinaryExpr(e ast.Binary) (any, error) {
+	// An interpolated string is written as it was, expressions and all
+	span := e.Span()
+	if e.Operator.Type == token.INTERPOLATION && span.End <= len(p.source) {
+		return p.source[span.Start:span.End], nil
+	}
+	return p.expr(e.Left) + " " + e.Operator.Lexeme + " " + p.expr(e.Right), nil
+}
+
+func (p *printer) VisitLogicalExpr(e ast.Logical) (any, error) {
+	return p.expr(e.Left) + " " + e.Operator.Lexeme + " " + p.expr(e.Right), nil
+}
+
+func (p *printer) VisitTernaryExpr(e ast.Ternary) (any, error) {
+	return p.expr(e.Condition) + " ? " + p.expr(e.Left) + " : " + p.expr(e.Right), nil
+}
+
+func (p *printer) VisitGroupingExpr(e ast.Grouping) (any, error) {
+	return "(" + p.expr(e.Expression) + p.commentsBeforeClose(e.Span().End - 1) + ")", nil
+}
+
+// Literals are written as they were in the source, so 1.50 stays 1.50
+func (p *printer) VisitLiteralExpr(e ast.Literal) (any, error) {
+	span := e.Span()
+	if span.End > span.Start && span.End <= len(p.source) {
+		return p.source[span.Start:span.End], nil
+	}
+
+	switch value := e.Value.(type) {
+	case nil:
+		return "nil", nil
+	case string:
+		return "\"" + value + "\"", nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+	return fmt.Sprintf("%v", e.Value), nil
+}
+
+func (p *printer) VisitUnaryExpr(e ast.Unary) (any, error) {
+	return e.Operator.Lexeme + p.expr(e.Right), nil
+}
+
+func (p *printer) VisitVariableExpr(e ast.Variable) (any, error) {
+	return e.Name.Lexeme, nil
+}
+
+func (p *printer) VisitAssignExpr(e ast.Assign) (any, error) {
+	return e.Name.Lexeme + " = " + p.expr(e.Value), nil
+}
+
+func (p *printer) VisitCallExpr(e ast.Call) (any, error) {
+	callee := p.expr(e.Callee)
+	return callee + "(" + p.exprs(e.Arguments) + p.commentsBeforeClose(e.Span().End - 1) + ")", nil
+}
+
+func (p *printer) VisitGetExpr(e ast.Get) (any, error) {
+	return p.expr(e.Object) + "." + e.Name.Lexeme, nil
+}
+
+func (p *printer) VisitSetExpr(e ast.Set) (any, error) {
+	return p.expr(e.Object) + "." + e.Name.Lexeme + " = " + p.expr(e.Value), nil
+}
+
+func (p *printer) VisitThisExpr(e ast.This) (any, error) {
+	return "this", nil
+}
+
+func (p *printer) VisitSuperExpr(e ast.Super) (any, error) {
+	return "super." + e.Method.Lexeme, nil
+}
+
+// A lambda's body is written at the indent of the statement containing it
+func (p *printer) VisitLambdaExpr(e ast.Lambda) (any, error) {
+	out, lastLine := p.out, p.lastLine
+	p.out = &bytes.Buffer{}
+	p.out.WriteString("fun (" + joinNames(e.Params) + ") ")
+	p.block(e.Body.([]stmt.Stmt), e.Span().End - 1)
+	lambda := p.out.String()
+	p.out, p.lastLine = out, lastLine
+	return lambda, nil
+}
+
+func (p *printer) VisitListExpr(e ast.List) (any, error) {
+	return "[" + p.exprs(e.Elements) + p.commentsBeforeClose(e.Span().End - 1) + "]", nil
+}
+
+func (p *printer) VisitMapExpr(e ast.Map) (any, error) {
+	entries := make([]string, len(e.Keys))
+	for i := range e.Keys {
+		entries[i] = p.expr(e.Keys[i]) + ": " + p.expr(e.Values[i])
+	}
+	return "{" + strings.Join(entries, ", ") + p.commentsBeforeClose(e.Span().End - 1) + "}", nil
+}
+
+func (p *printer) VisitSubscriptExpr(e ast.Subscript) (any, error) {
+	object := p.expr(e.Object)
+	return object + "[" + p.expr(e.Index) + p.commentsBeforeClose(e.Span().End - 1) + "]", nil
+}
+
+func (p *printer) VisitSetSubscriptExpr(e ast.SetSubscript) (any, error) {
+	return p.expr(e.Object) + "[" + p.expr(e.Index) + "] = " + p.expr(e.Value), nil
+}
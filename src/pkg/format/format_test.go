@@ -0,0 +1,103 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const messy = `// Adds numbers
+fun add(a,b){return a+b;}   // trailing
+
+
+class Point<Base{
+init(x){this.x=x;}
+}
+for(var i=0;i<3;i=i+1)print add(i,1);
+`
+
+const formatted = `// Adds numbers
+fun add(a, b) {
+  return a + b;
+} // trailing
+
+class Point < Base {
+  init(x) {
+    this.x = x;
+  }
+}
+for (var i = 0; i < 3; i = i + 1) print add(i, 1);
+`
+
+func TestSource(t *testing.T) {
+	actual, err := Source(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != formatted {
+		t.Errorf("expected:\n%s\nactual:\n%s", formatted, actual)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		expected string
+	}{
+		{"in a list", "var xs = [1, // one\n2];\n", "var xs = [1, // one\n  2];\n"},
+		{"before a closing bracket", "var xs = [1,\n  2 // two\n];\n", "var xs = [1, 2 // two\n];\n"},
+		{"in a map", "var m = {\"a\": 1, // first\n\"b\": 2};\n", "var m = {\"a\": 1, // first\n  \"b\": 2};\n"},
+		{"in arguments", "print f(a, // the a\nb);\n", "print f(a, // the a\n  b);\n"},
+		{"after an operator", "var y = a + // left\nb;\n", "var y = a + // left\n  b;\n"},
+		{"in a block", "{\n  var xs = [1, // one\n  2];\n}\n", "{\n  var xs = [1, // one\n    2];\n}\n"},
+		{"after a condition", "if (x) // why\nprint 1;\nelse // otherwise\nprint 2;\n", "if (x) // why\n  print 1;\nelse // otherwise\n  print 2;\n"},
+		{"after a loop", "while (x) // loop\nx = x - 1;\n", "while (x) // loop\n  x = x - 1;\n"},
+		{"before a brace", "if (x) // why\n{\nprint 1;\n}\n", "if (x) {\n  // why\n  print 1;\n}\n"},
+		{"before a class body", "class A // why\n{\nm() {}\n}\n", "class A {\n  // why\n  m() {}\n}\n"},
+		{"after a statement", "print 1; // one\nprint 2;\n", "print 1; // one\nprint 2;\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Source(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected:\n%s\nactual:\n%s", test.expected, actual)
+			}
+			again, err := Source(actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != actual {
+				t.Errorf("formatting isn't idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+// Formatting the output again must leave it unchanged
+func TestIdempotent(t *testing.T) {
+	paths, err := filepath.Glob("../interpreter/testdata/*/*.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		once, err := Source(string(data))
+		if err != nil {
+			continue // scripts testing syntax errors
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("%s: formatted source doesn't parse: %v", path, err)
+		} else if once != twice {
+			t.Errorf("%s: formatting isn't idempotent:\n%s\n---\n%s", path, once, twice)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+type ErrorKind int
+
+const (
+	SyntaxError ErrorKind = iota // scanning, parsing or resolving failed
+	RuntimeError
+	UncaughtError // a value thrown by 'throw' was never caught
+	InterruptedError // cancelled, or ran past one of the VM's limits
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case SyntaxError:
+		return "syntax error"
+	case RuntimeError:
+		return "runtime error"
+	case UncaughtError:
+		return "uncaught exception"
+	case InterruptedError:
+		return "interrupted"
+	}
+	return "error"
+}
+
+// Error is returned for any failure inside Lox code
+type Error struct {
+	Kind ErrorKind
+	File string // the imported module the error is in, empty for the code being run
+	Line int // 0 if unknown
+	Column int // 0 if unknown
+	Message string
+	Thrown Value // the thrown value, for UncaughtError
+	err error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s at [%s, line %d]: %s", e.Kind, e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s at [line %d]: %s", e.Kind, e.Line, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func syntaxError(err error) error {
+	e := &Error{Kind: SyntaxError, Message: err.Error(), err: err}
+
+	var loxError *lox_error.LoxError
+	var parseError *lox_error.ParseError
+	var runtimeError *lox_error.RuntimeError
+	if errors.As(err, &loxError) {
+		e.File, e.Line, e.Column, e.Message = loxError.File, loxError.Token.Line, loxError.Token.Column, loxError.Message
+	} else if errors.As(err, &parseError) {
+		e.File, e.Line, e.Column, e.Message = parseError.File, parseError.Token.Line, parseError.Token.Column, parseError.Message
+	} else if errors.As(err, &runtimeError) {
+		e.File, e.Line, e.Column, e.Message = runtimeError.File, runtimeError.Token.Line, runtimeError.Token.Column, runtimeError.Message
+	}
+
+	return e
+}
+
+func runtimeError(err error) error {
+	var thrown lox_error.ThrowError
+	var runtimeError *lox_error.RuntimeError
+	var interrupt *lox_error.InterruptError
+	var errorList lox_error.ErrorList
+	if errors.As(err, &errorList) {
+		// An imported module didn't compile
+		return syntaxError(err)
+	} else if errors.As(err, &interrupt) {
+		return &Error{Kind: InterruptedError, Message: interrupt.Message, err: err}
+	} else if errors.As(err, &thrown) {
+		value, convertErr := toValue(thrown.Value)
+		if convertErr != nil {
+			// A list or map that contains itself is passed back as a handle
+			value = &Object{value: thrown.Value}
+		}
+		return &Error{Kind: UncaughtError, File: thrown.File, Line: thrown.Token.Line, Column: thrown.Token.Column, Message: interpreter.Stringify(thrown.Value), Thrown: value, err: err}
+	} else if errors.As(err, &runtimeError) {
+		return &Error{Kind: RuntimeError, File: runtimeError.File, Line: runtimeError.Token.Line, Column: runtimeError.Token.Column, Message: runtimeError.Message, err: err}
+	}
+
+	return &Error{Kind: RuntimeError, Message: err.Error(), err: err}
+}
@@ -0,0 +1,221 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Exposes a Go function to Lox as a global native. Parameters and results
+// may be numbers, strings, bools, slices and maps of those, Value, or
+// *Object. The function may also return an error as its last result, which
+// is raised as a runtime error at the Lox call site, as is a panic.
+//
+//	vm.RegisterFunc("repeat", strings.Repeat)
+//	vm.RegisterFunc("parse", func(s string) (float64, error) { ... })
+func (vm *VM) RegisterFunc(name string, fn any) error {
+	native, err := newHostFunc(name, fn)
+	if err != nil {
+		return err
+	}
+
+	vm.ip.DefineGlobal(name, native)
+	return nil
+}
+
+type hostFunc struct {
+	name string
+	fn reflect.Value
+	returnsError bool
+}
+
+func newHostFunc(name string, fn any) (*hostFunc, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return nil, fmt.Errorf("glox: %s is a %T, not a function", name, fn)
+	}
+
+	typ := value.Type()
+	if typ.IsVariadic() {
+		return nil, fmt.Errorf("glox: %s is variadic, which Lox functions can't be", name)
+	}
+
+	returnsError := typ.NumOut() > 0 && typ.Out(typ.NumOut() - 1) == errorType
+	results := typ.NumOut()
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("glox: %s returns %d values, but at most one value and an error are allowed", name, results)
+	}
+
+	return &hostFunc{name: name, fn: value, returnsError: returnsError}, nil
+}
+
+func (h *hostFunc) Arity() int {
+	return h.fn.Type().NumIn()
+}
+
+// Calls the Go function. A panic in it becomes an error, which the
+// interpreter raises as a runtime error at the Lox call site.
+func (h *hostFunc) Call(ip *interpreter.Interpreter, arguments []any) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("'%s' panicked: %v", h.name, r)
+		}
+	}()
+
+	typ := h.fn.Type()
+	in := make([]reflect.Value, len(arguments))
+	for i, argument := range arguments {
+		converted, err := toGo(argument, typ.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("Argument %d to '%s' %s.", i + 1, h.name, err.Error())
+		}
+		in[i] = converted
+	}
+
+	out := h.fn.Call(in)
+	if h.returnsError {
+		if err := out[len(out) - 1]; !err.IsNil() {
+			// Calling back into Lox may have been interrupted, which stops the
+			// whole run rather than becoming an error Lox could catch
+			var interrupt *lox_error.InterruptError
+			if errors.As(err.Interface().(error), &interrupt) {
+				return nil, interrupt
+			}
+			return nil, err.Interface().(error)
+		}
+		out = out[:len(out) - 1]
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	result, err = fromValue(out[0].Interface())
+	if err != nil {
+		return nil, fmt.Errorf("'%s' returned a value Lox can't represent.", h.name)
+	}
+	return result, nil
+}
+
+func (h *hostFunc) String() string {
+	return "<native fn " + h.name + ">"
+}
+
+// Converts a Lox value to the Go type a host function expects. Errors are
+// phrased to follow "Argument N to 'name' ..."
+func toGo(value any, typ reflect.Type) (reflect.Value, error) {
+	if typ.Kind() == reflect.Interface {
+		if value == nil {
+			return reflect.Zero(typ), nil
+		}
+
+		goValue, err := toValue(value)
+		if err != nil {
+			return reflect.Value{}, errors.New("contains itself")
+		}
+		converted := reflect.ValueOf(goValue)
+		if !converted.Type().AssignableTo(typ) {
+			return reflect.Value{}, fmt.Errorf("must be a %s", typ)
+		}
+		return converted, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return reflect.Value{}, errors.New("must be a boolean")
+		}
+		return reflect.ValueOf(b).Convert(typ), nil
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return reflect.Value{}, errors.New("must be a string")
+		}
+		return reflect.ValueOf(s).Convert(typ), nil
+	case reflect.Float32, reflect.Float64:
+		num, ok := value.(float64)
+		if !ok {
+			return reflect.Value{}, errors.New("must be a number")
+		}
+		return reflect.ValueOf(num).Convert(typ), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			return reflect.Value{}, errors.New("must be an integer")
+		}
+
+		converted := reflect.New(typ).Elem()
+		if converted.OverflowInt(int64(num)) {
+			return reflect.Value{}, fmt.Errorf("is out of range for %s", typ)
+		}
+		converted.SetInt(int64(num))
+		return converted, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			return reflect.Value{}, errors.New("must be an integer")
+		}
+
+		converted := reflect.New(typ).Elem()
+		if num < 0 || converted.OverflowUint(uint64(num)) {
+			return reflect.Value{}, fmt.Errorf("is out of range for %s", typ)
+		}
+		converted.SetUint(uint64(num))
+		return converted, nil
+	case reflect.Slice:
+		list, ok := value.(*interpreter.List)
+		if !ok {
+			return reflect.Value{}, errors.New("must be a list")
+		}
+
+		slice := reflect.MakeSlice(typ, list.Len(), list.Len())
+		for i, element := range list.Elements() {
+			converted, err := toGo(element, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("has an element that %s", err.Error())
+			}
+			slice.Index(i).Set(converted)
+		}
+		return slice, nil
+	case reflect.Map:
+		m, ok := value.(*interpreter.Map)
+		if !ok {
+			return reflect.Value{}, errors.New("must be a map")
+		}
+
+		result := reflect.MakeMapWithSize(typ, m.Len())
+		for _, key := range m.Keys() {
+			convertedKey, err := toGo(key, typ.Key())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("has a key that %s", err.Error())
+			}
+
+			entry, _ := m.Lookup(key)
+			convertedEntry, err := toGo(entry, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("has a value that %s", err.Error())
+			}
+			result.SetMapIndex(convertedKey, convertedEntry)
+		}
+		return result, nil
+	case reflect.Pointer:
+		if typ == reflect.TypeOf((*Object)(nil)) {
+			switch value.(type) {
+			case nil, bool, float64, string, *interpreter.List, *interpreter.Map:
+				return reflect.Value{}, errors.New("must be a function, class or instance")
+			}
+			return reflect.ValueOf(&Object{value: value}), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("has unsupported Go type %s", typ)
+}
@@ -0,0 +1,183 @@
+package glox
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	tests := []struct {
+		name string
+		fn any
+		message string
+	}{
+		{"not a function", 42, "is a int, not a function"},
+		{"variadic", func(xs ...int) {}, "is variadic"},
+		{"two results", func() (int, int) { return 1, 2 }, "returns 2 values"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newTestVM(t).RegisterFunc("f", test.fn)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}
+
+// Lox arguments are converted to the Go types the function takes, and its
+// result back to Lox
+func TestHostFuncConversions(t *testing.T) {
+	type name string
+	funcs := map[string]any{
+		"repeat": strings.Repeat,
+		"not": func(b bool) bool { return !b },
+		"greet": func(n name) string { return "hi " + string(n) },
+		"half": func(x float32) float64 { return float64(x) / 2 },
+		"byte": func(b uint8) int { return int(b) },
+		"small": func(i int8) int8 { return i },
+		"sum": func(xs []int) int {
+			total := 0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		},
+		"keys": func(m map[string]float64) []string {
+			keys := []string{}
+			for k := range m {
+				keys = append(keys, k)
+			}
+			return keys
+		},
+		"describe": func(v Value) string {
+			switch v.(type) {
+			case nil:
+				return "nil"
+			case []Value:
+				return "list"
+			case *Object:
+				return "object"
+			}
+			return "other"
+		},
+		"apply": func(f *Object) *Object { return f },
+		"nothing": func() {},
+		"parse": func(s string) (float64, error) {
+			if s == "" {
+				return 0, errors.New("Empty input.")
+			}
+			return float64(len(s)), nil
+		},
+		"channel": func() chan int { return make(chan int) },
+		"boom": func() int { panic("out of cheese") },
+		"index": func(xs []int, i int) int { return xs[i] },
+		"counts": func(words []string) map[string]int {
+			counts := map[string]int{}
+			for _, word := range words {
+				counts[word]++
+			}
+			return counts
+		},
+	}
+
+	tests := []struct {
+		source string
+		expected string // printed output, or the start of the error
+	}{
+		{`print repeat("ab", 3);`, "ababab"},
+		{`print not(false);`, "true"},
+		{`print greet("lox");`, "hi lox"},
+		{`print half(3);`, "1.5"},
+		{`print byte(255);`, "255"},
+		{`print sum([1, 2, 3]);`, "6"},
+		{`print keys({"a": 1});`, "[a]"},
+		{`print describe(nil); print describe([1]); print describe(clock);`, "nil\nlist\nobject"},
+		{`fun f() { return 1; } print apply(f)();`, "1"},
+		{`print nothing();`, "nil"},
+		{`print parse("abc");`, "3"},
+		{`print counts(["a", "b", "a"])["a"];`, "2"},
+		{`print repeat;`, "<native fn repeat>"},
+		{`print repeat("a");`, "Expected 2 arguments but got 1."},
+		{`print repeat(1, 2);`, "Argument 1 to 'repeat' must be a string."},
+		{`print not(nil);`, "Argument 1 to 'not' must be a boolean."},
+		{`print byte(1.5);`, "Argument 1 to 'byte' must be an integer."},
+		{`print byte(-1);`, "Argument 1 to 'byte' is out of range for uint8."},
+		{`print small(200);`, "Argument 1 to 'small' is out of range for int8."},
+		{`print sum([1, "2"]);`, "Argument 1 to 'sum' has an element that must be an integer."},
+		{`print sum(1);`, "Argument 1 to 'sum' must be a list."},
+		{`print keys({1: 2});`, "Argument 1 to 'keys' has a key that must be a string."},
+		{`print apply(1);`, "Argument 1 to 'apply' must be a function, class or instance."},
+		{`var xs = []; xs.push(xs); print describe(xs);`, "Argument 1 to 'describe' contains itself."},
+		{`print parse("");`, "Empty input."},
+		{`print channel();`, "'channel' returned a value Lox can't represent."},
+		{`print boom();`, "'boom' panicked: out of cheese"},
+		{`print index([1], 5);`, "'index' panicked: runtime error: index out of range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			var output bytes.Buffer
+			vm := New(WithOutput(&output))
+			for name, fn := range funcs {
+				err := vm.RegisterFunc(name, fn)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := vm.Eval(test.source)
+			if err != nil {
+				var loxError *Error
+				if !errors.As(err, &loxError) || loxError.Kind != RuntimeError || loxError.Line != 1 {
+					t.Fatalf("expected a runtime error on line 1, got %#v", err)
+				}
+				if !strings.HasPrefix(loxError.Message, test.expected) {
+					t.Errorf("expected error %q, got %q", test.expected, loxError.Message)
+				}
+				return
+			}
+			if actual := strings.TrimSuffix(output.String(), "\n"); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+// An error returned by a host function is a runtime error Lox code can catch
+func TestHostFuncErrorCaught(t *testing.T) {
+	var output bytes.Buffer
+	vm := New(WithOutput(&output))
+	vm.RegisterFunc("check", func(n float64) (bool, error) {
+		if n < 0 {
+			return false, errors.New("Must not be negative.")
+		}
+		return true, nil
+	})
+
+	_, err := vm.Eval("print check(1);\ntry { check(-1); } catch (e) { print e.message; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "true\nMust not be negative.\n" {
+		t.Errorf("output: %q", output.String())
+	}
+}
+
+// A panic in a host function is a runtime error Lox code can catch
+func TestHostFuncPanicCaught(t *testing.T) {
+	var output bytes.Buffer
+	vm := New(WithOutput(&output))
+	vm.RegisterFunc("boom", func() { panic(errors.New("kaboom")) })
+
+	_, err := vm.Eval("try { boom(); } catch (e) { print e.message; }\nprint \"after\";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "'boom' panicked: kaboom\nafter\n" {
+		t.Errorf("output: %q", output.String())
+	}
+}
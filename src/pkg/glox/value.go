@@ -0,0 +1,137 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+)
+
+// Value is a Lox value as seen from Go. Nil, booleans, numbers (float64) and
+// strings map directly; lists become []Value and maps map[Value]Value, both
+// copies. Functions, classes, instances and modules are returned as *Object
+// handles, which can be passed back into the VM.
+//
+// Values going into the VM may additionally be any Go integer or float type,
+// and any slice, array or map of convertible values.
+type Value = any
+
+// Object is an opaque handle to a Lox value with no Go equivalent
+type Object struct {
+	value any
+}
+
+func (o *Object) String() string {
+	return fmt.Sprintf("%v", o.value)
+}
+
+// Converts a Lox value for Go. Lists and maps are copied, so one that
+// contains itself can't be converted.
+func toValue(value any) (Value, error) {
+	return toValueIn(value, make(map[any]bool))
+}
+
+// seen holds the lists and maps being copied around value
+func toValueIn(value any, seen map[any]bool) (Value, error) {
+	switch value := value.(type) {
+	case nil, bool, float64, string:
+		return value, nil
+	case *interpreter.List:
+		if seen[value] {
+			return nil, errors.New("glox: can't convert a list that contains itself")
+		}
+		seen[value] = true
+		defer delete(seen, value)
+
+		elements := make([]Value, value.Len())
+		for i, element := range value.Elements() {
+			converted, err := toValueIn(element, seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = converted
+		}
+		return elements, nil
+	case *interpreter.Map:
+		if seen[value] {
+			return nil, errors.New("glox: can't convert a map that contains itself")
+		}
+		seen[value] = true
+		defer delete(seen, value)
+
+		entries := make(map[Value]Value, value.Len())
+		for _, key := range value.Keys() {
+			entry, _ := value.Lookup(key)
+			converted, err := toValueIn(entry, seen)
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = converted
+		}
+		return entries, nil
+	default:
+		return &Object{value: value}, nil
+	}
+}
+
+func fromValue(value Value) (any, error) {
+	switch value := value.(type) {
+	case nil, bool, float64, string:
+		return value, nil
+	case *Object:
+		// A nil handle is Lox's nil, like a nil interface
+		if value == nil {
+			return nil, nil
+		}
+		return value.value, nil
+	}
+
+	// Everything else is converted by kind, so named types and arbitrary
+	// slice and map types are accepted too
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]any, v.Len())
+		for i := range elements {
+			converted, err := fromValue(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = converted
+		}
+		return interpreter.NewList(elements), nil
+	case reflect.Map:
+		m := interpreter.NewMap()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromValue(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			entry, err := fromValue(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			err = m.Put(key, entry)
+			if err != nil {
+				return nil, fmt.Errorf("glox: unhashable map key %v", iter.Key().Interface())
+			}
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("glox: can't convert %T to a Lox value", value)
+}
@@ -0,0 +1,169 @@
+package glox
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestVM(t *testing.T) *VM {
+	t.Helper()
+	return New(WithOutput(io.Discard), WithDiagnostics(io.Discard))
+}
+
+// Values set from Go come back out of Lox as their Lox equivalents
+func TestRoundTrip(t *testing.T) {
+	type celsius float32
+	tests := []struct {
+		name string
+		in Value
+		out Value
+	}{
+		{"nil", nil, nil},
+		{"bool", true, true},
+		{"float", 1.5, 1.5},
+		{"int", 42, 42.0},
+		{"uint8", uint8(7), 7.0},
+		{"named type", celsius(20), 20.0},
+		{"string", "lox", "lox"},
+		{"slice", []int{1, 2}, []Value{1.0, 2.0}},
+		{"array", [2]string{"a", "b"}, []Value{"a", "b"}},
+		{"nested", []any{1, []string{"x"}, nil}, []Value{1.0, []Value{"x"}, nil}},
+		{"map", map[string]int{"a": 1}, map[Value]Value{"a": 1.0}},
+		{"nil object", (*Object)(nil), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := newTestVM(t)
+			err := vm.SetGlobal("x", test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := vm.GetGlobal("x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(value, test.out) {
+				t.Errorf("expected %#v, got %#v", test.out, value)
+			}
+		})
+	}
+}
+
+// Lox values with no Go equivalent come out as handles that can be passed back in
+func TestObjects(t *testing.T) {
+	vm := newTestVM(t)
+	_, err := vm.Eval("class Point { init(x) { this.x = x; } }\nfun getX(p) { return p.x; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	point, err := vm.Call("Point", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, ok := point.(*Object)
+	if !ok || object.String() != "Point instance" {
+		t.Fatalf("expected a Point handle, got %#v", point)
+	}
+
+	x, err := vm.Call("getX", object)
+	if err != nil || x != 3.0 {
+		t.Errorf("getX: %v, %v", x, err)
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	vm := newTestVM(t)
+	tests := []struct {
+		name string
+		value Value
+		message string
+	}{
+		{"channel", make(chan int), "can't convert chan int"},
+		{"function", func() {}, "can't convert func()"},
+		{"unhashable key", map[[1]int]int{{1}: 1}, "unhashable map key"},
+		{"element", []any{1, make(chan int)}, "can't convert chan int"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := vm.SetGlobal("x", test.value)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+
+	_, err := vm.GetGlobal("missing")
+	if err == nil || !strings.Contains(err.Error(), "undefined variable 'missing'") {
+		t.Errorf("missing global: %v", err)
+	}
+}
+
+// Lists and maps that contain themselves can't be copied out of Lox
+func TestCycles(t *testing.T) {
+	vm := newTestVM(t)
+	_, err := vm.Eval("var xs = [1];\nxs.push(xs);\nvar m = {};\nm[\"m\"] = [m];\nvar shared = [1];\nvar twice = [shared, shared];")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"xs", "m"} {
+		_, err := vm.GetGlobal(name)
+		if err == nil || !strings.Contains(err.Error(), "contains itself") {
+			t.Errorf("%s: expected a cycle error, got %v", name, err)
+		}
+	}
+	_, err = vm.Eval("xs;")
+	if err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("Eval: expected a cycle error, got %v", err)
+	}
+
+	// The same list twice is not a cycle
+	twice, err := vm.GetGlobal("twice")
+	if err != nil || !reflect.DeepEqual(twice, []Value{[]Value{1.0}, []Value{1.0}}) {
+		t.Errorf("twice: %#v, %v", twice, err)
+	}
+
+	// A thrown cycle still reports an error, with the value as a handle
+	_, err = vm.Eval("throw xs;")
+	var loxError *Error
+	if !errors.As(err, &loxError) || loxError.Kind != UncaughtError || loxError.Message != "[1, [...]]" {
+		t.Fatalf("throw: %#v", err)
+	}
+	if _, ok := loxError.Thrown.(*Object); !ok {
+		t.Errorf("thrown: %#v", loxError.Thrown)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		kind ErrorKind
+		line int
+		message string
+	}{
+		{"syntax", "var = 1;", SyntaxError, 1, "Expect variable name."},
+		{"resolve", "\nreturn 1;", SyntaxError, 2, "Can't return from top-level code."},
+		{"runtime", "1 + nil;", RuntimeError, 1, "Operands must be two numbers or two strings."},
+		{"uncaught", "throw \"boom\";", UncaughtError, 1, "boom"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newTestVM(t).Eval(test.source)
+			var loxError *Error
+			if !errors.As(err, &loxError) {
+				t.Fatalf("expected an *Error, got %#v", err)
+			}
+			if loxError.Kind != test.kind || loxError.Line != test.line || !strings.Contains(loxError.Message, test.message) {
+				t.Errorf("got %v %d %q", loxError.Kind, loxError.Line, loxError.Message)
+			}
+		})
+	}
+}
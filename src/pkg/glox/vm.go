@@ -0,0 +1,180 @@
+// Package glox embeds the Lox interpreter in Go programs.
+//
+//	vm := glox.New()
+//	vm.SetGlobal("name", "world")
+//	_, err := vm.Eval(`fun greet() { return "hello " + name; }`)
+//	greeting, err := vm.Call("greet")
+package glox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// VM is a Lox interpreter whose global state persists across calls.
+// A VM is not safe for concurrent use.
+type VM struct {
+	ip *interpreter.Interpreter
+}
+
+type Option = interpreter.Option
+
+// Sends output from Lox print statements to w instead of os.Stdout
+func WithOutput(w io.Writer) Option {
+	return interpreter.WithOutput(w)
+}
+
+// Sends warnings to w instead of os.Stderr. Errors are returned, not written.
+func WithDiagnostics(w io.Writer) Option {
+	return interpreter.WithDiagnostics(w)
+}
+
+// Serves the input() and readLine() natives from r instead of os.Stdin
+func WithInput(r io.Reader) Option {
+	return interpreter.WithInput(r)
+}
+
+// Caps the statements executed by each Eval, RunFile or Call
+func WithMaxSteps(n int) Option {
+	return interpreter.WithMaxSteps(n)
+}
+
+// Caps how deeply Lox calls may nest before raising "Stack overflow."
+func WithMaxCallDepth(n int) Option {
+	return interpreter.WithMaxCallDepth(n)
+}
+
+// Caps the lists, maps, instances, closures and concatenated strings created
+// by each Eval, RunFile or Call
+func WithMaxAllocations(n int) Option {
+	return interpreter.WithMaxAllocations(n)
+}
+
+func New(options ...Option) *VM {
+	return &VM{ip: interpreter.NewInterpreter(options...)}
+}
+
+// Runs Lox source in the VM's global scope. If the last statement is an
+// expression statement its value is returned, otherwise nil.
+func (vm *VM) Eval(source string) (Value, error) {
+	return vm.EvalContext(context.Background(), source)
+}
+
+// Like Eval, but stops with an error once ctx is cancelled
+func (vm *VM) EvalContext(ctx context.Context, source string) (Value, error) {
+	statements, err := vm.compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := vm.ip.RunContext(ctx, statements)
+	if err != nil {
+		return nil, runtimeError(err)
+	}
+
+	return toValue(value)
+}
+
+// Runs a Lox script. Imports inside it resolve relative to its directory.
+func (vm *VM) RunFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = vm.ip.SetPath(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = vm.Eval(string(data))
+	return err
+}
+
+// Defines a global variable visible to Lox code. See Value for the Go types
+// that can be converted.
+func (vm *VM) SetGlobal(name string, value Value) error {
+	loxValue, err := fromValue(value)
+	if err != nil {
+		return err
+	}
+
+	vm.ip.DefineGlobal(name, loxValue)
+	return nil
+}
+
+// Returns the value of a global variable. It fails if there is no such
+// variable, or its value is a list or map that contains itself.
+func (vm *VM) GetGlobal(name string) (Value, error) {
+	value, ok := vm.ip.LookupGlobal(name)
+	if !ok {
+		return nil, fmt.Errorf("glox: undefined variable '%s'", name)
+	}
+
+	return toValue(value)
+}
+
+// Calls the global function (or class) named fnName with the given arguments
+func (vm *VM) Call(fnName string, args ...Value) (Value, error) {
+	return vm.CallContext(context.Background(), fnName, args...)
+}
+
+// Like Call, but stops with an error once ctx is cancelled
+func (vm *VM) CallContext(ctx context.Context, fnName string, args ...Value) (Value, error) {
+	callee, ok := vm.ip.LookupGlobal(fnName)
+	if !ok {
+		return nil, fmt.Errorf("glox: undefined function '%s'", fnName)
+	}
+
+	callable, ok := callee.(interpreter.Callable)
+	if !ok {
+		return nil, fmt.Errorf("glox: '%s' is not callable", fnName)
+	}
+
+	if len(args) != callable.Arity() {
+		return nil, fmt.Errorf("glox: '%s' expects %d arguments but got %d", fnName, callable.Arity(), len(args))
+	}
+
+	arguments := make([]any, len(args))
+	for i, arg := range args {
+		value, err := fromValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		arguments[i] = value
+	}
+
+	value, err := vm.ip.Call(ctx, callable, arguments)
+	if err != nil {
+		return nil, runtimeError(err)
+	}
+
+	return toValue(value)
+}
+
+// Scans, parses and resolves source, reporting any failure as a SyntaxError
+func (vm *VM) compile(source string) ([]stmt.Stmt, error) {
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+
+	_, err = interpreter.NewResolver(vm.ip).ResolveStmts(statements)
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+
+	return statements, nil
+}
@@ -0,0 +1,272 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.lox": "fun double(x) {\n  return x * 2;\n}\n",
+		"main.lox": "import \"lib.lox\" as lib;\nprint lib.double(21);\nvar result = lib.double(2);\n",
+	}
+	for name, source := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Imports resolve relative to the file, not the working directory
+	var output bytes.Buffer
+	vm := New(WithOutput(&output), WithDiagnostics(io.Discard))
+	err := vm.RunFile(filepath.Join(dir, "main.lox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "42\n" {
+		t.Errorf("output %q", output.String())
+	}
+	if result, err := vm.GetGlobal("result"); err != nil || result != 4.0 {
+		t.Errorf("result %v, error %v", result, err)
+	}
+
+	err = vm.RunFile(filepath.Join(dir, "missing.lox"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+}
+
+// Errors inside an imported module say which file they're in
+func TestRunFileModuleError(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"fails.lox": "var x = 1;\n\n\nprint x + nil;\n",
+		"broken.lox": "var x = 1;\nvar = 2;\n",
+		"run_fails.lox": "import \"fails.lox\" as fails;\n",
+		"run_broken.lox": "import \"broken.lox\" as broken;\n",
+	}
+	for name, source := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		main string
+		module string
+		kind ErrorKind
+		line int
+		message string
+	}{
+		{"run_fails.lox", "fails.lox", RuntimeError, 4, "Operands must be two numbers or two strings."},
+		{"run_broken.lox", "broken.lox", SyntaxError, 2, "Expect variable name."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.main, func(t *testing.T) {
+			vm := New(WithOutput(io.Discard), WithDiagnostics(io.Discard))
+			err := vm.RunFile(filepath.Join(dir, test.main))
+			var loxError *Error
+			if !errors.As(err, &loxError) {
+				t.Fatalf("expected a Lox error, got %v", err)
+			}
+
+			module, _ := filepath.EvalSymlinks(filepath.Join(dir, test.module))
+			if loxError.Kind != test.kind || loxError.File != module || loxError.Line != test.line || loxError.Message != test.message {
+				t.Errorf("error %+v", loxError)
+			}
+			expected := fmt.Sprintf("%s at [%s, line %d]: %s", test.kind, module, test.line, test.message)
+			if loxError.Error() != expected {
+				t.Errorf("expected %q, got %q", expected, loxError.Error())
+			}
+		})
+	}
+}
+
+// Each Eval runs in the same global scope
+func TestEvalGlobals(t *testing.T) {
+	vm := newTestVM(t)
+	_, err := vm.Eval("var count = 1;\nfun bump() {\n  count = count + 1;\n  return count;\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := vm.Eval("bump();\nbump();")
+	if err != nil || value != 3.0 {
+		t.Errorf("value %v, error %v", value, err)
+	}
+	value, err = vm.Eval("print count;")
+	if err != nil || value != nil {
+		t.Errorf("a statement that isn't an expression gave %v, error %v", value, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	vm := newTestVM(t)
+	_, err := vm.Eval("fun add(a, b) { return a + b; }\nclass Point { init(x) { this.x = x; } }\nvar notAFunction = 1;\nfun fail() { return nil + 1; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := vm.Call("add", "a", "b")
+	if err != nil || value != "ab" {
+		t.Errorf("add: %v, error %v", value, err)
+	}
+	value, err = vm.Call("Point", 1)
+	if object, ok := value.(*Object); err != nil || !ok || object.String() != "Point instance" {
+		t.Errorf("Point: %v, error %v", value, err)
+	}
+
+	tests := []struct {
+		name string
+		args []Value
+		message string
+	}{
+		{"missing", nil, "glox: undefined function 'missing'"},
+		{"notAFunction", nil, "glox: 'notAFunction' is not callable"},
+		{"add", []Value{1}, "glox: 'add' expects 2 arguments but got 1"},
+		{"add", []Value{1, struct{}{}}, ""},
+	}
+	for _, test := range tests {
+		_, err := vm.Call(test.name, test.args...)
+		if err == nil || (test.message != "" && err.Error() != test.message) {
+			t.Errorf("%s%v: error %v", test.name, test.args, err)
+		}
+	}
+
+	_, err = vm.Call("fail")
+	var loxError *Error
+	if !errors.As(err, &loxError) || loxError.Kind != RuntimeError || loxError.Line != 4 {
+		t.Errorf("fail: error %#v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		options []Option
+		source string
+		message string
+	}{
+		{"steps", []Option{WithMaxSteps(50)}, "while (true) {}", "exceeded the limit of 50 executed statements."},
+		{"allocations", []Option{WithMaxAllocations(5)}, "var xs = [];\nwhile (true) xs = [xs];", "exceeded the limit of 5 allocated values."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := New(append(test.options, WithOutput(io.Discard), WithDiagnostics(io.Discard))...)
+			_, err := vm.Eval(test.source)
+			var loxError *Error
+			if !errors.As(err, &loxError) || loxError.Kind != InterruptedError || loxError.Message != test.message {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+
+	vm := New(WithMaxCallDepth(10), WithOutput(io.Discard), WithDiagnostics(io.Discard))
+	_, err := vm.Eval("fun f() { f(); }\nf();")
+	var loxError *Error
+	if !errors.As(err, &loxError) || loxError.Kind != RuntimeError || loxError.Message != "Stack overflow." {
+		t.Errorf("call depth: error %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm := newTestVM(t)
+	_, err := vm.EvalContext(ctx, "while (true) {}")
+	var loxError *Error
+	if !errors.As(err, &loxError) || loxError.Kind != InterruptedError || loxError.Message != "context canceled." {
+		t.Errorf("EvalContext: error %v", err)
+	}
+
+	_, err = vm.Eval("fun spin() { while (true) {} }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.CallContext(ctx, "spin")
+	if !errors.As(err, &loxError) || loxError.Kind != InterruptedError {
+		t.Errorf("CallContext: error %v", err)
+	}
+
+	// The VM can still be used once a run is cancelled
+	value, err := vm.Eval("1 + 1;")
+	if err != nil || value != 2.0 {
+		t.Errorf("value %v, error %v", value, err)
+	}
+}
+
+// A host function calling back into Lox counts against the run that called
+// it, so it can't be used to escape the limits or the context
+func TestReentrantLimits(t *testing.T) {
+	newReentrantVM := func(options ...Option) *VM {
+		vm := New(append(options, WithOutput(io.Discard), WithDiagnostics(io.Discard))...)
+		err := vm.RegisterFunc("callback", func() (Value, error) {
+			return vm.Call("tick")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = vm.Eval("fun tick() { return 1; }")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vm
+	}
+
+	vm := newReentrantVM(WithMaxSteps(1000))
+	_, err := vm.Eval("while (true) { callback(); }")
+	var loxError *Error
+	if !errors.As(err, &loxError) || loxError.Kind != InterruptedError || loxError.Message != "exceeded the limit of 1000 executed statements." {
+		t.Errorf("steps: error %v", err)
+	}
+
+	// The step limit is only a backstop in case the deadline is missed
+	vm = newReentrantVM(WithMaxSteps(10000000))
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	_, err = vm.EvalContext(ctx, "while (true) { callback(); }")
+	if !errors.As(err, &loxError) || loxError.Kind != InterruptedError || loxError.Message != "context deadline exceeded." {
+		t.Errorf("context: error %v", err)
+	}
+
+	// Nor can an interrupted callback be caught
+	var output bytes.Buffer
+	vm = New(WithOutput(&output), WithDiagnostics(io.Discard))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	vm.RegisterFunc("spin", func() (Value, error) {
+		return vm.CallContext(cancelled, "loop")
+	})
+	_, err = vm.Eval("fun loop() { while (true) {} }\ntry { spin(); } catch (e) { print \"caught\"; }")
+	if !errors.As(err, &loxError) || loxError.Kind != InterruptedError || loxError.Message != "context canceled." || output.Len() > 0 {
+		t.Errorf("caught: error %v, output %q", err, output.String())
+	}
+
+	// Nested calls are counted towards the depth of the calls around them
+	vm = newReentrantVM(WithMaxCallDepth(20))
+	_, err = vm.Eval("fun recurse(n) { if (n > 0) recurse(n - 1); return callback(); }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.Call("recurse", 10.0)
+	if err != nil {
+		t.Errorf("shallow: error %v", err)
+	}
+	_, err = vm.Call("recurse", 30.0)
+	if !errors.As(err, &loxError) || loxError.Message != "Stack overflow." {
+		t.Errorf("deep: error %v", err)
+	}
+}
@@ -6,6 +6,34 @@ import (
 
 type Expr interface {
 	Accept(visitor Visitor[any]) (any, error)
+	Span() token.Span
+}
+
+// Node records where a syntax node appears in its source. It is embedded in
+// every expression and statement.
+type Node struct {
+	Pos token.Span
+}
+
+func (n Node) Span() token.Span {
+	return n.Pos
+}
+
+func (n *Node) SetSpan(span token.Span) {
+	n.Pos = span
+}
+
+// Binding is where the resolver found a variable: in slot Slot of the
+// environment Depth scopes out from the use, or a global if Depth is -1.
+// Nodes are passed to visitors by value, so the binding is shared through a
+// pointer for the resolver to fill in.
+type Binding struct {
+	Depth int
+	Slot  int
+}
+
+func newBinding() *Binding {
+	return &Binding{Depth: -1}
 }
 
 type Visitor[R any] interface {
@@ -21,9 +49,16 @@ type Visitor[R any] interface {
 	VisitGetExpr(expr Get) (R, error)
 	VisitSetExpr(expr Set) (R, error)
 	VisitThisExpr(expr This) (R, error)
+	VisitSuperExpr(expr Super) (R, error)
+	VisitLambdaExpr(expr Lambda) (R, error)
+	VisitListExpr(expr List) (R, error)
+	VisitSubscriptExpr(expr Subscript) (R, error)
+	VisitSetSubscriptExpr(expr SetSubscript) (R, error)
+	VisitMapExpr(expr Map) (R, error)
 }
 
 type Binary struct {
+	Node
 	Left     Expr
 	Operator token.Token
 	Right    Expr
@@ -38,6 +73,7 @@ func (b Binary) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Grouping struct {
+	Node
 	Expression Expr
 }
 
@@ -50,6 +86,7 @@ func (g Grouping) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Literal struct {
+	Node
 	Value any
 }
 
@@ -62,6 +99,7 @@ func (l Literal) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Logical struct {
+	Node
 	Left     Expr
 	Operator token.Token
 	Right    Expr
@@ -76,6 +114,7 @@ func (l Logical) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Unary struct {
+	Node
 	Operator token.Token
 	Right    Expr
 }
@@ -89,6 +128,7 @@ func (u Unary) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Ternary struct {
+	Node
 	Condition Expr
 	Operator1 token.Token
 	Left      Expr
@@ -105,11 +145,13 @@ func (t Ternary) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Variable struct {
-	Name token.Token
+	Node
+	Name    token.Token
+	Binding *Binding
 }
 
 func NewVariable(name token.Token) *Variable {
-	return &Variable{Name: name}
+	return &Variable{Name: name, Binding: newBinding()}
 }
 
 func (v Variable) Accept(visitor Visitor[any]) (any, error) {
@@ -117,12 +159,14 @@ func (v Variable) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Assign struct {
-	Name  token.Token
-	Value Expr
+	Node
+	Name    token.Token
+	Value   Expr
+	Binding *Binding
 }
 
 func NewAssign(name token.Token, value Expr) *Assign {
-	return &Assign{Name: name, Value: value}
+	return &Assign{Name: name, Value: value, Binding: newBinding()}
 }
 
 func (a Assign) Accept(visitor Visitor[any]) (any, error) {
@@ -130,6 +174,7 @@ func (a Assign) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Call struct {
+	Node
 	Callee    Expr
 	Paren     token.Token
 	Arguments []Expr
@@ -144,6 +189,7 @@ func (c Call) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Get struct {
+	Node
 	Object Expr
 	Name token.Token
 }
@@ -157,6 +203,7 @@ func (g Get) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type Set struct {
+	Node
 	Object Expr
 	Name token.Token
 	Value Expr
@@ -171,13 +218,109 @@ func (s Set) Accept(visitor Visitor[any]) (any, error) {
 }
 
 type This struct {
+	Node
 	Keyword token.Token
+	Binding *Binding
 }
 
 func NewThis(keyword token.Token) *This {
-	return &This{Keyword: keyword}
+	return &This{Keyword: keyword, Binding: newBinding()}
 }
 
 func (t This) Accept(visitor Visitor[any]) (any, error) {
 	return visitor.VisitThisExpr(t)
+}
+
+// Binding locates "super"; "this" is always in slot 0 one scope further in
+type Super struct {
+	Node
+	Keyword token.Token
+	Method  token.Token
+	Binding *Binding
+}
+
+func NewSuper(keyword token.Token, method token.Token) *Super {
+	return &Super{Keyword: keyword, Method: method, Binding: newBinding()}
+}
+
+func (s Super) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitSuperExpr(s)
+}
+
+// Body holds a []stmt.Stmt, but is left untyped since the stmt package
+// already depends on this one
+type Lambda struct {
+	Node
+	Keyword token.Token
+	Params  []token.Token
+	Body    any
+}
+
+func NewLambda(keyword token.Token, params []token.Token, body any) *Lambda {
+	return &Lambda{Keyword: keyword, Params: params, Body: body}
+}
+
+func (l Lambda) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitLambdaExpr(l)
+}
+
+type List struct {
+	Node
+	Bracket  token.Token
+	Elements []Expr
+}
+
+func NewList(bracket token.Token, elements []Expr) *List {
+	return &List{Bracket: bracket, Elements: elements}
+}
+
+func (l List) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitListExpr(l)
+}
+
+type Subscript struct {
+	Node
+	Object  Expr
+	Bracket token.Token
+	Index   Expr
+}
+
+func NewSubscript(object Expr, bracket token.Token, index Expr) *Subscript {
+	return &Subscript{Object: object, Bracket: bracket, Index: index}
+}
+
+func (s Subscript) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitSubscriptExpr(s)
+}
+
+type SetSubscript struct {
+	Node
+	Object  Expr
+	Bracket token.Token
+	Index   Expr
+	Value   Expr
+}
+
+func NewSetSubscript(object Expr, bracket token.Token, index Expr, value Expr) *SetSubscript {
+	return &SetSubscript{Object: object, Bracket: bracket, Index: index, Value: value}
+}
+
+func (s SetSubscript) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitSetSubscriptExpr(s)
+}
+
+// Keys[i] maps to Values[i]
+type Map struct {
+	Node
+	Brace  token.Token
+	Keys   []Expr
+	Values []Expr
+}
+
+func NewMap(brace token.Token, keys []Expr, values []Expr) *Map {
+	return &Map{Brace: brace, Keys: keys, Values: values}
+}
+
+func (m Map) Accept(visitor Visitor[any]) (any, error) {
+	return visitor.VisitMapExpr(m)
 }
\ No newline at end of file
@@ -0,0 +1,45 @@
+// Package framing reads and writes messages framed by a Content-Length
+// header, as the Language Server Protocol and the Debug Adapter Protocol both
+// send them.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// Messages longer than this are refused rather than read into memory
+const MaxLength = 64 << 20
+
+// Reads the body of the next message
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 || length > MaxLength {
+		return nil, fmt.Errorf("bad Content-Length header: %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Writes msg as the JSON body of a message
+func Write(w io.Writer, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
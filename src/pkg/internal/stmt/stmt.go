@@ -7,6 +7,7 @@ import (
 
 type Stmt interface {
 	Accept(visitor Visitor[any]) error
+	Span() token.Span
 }
 
 type Visitor[R any] interface {
@@ -21,9 +22,13 @@ type Visitor[R any] interface {
 	VisitFunctionStmt(stmt Function) error
 	VisitReturnStmt(stmt Return) error
 	VisitClassStmt(stmt Class) error
+	VisitImportStmt(stmt Import) error
+	VisitThrowStmt(stmt Throw) error
+	VisitTryStmt(stmt Try) error
 }
 
 type Expression struct {
+	ast.Node
 	Expr ast.Expr
 }
 
@@ -36,6 +41,7 @@ func (e Expression) Accept(visitor Visitor[any]) error {
 }
 
 type Print struct {
+	ast.Node
 	Expr ast.Expr
 }
 
@@ -48,6 +54,7 @@ func (p Print) Accept(visitor Visitor[any]) error {
 }
 
 type Var struct {
+	ast.Node
 	Name token.Token
 	Initializer ast.Expr
 }
@@ -61,6 +68,7 @@ func (v Var) Accept(visitor Visitor[any]) error {
 }
 
 type Block struct {
+	ast.Node
 	Statements []Stmt
 }
 
@@ -73,6 +81,7 @@ func (b Block) Accept(visitor Visitor[any]) error {
 }
 
 type If struct {
+	ast.Node
 	Condition ast.Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
@@ -86,14 +95,18 @@ func (i If) Accept(visitor Visitor[any]) error {
 	return visitor.VisitIfStmt(i)
 }
 
+// For-loops are parsed into a While, inside a Block holding the initializer
+// if there is one. Keyword tells the two apart.
 type While struct {
+	ast.Node
+	Keyword token.Token // 'while' or 'for'
 	Condition ast.Expr
 	Body Stmt
 	Increment ast.Expr // optional, for for-loops
 }
 
-func NewWhile(condition ast.Expr) *While {
-	return &While{Condition: condition}
+func NewWhile(keyword token.Token, condition ast.Expr) *While {
+	return &While{Keyword: keyword, Condition: condition}
 }
 
 func (w *While) WithBody(body Stmt) *While {
@@ -111,6 +124,7 @@ func (w *While) Accept(visitor Visitor[any]) error {
 }
 
 type Break struct {
+	ast.Node
 	Loop *While
 }
 
@@ -123,6 +137,7 @@ func (b Break) Accept(visitor Visitor[any]) error {
 }
 
 type Continue struct {
+	ast.Node
 	Loop *While
 }
 
@@ -135,6 +150,7 @@ func (c Continue) Accept(visitor Visitor[any]) error {
 }
 
 type Function struct {
+	ast.Node
 	Name token.Token
 	Params []token.Token
 	Body []Stmt
@@ -149,6 +165,7 @@ func (f Function) Accept(visitor Visitor[any]) error {
 }
 
 type Return struct {
+	ast.Node
 	Keyword token.Token
 	Value ast.Expr
 }
@@ -162,14 +179,66 @@ func (r Return) Accept(visitor Visitor[any]) error {
 }
 
 type Class struct {
+	ast.Node
 	Name token.Token
+	Superclass *ast.Variable // nil if the class has no superclass
 	Methods []Function
 }
 
-func NewClass(name token.Token, methods []Function) *Class {
-	return &Class{Name: name, Methods: methods}
+func NewClass(name token.Token, superclass *ast.Variable, methods []Function) *Class {
+	return &Class{Name: name, Superclass: superclass, Methods: methods}
 }
 
 func (c Class) Accept(visitor Visitor[any]) error {
 	return visitor.VisitClassStmt(c)
+}
+
+// Either binds the whole module to Alias (import "path" as alias;)
+// or binds each of Names from it (from "path" import a, b;)
+type Import struct {
+	ast.Node
+	Keyword token.Token
+	Path token.Token
+	Alias token.Token
+	Names []token.Token
+}
+
+func NewImport(keyword token.Token, path token.Token, alias token.Token, names []token.Token) *Import {
+	return &Import{Keyword: keyword, Path: path, Alias: alias, Names: names}
+}
+
+func (i Import) Accept(visitor Visitor[any]) error {
+	return visitor.VisitImportStmt(i)
+}
+
+type Throw struct {
+	ast.Node
+	Keyword token.Token
+	Value ast.Expr
+}
+
+func NewThrow(keyword token.Token, value ast.Expr) *Throw {
+	return &Throw{Keyword: keyword, Value: value}
+}
+
+func (t Throw) Accept(visitor Visitor[any]) error {
+	return visitor.VisitThrowStmt(t)
+}
+
+// Catch and Finally are nil when the clause is absent, but at least one is present
+type Try struct {
+	ast.Node
+	Keyword token.Token
+	Body *Block
+	CatchName token.Token
+	Catch *Block
+	Finally *Block
+}
+
+func NewTry(keyword token.Token, body *Block, catchName token.Token, catch *Block, finally *Block) *Try {
+	return &Try{Keyword: keyword, Body: body, CatchName: catchName, Catch: catch, Finally: finally}
+}
+
+func (t Try) Accept(visitor Visitor[any]) error {
+	return visitor.VisitTryStmt(t)
 }
\ No newline at end of file
@@ -77,6 +77,41 @@ func (a AstPrinter) VisitThisExpr(expr ast.This) (any, error) {
 	return fmt.Sprintf("this.%s", expr.Keyword.Lexeme), nil
 }
 
+func (a AstPrinter) VisitSuperExpr(expr ast.Super) (any, error) {
+	return fmt.Sprintf("super.%s", expr.Method.Lexeme), nil
+}
+
+func (a AstPrinter) VisitLambdaExpr(expr ast.Lambda) (any, error) {
+	params := ""
+	for i, param := range expr.Params {
+		if i > 0 {
+			params += " "
+		}
+		params += param.Lexeme
+	}
+	return "(fun (" + params + "))", nil
+}
+
+func (a AstPrinter) VisitListExpr(expr ast.List) (any, error) {
+	return a.parenthesize("list", expr.Elements...)
+}
+
+func (a AstPrinter) VisitSubscriptExpr(expr ast.Subscript) (any, error) {
+	return a.parenthesize("index", expr.Object, expr.Index)
+}
+
+func (a AstPrinter) VisitSetSubscriptExpr(expr ast.SetSubscript) (any, error) {
+	return a.parenthesize("set index", expr.Object, expr.Index, expr.Value)
+}
+
+func (a AstPrinter) VisitMapExpr(expr ast.Map) (any, error) {
+	entries := []ast.Expr{}
+	for i := range expr.Keys {
+		entries = append(entries, expr.Keys[i], expr.Values[i])
+	}
+	return a.parenthesize("map", entries...)
+}
+
 func (a AstPrinter) parenthesize(name string, exprs ...ast.Expr) (string, error) {
 	str := "(" + name
 	for _, expr := range exprs {
@@ -0,0 +1,93 @@
+package interpreter
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Defines the assertion natives used by Lox test files. A failed assertion
+// is an ordinary runtime error at the call site.
+func defineAssertions(env *Env) {
+	env.Define("assertEqual", NewNativeFn("assertEqual", 2, func(ip *Interpreter, arguments []any) (any, error) {
+		actual, expected := arguments[0], arguments[1]
+		if !equalValues(actual, expected, make(map[[2]any]bool)) {
+			return nil, errors.New("Assertion failed: expected " + describe(expected) + " but got " + describe(actual) + ".")
+		}
+		return nil, nil
+	}))
+	env.Define("assertTrue", NewNativeFn("assertTrue", 1, func(ip *Interpreter, arguments []any) (any, error) {
+		if !IsTruthy(arguments[0]) {
+			return nil, errors.New("Assertion failed: expected a truthy value but got " + describe(arguments[0]) + ".")
+		}
+		return nil, nil
+	}))
+	// Calls fn with no arguments and returns what it threw, so the test can
+	// inspect it
+	env.Define("assertThrows", NewNativeFn("assertThrows", 1, func(ip *Interpreter, arguments []any) (any, error) {
+		fn, ok := arguments[0].(Callable)
+		if !ok || fn.Arity() != 0 {
+			return nil, errors.New("assertThrows expects a function with no parameters.")
+		}
+
+		_, err := fn.Call(ip, []any{})
+		if err == nil {
+			return nil, errors.New("Assertion failed: expected " + describe(fn) + " to throw.")
+		}
+		if caught, ok := CaughtValue(err); ok {
+			return caught, nil
+		}
+		return nil, err
+	}))
+}
+
+// Compares values the way == does, except that lists and maps are equal
+// when their contents are. seen holds the pairs being compared around
+// these, so lists and maps that contain themselves compare as equal.
+func equalValues(a any, b any, seen map[[2]any]bool) bool {
+	switch a := a.(type) {
+	case *List:
+		other, ok := b.(*List)
+		if !ok || a.Len() != other.Len() {
+			return false
+		}
+		pair := [2]any{a, other}
+		if a == other || seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		for i, element := range a.elements {
+			if !equalValues(element, other.elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		other, ok := b.(*Map)
+		if !ok || a.Len() != other.Len() {
+			return false
+		}
+		pair := [2]any{a, other}
+		if a == other || seen[pair] {
+			return true
+		}
+		seen[pair] = true
+		// Insertion order doesn't matter
+		for _, key := range a.keys {
+			value, exists := other.entries[key]
+			if !exists || !equalValues(a.entries[key], value, seen) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return IsEqual(a, b)
+}
+
+// Like Stringify, but quotes strings so "1" and 1 can be told apart
+func describe(value any) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return Stringify(value)
+}
@@ -0,0 +1,44 @@
+package interpreter
+
+import (
+	"io"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// Recursive calls exercise local lookups, environment creation and global
+// lookups of the function itself
+func BenchmarkFib(b *testing.B) {
+	script := `
+fun fib(n) {
+	if (n < 2) return n;
+	return fib(n - 1) + fib(n - 2);
+}
+fib(30);
+`
+	tokens, err := scanner.NewScanner(script).ScanTokens()
+	if err != nil {
+		b.Fatalf("Failed to scan tokens: %v", err)
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		b.Fatalf("Failed to parse statements: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ip := NewInterpreter(WithOutput(io.Discard), WithDiagnostics(io.Discard))
+		_, err = NewResolver(ip).ResolveStmts(statements)
+		if err != nil {
+			b.Fatalf("Failed to resolve statements: %v", err)
+		}
+
+		err = ip.Interpret(statements)
+		if err != nil {
+			b.Fatalf("Failed to run: %v", err)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/lidanielm/glox/src/pkg/internal/ast"
 	"github.com/lidanielm/glox/src/pkg/internal/stmt"
 	"github.com/lidanielm/glox/src/pkg/lox_error"
-	"github.com/lidanielm/glox/src/pkg/token"
 )
 
 type Callable interface {
@@ -26,11 +29,20 @@ const (
 type Function struct {
 	declaration stmt.Function
 	closure *Env
+	owner *Interpreter // interpreter of the file that declared the function
+	class string // name of the class declaring this method, if it is one
 	isInitializer bool
+	isAnonymous bool
 }
 
-func NewFunction(declaration stmt.Function, closure *Env, isInitializer bool) *Function {
-	return &Function{declaration: declaration, closure: closure, isInitializer: isInitializer}
+func NewFunction(declaration stmt.Function, closure *Env, owner *Interpreter, isInitializer bool) *Function {
+	return &Function{declaration: declaration, closure: closure, owner: owner, isInitializer: isInitializer}
+}
+
+// Lambdas are named after their 'fun' keyword so errors still have a line to point at
+func NewLambda(lambda ast.Lambda, closure *Env, owner *Interpreter) *Function {
+	declaration := stmt.NewFunction(lambda.Keyword, lambda.Params, lambda.Body.([]stmt.Stmt))
+	return &Function{declaration: *declaration, closure: closure, owner: owner, isAnonymous: true}
 }
 
 func (f *Function) Arity() int {
@@ -38,7 +50,10 @@ func (f *Function) Arity() int {
 }
 
 func (f *Function) Call(ip *Interpreter, arguments []any) (any, error) {
-	env := NewEnv().WithParent(f.closure)
+	// A function imported from a module runs against that module's globals
+	ip = f.owner
+
+	env := newScope(f.closure)
 	for i, param := range f.declaration.Params {
 		env.Define(param.Lexeme, arguments[i])
 	}
@@ -47,24 +62,83 @@ func (f *Function) Call(ip *Interpreter, arguments []any) (any, error) {
 	if err != nil {
 		if returnError, ok := err.(lox_error.ReturnError); ok {
 			if f.isInitializer {
-				return f.closure.GetAt(0, *token.NewToken(token.THIS, "this", nil, 0))
+				return f.closure.GetAt(0, 0), nil
 			}
 			return returnError.Value, nil
 		}
+		if path := f.owner.modulePath(); path != "" {
+			err = lox_error.InModule(err, path)
+		}
 		return nil, err
 	}
 
+	if f.isInitializer {
+		return f.closure.GetAt(0, 0), nil
+	}
+
 	return nil, nil
 }
 
+// Names the function as it appears in stack traces, e.g. "Point.init"
+func (f *Function) Name() string {
+	if f.isAnonymous {
+		return "anonymous"
+	}
+	if f.class != "" {
+		return f.class + "." + f.declaration.Name.Lexeme
+	}
+	return f.declaration.Name.Lexeme
+}
+
 func (f *Function) String() string {
+	if f.isAnonymous {
+		return "<fn anonymous>"
+	}
 	return fmt.Sprintf("<fn %s>", f.declaration.Name.Lexeme)
 }
 
 func (f *Function) Bind(instance *Instance) *Function {
-	env := NewEnv().WithParent(f.closure)
+	env := newScope(f.closure)
 	env.Define("this", instance)
-	return NewFunction(f.declaration, env, f.isInitializer)
+	return &Function{declaration: f.declaration, closure: env, owner: f.owner, class: f.class, isInitializer: f.isInitializer, isAnonymous: f.isAnonymous}
+}
+
+// Defines the native functions available in every interpreter
+func defineNatives(env *Env) {
+	env.Define("clock", &ClockFn{})
+	env.Define("readLine", NewNativeFn("readLine", 0, func(ip *Interpreter, arguments []any) (any, error) {
+		return ip.readLine()
+	}))
+	env.Define("input", NewNativeFn("input", 1, func(ip *Interpreter, arguments []any) (any, error) {
+		fmt.Fprint(ip.stdout, Stringify(arguments[0]))
+		return ip.readLine()
+	}))
+	defineAssertions(env)
+}
+
+// Returns the names of the natives every program can call, in order
+func Natives() []string {
+	env := NewEnv()
+	defineNatives(env)
+	names := make([]string, 0, len(env.values))
+	for name := range env.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reads a line without its line ending, or nil at the end of input
+func (ip *Interpreter) readLine() (any, error) {
+	line, err := ip.stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
 }
 
 type ClockFn struct{}
@@ -79,4 +153,28 @@ func (c *ClockFn) Call(ip *Interpreter, arguments []any) (any, error) {
 
 func (c *ClockFn) String() string {
 	return "<native fn>"
+}
+
+// NativeFn wraps a Go function so it can be called from Lox, e.g. the
+// built-in methods on lists. Returned errors are reported at the call site.
+type NativeFn struct {
+	name string
+	arity int
+	fn func(ip *Interpreter, arguments []any) (any, error)
+}
+
+func NewNativeFn(name string, arity int, fn func(ip *Interpreter, arguments []any) (any, error)) *NativeFn {
+	return &NativeFn{name: name, arity: arity, fn: fn}
+}
+
+func (n *NativeFn) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFn) Call(ip *Interpreter, arguments []any) (any, error) {
+	return n.fn(ip, arguments)
+}
+
+func (n *NativeFn) String() string {
+	return "<native fn " + n.name + ">"
 }
\ No newline at end of file
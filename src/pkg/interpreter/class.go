@@ -10,6 +10,7 @@ type ClassType int
 const (
 	NONE_CLASS ClassType = iota
 	CLASS
+	SUBCLASS
 )
 
 type IClass interface {
@@ -18,11 +19,12 @@ type IClass interface {
 
 type Class struct {
 	name string
+	superclass *Class
 	methods map[string]*Function
 }
 
-func NewClass(name string, methods map[string]*Function) *Class {
-	return &Class{name: name, methods: methods}
+func NewClass(name string, superclass *Class, methods map[string]*Function) *Class {
+	return &Class{name: name, superclass: superclass, methods: methods}
 }
 
 func (c *Class) String() string {
@@ -30,7 +32,7 @@ func (c *Class) String() string {
 }
 
 func (c *Class) Arity() int {
-	initializer, err := c.FindMethod(c.name)
+	initializer, err := c.FindMethod("init")
 	if err != nil {
 		return 0;
 	}
@@ -39,10 +41,18 @@ func (c *Class) Arity() int {
 }
 
 func (c *Class) Call(ip *Interpreter, arguments []any) (any, error) {
+	err := ip.limits.allocate()
+	if err != nil {
+		return nil, err
+	}
+
 	instance := NewInstance(c)
 	initializer, err := instance.FindMethod("init")
 	if err == nil {
-		initializer.Bind(instance).Call(ip, arguments)
+		_, err = initializer.Bind(instance).Call(ip, arguments)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return instance, nil
 }
@@ -51,11 +61,16 @@ func (c *Class) AddMethod(name string, method *Function) {
 	c.methods[name] = method
 }
 
+// Looks up a method on this class, then walks up the superclass chain
 func (c *Class) FindMethod(name string) (*Function, error) {
 	fn, exists := c.methods[name]
-	if !exists {
-		return nil, lox_error.NewRuntimeError(token.Token{}, "Undefined method '"+name+"' for class '"+c.String()+"'.")
+	if exists {
+		return fn, nil
 	}
 
-	return fn, nil
-}
\ No newline at end of file
+	if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	}
+
+	return nil, lox_error.NewRuntimeError(token.Token{}, "Undefined method '"+name+"' for class '"+c.String()+"'.")
+}
@@ -0,0 +1,248 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+	"github.com/lidanielm/glox/src/pkg/vm"
+)
+
+// Expectations are comments in the test scripts, following the Crafting
+// Interpreters test suite:
+//
+//	print 1 + 2; // expect: 3
+//	print nil.x; // expect runtime error: Only instances have properties.
+//	var = 1;     // Error at '=': Expect variable name.
+//	// [line 7] Error at end: Expect '}' after block.
+var (
+	expectOutput = regexp.MustCompile(`// expect: ?(.*)`)
+	expectRuntimeError = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectError = regexp.MustCompile(`// (\[line (\d+)\] )?(Error.*)`)
+)
+
+type expectations struct {
+	output []string
+	errors []string // compile errors, formatted by compileError
+	runtimeError string // formatted by runtimeError
+}
+
+func parseExpectations(source string) expectations {
+	var expect expectations
+	for i, line := range strings.Split(source, "\n") {
+		if match := expectOutput.FindStringSubmatch(line); match != nil {
+			expect.output = append(expect.output, match[1])
+		} else if match := expectRuntimeError.FindStringSubmatch(line); match != nil {
+			expect.runtimeError = fmt.Sprintf("[line %d] %s", i + 1, match[1])
+		} else if match := expectError.FindStringSubmatch(line); match != nil {
+			lineNumber := i + 1
+			if match[2] != "" {
+				lineNumber, _ = strconv.Atoi(match[2])
+			}
+			expect.errors = append(expect.errors, fmt.Sprintf("[line %d] %s", lineNumber, match[3]))
+		}
+	}
+	return expect
+}
+
+// Formats a syntax or resolution error the way the expectations spell it
+func compileError(err error) string {
+	switch err := err.(type) {
+	case *lox_error.LoxError:
+		return fmt.Sprintf("[line %d] Error%s", err.Token.Line, err.Message)
+	case *lox_error.ParseError:
+		return fmt.Sprintf("[line %d] Error%s: %s", err.Token.Line, where(err.Token), err.Message)
+	}
+	return err.Error()
+}
+
+func where(tok token.Token) string {
+	if tok.Type == token.EOF {
+		return " at end"
+	}
+	return " at '" + tok.Lexeme + "'"
+}
+
+func runtimeError(err error) string {
+	switch err := err.(type) {
+	case *lox_error.RuntimeError:
+		return fmt.Sprintf("[line %d] %s", err.Token.Line, err.Message)
+	case lox_error.ThrowError:
+		return fmt.Sprintf("[line %d] Uncaught exception: %s", err.Token.Line, interpreter.Stringify(err.Value))
+	}
+	return err.Error()
+}
+
+// backend runs resolved programs: an *interpreter.Interpreter or a *vm.VM
+type backend interface {
+	SetPath(path string) error
+	SetSource(source string)
+	Interpret(statements []stmt.Stmt) error
+}
+
+// resolving resolves programs before interpreting them, as glox does for
+// the tree-walker. The VM resolves in Interpret.
+type resolving struct {
+	*interpreter.Interpreter
+	ctx context.Context // nil to run without a deadline
+}
+
+func (r resolving) Interpret(statements []stmt.Stmt) error {
+	_, err := interpreter.NewResolver(r.Interpreter).ResolveStmts(statements)
+	if err != nil {
+		return err
+	}
+	if r.ctx == nil {
+		return r.Interpreter.Interpret(statements)
+	}
+	return r.Interpreter.InterpretContext(r.ctx, statements)
+}
+
+// streams are where a backend writes and reads. Output and diagnostics are
+// discarded and input is empty unless they're given.
+type streams struct {
+	output io.Writer
+	diagnostics io.Writer
+	input io.Reader
+	warnings func(err error) // nil to write warnings with the diagnostics
+}
+
+func (s streams) withDefaults() streams {
+	if s.output == nil {
+		s.output = io.Discard
+	}
+	if s.diagnostics == nil {
+		s.diagnostics = io.Discard
+	}
+	if s.input == nil {
+		s.input = strings.NewReader("")
+	}
+	return s
+}
+
+// Every script is run on both backends
+var backends = []struct {
+	name string
+	newBackend func(s streams) backend
+}{
+	{"interpreter", func(s streams) backend {
+		s = s.withDefaults()
+		options := []interpreter.Option{interpreter.WithOutput(s.output), interpreter.WithDiagnostics(s.diagnostics), interpreter.WithInput(s.input)}
+		if s.warnings != nil {
+			options = append(options, interpreter.WithWarnings(s.warnings))
+		}
+		return resolving{Interpreter: interpreter.NewInterpreter(options...)}
+	}},
+	{"vm", func(s streams) backend {
+		s = s.withDefaults()
+		options := []vm.Option{vm.WithOutput(s.output), vm.WithDiagnostics(s.diagnostics), vm.WithInput(s.input)}
+		if s.warnings != nil {
+			options = append(options, vm.WithWarnings(s.warnings))
+		}
+		return vm.New(options...)
+	}},
+}
+
+// Runs source as glox would, with imports relative to path if it isn't
+// empty, returning the error it stopped with
+func interpret(b backend, path string, source string) error {
+	b.SetSource(source)
+	err := b.SetPath(path)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		return err
+	}
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return err
+	}
+	return b.Interpret(statements)
+}
+
+// Runs a script, returning what it printed and the errors it reported in the
+// same form as the expectations
+func runScript(newBackend func(s streams) backend, path string, source string) expectations {
+	var actual expectations
+	var output bytes.Buffer
+	err := interpret(newBackend(streams{output: &output}), path, source)
+	if output.Len() > 0 {
+		actual.output = strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	}
+
+	switch err.(type) {
+	case nil:
+	case *lox_error.RuntimeError, lox_error.ThrowError, *lox_error.InterruptError:
+		actual.runtimeError = runtimeError(err)
+	case lox_error.ErrorList:
+		for _, err := range err.(lox_error.ErrorList) {
+			actual.errors = append(actual.errors, compileError(err))
+		}
+	default:
+		actual.errors = []string{compileError(err)}
+	}
+	return actual
+}
+
+func TestConformance(t *testing.T) {
+	err := filepath.WalkDir("testdata", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".lox" {
+			return err
+		}
+
+		name := strings.TrimSuffix(filepath.ToSlash(path[len("testdata/"):]), ".lox")
+		for _, b := range backends {
+			t.Run(b.name + "/" + name, func(t *testing.T) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expect := parseExpectations(string(data))
+				actual := runScript(b.newBackend, path, string(data))
+
+				diff(t, "output", expect.output, actual.output)
+				diff(t, "error", expect.errors, actual.errors)
+				if expect.runtimeError != actual.runtimeError {
+					t.Errorf("runtime error:\n\texpected: %q\n\tactual:   %q", expect.runtimeError, actual.runtimeError)
+				}
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reports each line that differs between the expected and actual lines
+func diff(t *testing.T, kind string, expected []string, actual []string) {
+	t.Helper()
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			t.Errorf("missing %s %d: %q", kind, i + 1, expected[i])
+		case i >= len(expected):
+			t.Errorf("unexpected %s %d: %q", kind, i + 1, actual[i])
+		case expected[i] != actual[i]:
+			t.Errorf("%s %d:\n\texpected: %q\n\tactual:   %q", kind, i + 1, expected[i], actual[i])
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// Debugger is told before each statement runs, other than blocks. It pauses
+// the program by not returning until it should go on, and can inspect it in
+// the meantime through the Pause. Returning an error stops the program.
+//
+// Before is called on the goroutine running the program, and the Pause can
+// only be used from there.
+type Debugger interface {
+	Before(pause *Pause) error
+}
+
+// Calls d before each statement, including those of imported modules
+func WithDebugger(d Debugger) Option {
+	return func(ip *Interpreter) {
+		ip.debugger = d
+	}
+}
+
+// Pause is a program stopped before running a statement
+type Pause struct {
+	ip *Interpreter
+	Path string // of the file the statement is in, "" if it has none
+	Line int
+	Depth int // how many calls are in progress
+}
+
+func (ip *Interpreter) pause(s stmt.Stmt) error {
+	switch s.(type) {
+	case stmt.Block, *stmt.Block:
+		// Stop at the statements inside instead
+		return nil
+	}
+
+	return ip.debugger.Before(&Pause{ip: ip, Path: ip.path, Line: s.Span().Line, Depth: len(ip.calls.frames)})
+}
+
+// StackFrame is a call in progress, or the top level of the script
+type StackFrame struct {
+	Function string
+	Path string
+	Line int // of the statement running in it
+	ip *Interpreter
+	env *Env
+}
+
+// Variable is a named value shown by a debugger
+type Variable struct {
+	Name string
+	Value any
+}
+
+// Returns the calls in progress, innermost first, ending with the script
+func (p *Pause) Stack() []StackFrame {
+	frames := p.ip.calls.frames
+	stack := make([]StackFrame, 0, len(frames) + 1)
+	current := StackFrame{Path: p.Path, Line: p.Line, ip: p.ip, env: p.ip.env}
+	for i := len(frames) - 1; i >= 0; i-- {
+		current.Function = frames[i].function
+		stack = append(stack, current)
+		// The caller is paused at the call
+		current = StackFrame{Path: frames[i].caller.path, Line: frames[i].call.Line, ip: frames[i].caller, env: frames[i].env}
+	}
+	current.Function = "<script>"
+	return append(stack, current)
+}
+
+// Returns the local variables visible in the frame, innermost first. A
+// variable shadowed by an inner one isn't included.
+func (f StackFrame) Locals() []Variable {
+	locals := []Variable{}
+	seen := make(map[string]bool)
+	for env := f.env; env != nil && env.values == nil; env = env.parent {
+		// Later slots shadow earlier ones with the same name
+		for i := len(env.slots) - 1; i >= 0; i-- {
+			name := env.slots[i].name
+			if !seen[name] {
+				seen[name] = true
+				locals = append(locals, Variable{Name: name, Value: env.slots[i].value})
+			}
+		}
+	}
+	return locals
+}
+
+// Returns the global variables of the frame's file, sorted by name
+func (f StackFrame) Globals() []Variable {
+	return sortedVariables(f.ip.Globals())
+}
+
+// Evaluates an expression as if it appeared in the frame's code. Assigning
+// to a variable changes it in the paused program.
+func (f StackFrame) Evaluate(source string) (any, error) {
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+	statements, err := parser.NewParser(tokens).ParseInteractive()
+	if err != nil {
+		return nil, err
+	}
+
+	var expression *stmt.Expression
+	if len(statements) == 1 {
+		// ParseInteractive prints a final expression; take it back out
+		if print, ok := statements[0].(*stmt.Print); ok {
+			expression = stmt.NewExpression(print.Expr)
+		}
+	}
+	if expression == nil {
+		return nil, errors.New("Expect an expression.")
+	}
+
+	// The locals are copied into a scope in front of the globals, where the
+	// expression finds them by name, then copied back after
+	ip := f.ip
+	scope := NewEnv().WithParent(ip.globals)
+	locals := f.Locals()
+	for _, local := range locals {
+		scope.Define(local.Name, local.Value)
+	}
+
+	resolver := NewResolver(ip)
+	for _, local := range locals {
+		// Let the expression use this and super if the frame's code can
+		if local.Name == "this" && resolver.currClass == NONE_CLASS {
+			resolver.currClass = CLASS
+		} else if local.Name == "super" {
+			resolver.currClass = SUBCLASS
+		}
+	}
+	_, err = resolver.ResolveStmts([]stmt.Stmt{expression})
+	if err != nil {
+		return nil, err
+	}
+
+	globals, env := ip.globals, ip.env
+	ip.globals, ip.env = scope, scope
+	value, err := ip.evaluate(expression.Expr)
+	ip.globals, ip.env = globals, env
+
+	for _, local := range locals {
+		if scope.values[local.Name] != local.Value {
+			f.assign(local.Name, scope.values[local.Name])
+		}
+	}
+	if err != nil {
+		if throw, ok := err.(lox_error.ThrowError); ok {
+			return nil, fmt.Errorf("Uncaught exception: %s", Stringify(throw.Value))
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// Sets the innermost local with the given name
+func (f StackFrame) assign(name string, value any) {
+	for env := f.env; env != nil && env.values == nil; env = env.parent {
+		for i := len(env.slots) - 1; i >= 0; i-- {
+			if env.slots[i].name == name {
+				env.slots[i].value = value
+				return
+			}
+		}
+	}
+}
+
+// Returns what a debugger can expand a value into: the fields of an
+// instance, the elements of a list or the entries of a map. Other values
+// have none.
+func Members(value any) []Variable {
+	switch value := value.(type) {
+	case *Instance:
+		return sortedVariables(value.fields)
+	case *List:
+		members := make([]Variable, value.Len())
+		for i, element := range value.Elements() {
+			members[i] = Variable{Name: fmt.Sprintf("[%d]", i), Value: element}
+		}
+		return members
+	case *Map:
+		members := make([]Variable, 0, value.Len())
+		for _, key := range value.Keys() {
+			element, _ := value.Lookup(key)
+			name := Stringify(key)
+			if _, ok := key.(string); ok {
+				name = fmt.Sprintf("%q", key)
+			}
+			members = append(members, Variable{Name: name, Value: element})
+		}
+		return members
+	}
+	return nil
+}
+
+func sortedVariables(values map[string]any) []Variable {
+	variables := make([]Variable, 0, len(values))
+	for name, value := range values {
+		variables = append(variables, Variable{Name: name, Value: value})
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables
+}
@@ -5,22 +5,49 @@ import (
 	"github.com/lidanielm/glox/src/pkg/token"
 )
 
+// Globals are looked up by name, since they can be defined after the code
+// using them is resolved. Locals live in slots numbered by the resolver in
+// the order they are declared, so a scope's declarations always run in slot
+// order.
 type Env struct {
 	parent *Env           // enclosing environment
-	values map[string]any // variable-value map
+	values map[string]any // global variable-value map, nil in local scopes
+	slots  []slot         // local variables
 }
 
+// A local variable keeps its name so a debugger can show it
+type slot struct {
+	name  string
+	value any
+}
+
+// Creates a global scope
 func NewEnv() *Env {
 	values := make(map[string]any)
 	return &Env{values: values}
 }
 
+// Creates a global scope holding values, which stays shared with the caller
+func NewEnvOf(values map[string]any) *Env {
+	return &Env{values: values}
+}
+
+// Creates a local scope inside parent
+func newScope(parent *Env) *Env {
+	return &Env{parent: parent}
+}
+
 func (e *Env) WithParent(parent *Env) *Env {
 	e.parent = parent
 	return e
 }
 
+// Defines a global by name, or the next slot of a local scope
 func (e *Env) Define(name string, value any) {
+	if e.values == nil {
+		e.slots = append(e.slots, slot{name: name, value: value})
+		return
+	}
 	e.values[name] = value
 }
 
@@ -38,13 +65,8 @@ func (e *Env) Get(name token.Token) (any, error) {
 	return e.parent.Get(name)
 }
 
-func (e *Env) GetAt(distance int, name token.Token) (any, error) {
-	value, exists := e.ancestor(distance).values[name.Lexeme]
-	if exists {
-		return value, nil
-	} else {
-		return nil, lox_error.NewError(name, "Undefined variable '"+name.Lexeme+"'.")
-	}
+func (e *Env) GetAt(distance int, slot int) any {
+	return e.ancestor(distance).slots[slot].value
 }
 
 func (e *Env) Assign(name token.Token, value any) error {
@@ -63,9 +85,8 @@ func (e *Env) Assign(name token.Token, value any) error {
 	return e.parent.Assign(name, value)
 }
 
-func (e *Env) AssignAt(distance int, name token.Token, value any) error {
-	e.ancestor(distance).values[name.Lexeme] = value
-	return nil
+func (e *Env) AssignAt(distance int, slot int, value any) {
+	e.ancestor(distance).slots[slot].value = value
 }
 
 func (e *Env) ancestor(distance int) *Env {
@@ -75,4 +96,4 @@ func (e *Env) ancestor(distance int) *Env {
 	}
 
 	return env
-}
\ No newline at end of file
+}
@@ -0,0 +1,31 @@
+package interpreter
+
+import (
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// ErrorObject is what a catch clause receives for a built-in runtime error
+type ErrorObject struct {
+	message string
+	line int
+}
+
+func NewErrorObject(message string, line int) *ErrorObject {
+	return &ErrorObject{message: message, line: line}
+}
+
+func (e *ErrorObject) String() string {
+	return "Error: " + e.message
+}
+
+func (e *ErrorObject) Get(name token.Token) (any, error) {
+	switch name.Lexeme {
+	case "message":
+		return e.message, nil
+	case "line":
+		return float64(e.line), nil
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+}
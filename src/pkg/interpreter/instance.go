@@ -19,13 +19,19 @@ func (i *Instance) String() string {
 	return i.class.name + " instance"
 }
 
-func (i *Instance) Get(name string) (any, error) {
-	value, exists := i.fields[name]
-	if !exists {
-		return nil, lox_error.NewRuntimeError(token.Token{}, "Undefined property '"+name+"'.")
+// Fields shadow methods, and methods are bound to the instance on access
+func (i *Instance) Get(name token.Token) (any, error) {
+	value, exists := i.fields[name.Lexeme]
+	if exists {
+		return value, nil
 	}
-	
-	return value, nil
+
+	method, err := i.FindMethod(name.Lexeme)
+	if err == nil {
+		return method.Bind(i), nil
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
 }
 
 func (i *Instance) Set(name string, property any) {
@@ -34,4 +40,4 @@ func (i *Instance) Set(name string, property any) {
 
 func (i *Instance) FindMethod(name string) (*Function, error) {
 	return i.class.FindMethod(name)
-}
\ No newline at end of file
+}
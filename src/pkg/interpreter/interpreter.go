@@ -1,7 +1,11 @@
 package interpreter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 
 	"github.com/lidanielm/glox/src/pkg/internal/ast"
@@ -13,22 +17,81 @@ import (
 type Interpreter struct {
 	env *Env
 	globals *Env
-	locals map[ast.Expr]int
+	path string // file being interpreted, empty for the REPL
+	source string // source being interpreted, for rendering errors
+	importer *Interpreter // interpreter that imported this file as a module
+	modules map[string]*Module // loaded modules by canonical path
+	stdout io.Writer // program output from print
+	stderr io.Writer // diagnostics such as runtime errors
+	warnings func(err error) // handles warnings instead of writing them to stderr
+	stdin *bufio.Reader // read by the input natives
+	limits *limits
+	calls *callStack
+	debugger Debugger // nil unless debugging
+}
+
+type Option func(*Interpreter)
+
+// Sends program output (print statements) to w instead of os.Stdout
+func WithOutput(w io.Writer) Option {
+	return func(ip *Interpreter) {
+		ip.stdout = w
+	}
+}
+
+// Sends diagnostics (runtime errors and warnings) to w instead of os.Stderr
+func WithDiagnostics(w io.Writer) Option {
+	return func(ip *Interpreter) {
+		ip.stderr = w
+	}
+}
+
+// Passes warnings, such as a variable declared twice in one scope, to handle
+// instead of writing them with the other diagnostics
+func WithWarnings(handle func(err error)) Option {
+	return func(ip *Interpreter) {
+		ip.warnings = handle
+	}
 }
 
-func NewInterpreter() *Interpreter {
-	globals := NewEnv()
-	globals.Define("clock", &ClockFn{})
+// Reads input for input() and readLine() from r instead of os.Stdin
+func WithInput(r io.Reader) Option {
+	return func(ip *Interpreter) {
+		ip.stdin = bufio.NewReader(r)
+	}
+}
+
+func NewInterpreter(options ...Option) *Interpreter {
+	// Natives live outside globals so they aren't exported from modules
+	builtins := NewEnv()
+	defineNatives(builtins)
+	globals := NewEnv().WithParent(builtins)
 	env := globals
-	locals := make(map[ast.Expr]int)
-	return &Interpreter{env: env, globals: globals, locals: locals}
+	modules := make(map[string]*Module)
+	ip := &Interpreter{env: env, globals: globals, modules: modules, stdout: os.Stdout, stderr: os.Stderr, limits: newLimits(), calls: newCallStack()}
+	for _, option := range options {
+		option(ip)
+	}
+
+	if ip.stdin == nil {
+		ip.stdin = bufio.NewReader(os.Stdin)
+	}
+	return ip
 }
 
+// Executes a resolved program. Errors are written to the diagnostics
+// stream before being returned, so callers needn't report them again.
 func (ip *Interpreter) Interpret(stmts []stmt.Stmt) error {
+	return ip.InterpretContext(context.Background(), stmts)
+}
+
+// Like Interpret, but stops with an error once ctx is cancelled
+func (ip *Interpreter) InterpretContext(ctx context.Context, stmts []stmt.Stmt) error {
+	defer ip.limits.start(ctx)()
     for _, stmt := range stmts {
 		err := ip.execute(stmt)
 		if err != nil {
-			runtimeError(err)
+			ip.runtimeError(err)
 			return err
 		}
 	}
@@ -36,6 +99,78 @@ func (ip *Interpreter) Interpret(stmts []stmt.Stmt) error {
 	return nil
 }
 
+// Writes a diagnostic that isn't fatal, such as a resolver warning
+func (ip *Interpreter) Warn(err error) {
+	if ip.warnings != nil {
+		ip.warnings(err)
+		return
+	}
+	fmt.Fprintln(ip.stderr, lox_error.Render(err, ip.source))
+}
+
+// Sets the source the next statements were parsed from, so errors can show
+// the offending line
+func (ip *Interpreter) SetSource(source string) {
+	ip.source = source
+}
+
+// Executes statements without reporting errors, returning the value of the
+// final statement if it is an expression statement
+func (ip *Interpreter) Run(stmts []stmt.Stmt) (any, error) {
+	return ip.RunContext(context.Background(), stmts)
+}
+
+// Like Run, but stops with an error once ctx is cancelled
+func (ip *Interpreter) RunContext(ctx context.Context, stmts []stmt.Stmt) (any, error) {
+	defer ip.limits.start(ctx)()
+	var value any
+	for i, statement := range stmts {
+		var err error
+		if expression, ok := statement.(*stmt.Expression); ok && i == len(stmts) - 1 {
+			value, err = ip.evaluate(expression.Expr)
+		} else {
+			err = ip.execute(statement)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// Calls a Lox function or class from Go, subject to the interpreter's limits
+func (ip *Interpreter) Call(ctx context.Context, callee Callable, arguments []any) (any, error) {
+	defer ip.limits.start(ctx)()
+	return callee.Call(ip, arguments)
+}
+
+// Defines or overwrites a global variable
+func (ip *Interpreter) DefineGlobal(name string, value any) {
+	ip.globals.Define(name, value)
+}
+
+// Returns the global variables defined so far, not including natives
+func (ip *Interpreter) Globals() map[string]any {
+	globals := make(map[string]any, len(ip.globals.values))
+	for name, value := range ip.globals.values {
+		globals[name] = value
+	}
+	return globals
+}
+
+// Looks up a global variable, including natives
+func (ip *Interpreter) LookupGlobal(name string) (any, bool) {
+	for env := ip.globals; env != nil; env = env.parent {
+		if value, ok := env.values[name]; ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
 /** VISIT METHODS */
 func (ip *Interpreter) VisitLiteralExpr(literal ast.Literal) (any, error) {
 	return literal.Value, nil
@@ -61,19 +196,21 @@ func (ip *Interpreter) VisitUnaryExpr(unary ast.Unary) (any, error) {
         if !isBool(right) {
             return nil, lox_error.NewRuntimeError(unary.Operator, "Operand must be a boolean.")
         }
-		return !isTruthy(right), nil
+		return !IsTruthy(right), nil
     default:
         return nil, lox_error.NewRuntimeError(unary.Operator, "Invalid operator.")
 	}
 }
 
 func (ip *Interpreter) VisitBinaryExpr(binary ast.Binary) (any, error) {
-    left, lerr := ip.evaluate(binary.Left)
-    right, rerr := ip.evaluate(binary.Right)
+    left, err := ip.evaluate(binary.Left)
+    if err != nil {
+        return nil, err
+    }
 
-	// Evaluate both subexpressions first but report the first error
-    if lerr != nil || rerr != nil {
-        return nil, lerr
+    right, err := ip.evaluate(binary.Right)
+    if err != nil {
+        return nil, err
     }
 
     switch binary.Operator.Type {
@@ -102,10 +239,21 @@ func (ip *Interpreter) VisitBinaryExpr(binary ast.Binary) (any, error) {
         }
 
         if isString(left, right) {
+            err := ip.limits.allocate()
+            if err != nil {
+                return nil, err
+            }
             return left.(string) + right.(string), nil
         }
 
         return nil, lox_error.NewRuntimeError(binary.Operator, "Operands must be two numbers or two strings.")
+    case token.INTERPOLATION:
+        // Joins a part of an interpolated string to the string before it
+        err := ip.limits.allocate()
+        if err != nil {
+            return nil, err
+        }
+        return left.(string) + Stringify(right), nil
     case token.GREATER:
         if !isNumber(left, right) {
             return nil, lox_error.NewRuntimeError(binary.Operator, "Operands must be numbers.")
@@ -127,9 +275,9 @@ func (ip *Interpreter) VisitBinaryExpr(binary ast.Binary) (any, error) {
         }
         return left.(float64) <= right.(float64), nil
     case token.BANG_EQUAL:
-        return !isEqual(left, right), nil
+        return !IsEqual(left, right), nil
     case token.EQUAL_EQUAL:
-        return !isEqual(left, right), nil
+        return IsEqual(left, right), nil
     default:
         return nil, lox_error.NewRuntimeError(binary.Operator, "Invalid operator.")
     }
@@ -163,7 +311,7 @@ func (ip *Interpreter) VisitTernaryExpr(ternary ast.Ternary) (any, error) {
 
 
 func (ip *Interpreter) VisitVariableExpr(expr ast.Variable) (any, error) {
-	return ip.lookUpVariable(expr.Name, expr)
+	return ip.lookUpVariable(expr.Name, expr.Binding)
 }
 
 
@@ -173,12 +321,8 @@ func (ip *Interpreter) VisitAssignExpr(expr ast.Assign) (any, error) {
 		return nil, err
 	}
 
-	distance, ok := ip.locals[expr]
-	if ok {
-		err = ip.env.AssignAt(distance, expr.Name, value)
-		if err != nil {
-			return nil, err
-		}
+	if expr.Binding.Depth >= 0 {
+		ip.env.AssignAt(expr.Binding.Depth, expr.Binding.Slot, value)
 	} else {
 		err = ip.globals.Assign(expr.Name, value)
 		if err != nil {
@@ -198,11 +342,11 @@ func (ip *Interpreter) VisitLogicalExpr(expr ast.Logical) (any, error) {
 
 	switch expr.Operator.Type {
 	case token.OR:
-		if isTruthy(leftVal) {
+		if IsTruthy(leftVal) {
 			return leftVal, nil
 		}
 	case token.AND:
-		if !isTruthy(leftVal) {
+		if !IsTruthy(leftVal) {
 			return leftVal, nil
 		}
 	}
@@ -235,8 +379,23 @@ func (ip *Interpreter) VisitCallExpr(expr ast.Call) (any, error) {
 		return nil, lox_error.NewRuntimeError(expr.Paren, fmt.Sprintf("Expected %d arguments but got %d.", callableFn.Arity(), len(arguments)))
 	}
 
-	return callableFn.Call(ip, arguments)
+	defer ip.limits.exitCall()
+	if ip.limits.enterCall() {
+		return nil, lox_error.NewRuntimeError(expr.Paren, "Stack overflow.")
+	}
+
+	if f, ok := frameFor(callableFn); ok {
+		f.call, f.caller, f.env = expr.Paren, ip, ip.env
+		ip.calls.push(f)
+		defer ip.calls.pop()
+	}
+
+	value, err := callableFn.Call(ip, arguments)
+	if err != nil {
+		return nil, ip.calls.attach(CallError(expr.Paren, err))
+	}
 
+	return value, nil
 }
 
 func (ip *Interpreter) VisitGetExpr(expr ast.Get) (any, error) {
@@ -245,11 +404,20 @@ func (ip *Interpreter) VisitGetExpr(expr ast.Get) (any, error) {
 		return nil, err
 	}
 
-	if object, ok := object.(Instance); ok {
-		return object.Get(expr.Name.Lexeme)
+	switch object := object.(type) {
+	case *Instance:
+		return object.Get(expr.Name)
+	case *List:
+		return object.Get(expr.Name)
+	case *Map:
+		return object.Get(expr.Name)
+	case *Module:
+		return object.Get(expr.Name)
+	case *ErrorObject:
+		return object.Get(expr.Name)
 	}
 
-	return nil, lox_error.NewRuntimeError(expr.Name, "Only instances have fields.")
+	return nil, lox_error.NewRuntimeError(expr.Name, "Only instances have properties.")
 }
 
 func (ip *Interpreter) VisitSetExpr(expr ast.Set) (any, error) {
@@ -258,20 +426,137 @@ func (ip *Interpreter) VisitSetExpr(expr ast.Set) (any, error) {
 		return nil, err
 	}
 
-	if object, ok := object.(Instance); ok {
+	if object, ok := object.(*Instance); ok {
 		value, err := ip.evaluate(expr.Value)
 		if err != nil {
 			return nil, err
 		}
 
 		object.Set(expr.Name.Lexeme, value)
+		return value, nil
 	}
 
 	return nil, lox_error.NewRuntimeError(expr.Name, "Only instances have properties.")
 }
 
 func (ip *Interpreter) VisitThisExpr(expr ast.This) (any, error) {
-	return ip.lookUpVariable(expr.Keyword, expr)
+	return ip.lookUpVariable(expr.Keyword, expr.Binding)
+}
+
+func (ip *Interpreter) VisitSuperExpr(expr ast.Super) (any, error) {
+	distance := expr.Binding.Depth
+	superclass := ip.env.GetAt(distance, expr.Binding.Slot).(*Class)
+
+	// "this" is always bound in the environment just inside the one holding "super"
+	object := ip.env.GetAt(distance - 1, 0).(*Instance)
+
+	method, err := superclass.FindMethod(expr.Method.Lexeme)
+	if err != nil {
+		return nil, lox_error.NewRuntimeError(expr.Method, "Undefined property '"+expr.Method.Lexeme+"'.")
+	}
+
+	return method.Bind(object), nil
+}
+
+func (ip *Interpreter) VisitLambdaExpr(expr ast.Lambda) (any, error) {
+	err := ip.limits.allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLambda(expr, ip.env, ip), nil
+}
+
+func (ip *Interpreter) VisitListExpr(expr ast.List) (any, error) {
+	err := ip.limits.allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]any, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		value, err := ip.evaluate(element)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+	}
+
+	return NewList(elements), nil
+}
+
+func (ip *Interpreter) VisitMapExpr(expr ast.Map) (any, error) {
+	err := ip.limits.allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewMap()
+	for i := range expr.Keys {
+		key, err := ip.evaluate(expr.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := ip.evaluate(expr.Values[i])
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.SetKey(expr.Brace, key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (ip *Interpreter) VisitSubscriptExpr(expr ast.Subscript) (any, error) {
+	object, err := ip.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := ip.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	switch object := object.(type) {
+	case *List:
+		return object.GetIndex(expr.Bracket, index)
+	case *Map:
+		return object.GetKey(expr.Bracket, index)
+	}
+
+	return nil, lox_error.NewRuntimeError(expr.Bracket, "Only lists and maps can be indexed.")
+}
+
+func (ip *Interpreter) VisitSetSubscriptExpr(expr ast.SetSubscript) (any, error) {
+	object, err := ip.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := ip.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ip.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch object := object.(type) {
+	case *List:
+		return value, object.SetIndex(expr.Bracket, index, value)
+	case *Map:
+		return value, object.SetKey(expr.Bracket, index, value)
+	}
+
+	return nil, lox_error.NewRuntimeError(expr.Bracket, "Only lists and maps can be indexed.")
 }
 
 func (ip *Interpreter) evaluate(expr ast.Expr) (any, error) {
@@ -296,7 +581,7 @@ func (ip *Interpreter) VisitPrintStmt(stmt stmt.Print) error {
 		return err
 	}
 
-	fmt.Println(stringify(val))
+	fmt.Fprintln(ip.stdout, Stringify(val))
 	return nil
 }
 
@@ -317,8 +602,7 @@ func (ip *Interpreter) VisitVarStmt(stmt stmt.Var) error {
 
 
 func (ip *Interpreter) VisitBlockStmt(stmt stmt.Block) error {
-	newEnv := NewEnv().WithParent(ip.env)
-	return ip.executeBlock(stmt.Statements, newEnv)
+	return ip.executeBlock(stmt.Statements, newScope(ip.env))
 }
 
 // Wrapper for Go conditional control flow
@@ -328,7 +612,7 @@ func (ip *Interpreter) VisitIfStmt(stmt stmt.If) error {
 		return err
 	}
 
-	if isTruthy(truthy) {
+	if IsTruthy(truthy) {
 		return ip.execute(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
 		return ip.execute(stmt.ElseBranch)
@@ -343,7 +627,7 @@ func (ip *Interpreter) VisitWhileStmt(stmt stmt.While) error {
 		if err != nil {
 			return err
 		}
-		if !isTruthy(eval) {
+		if !IsTruthy(eval) {
 			break
 		}
 
@@ -374,7 +658,12 @@ func (ip *Interpreter) VisitWhileStmt(stmt stmt.While) error {
 }
 
 func (ip *Interpreter) VisitFunctionStmt(stmt stmt.Function) error {
-	function := NewFunction(stmt, ip.env, false)
+	err := ip.limits.allocate()
+	if err != nil {
+		return err
+	}
+
+	function := NewFunction(stmt, ip.env, ip, false)
 	ip.env.Define(stmt.Name.Lexeme, function)
 	return nil
 }
@@ -401,28 +690,114 @@ func (ip *Interpreter) VisitReturnStmt(stmt stmt.Return) error {
 }
 
 func (ip *Interpreter) VisitClassStmt(stmt stmt.Class) error {
-	ip.env.Define(stmt.Name.Lexeme, nil)
+	var superclass *Class
+	if stmt.Superclass != nil {
+		value, err := ip.evaluate(stmt.Superclass)
+		if err != nil {
+			return err
+		}
+
+		class, ok := value.(*Class)
+		if !ok {
+			return lox_error.NewRuntimeError(stmt.Superclass.Name, "Superclass must be a class.")
+		}
+		superclass = class
+	}
+
+	// Methods of a subclass close over an extra environment holding "super"
+	if superclass != nil {
+		ip.env = newScope(ip.env)
+		ip.env.Define("super", superclass)
+	}
 
 	// Bind methods to class
 	methods := make(map[string]*Function)
 	for _, method := range stmt.Methods {
 		isInitializer := method.Name.Lexeme == "init"
-		fn := NewFunction(method, ip.env, isInitializer)
+		fn := NewFunction(method, ip.env, ip, isInitializer)
+		fn.class = stmt.Name.Lexeme
 		methods[method.Name.Lexeme] = fn
 	}
 
-	class := NewClass(stmt.Name.Lexeme, methods)
-	ip.env.Assign(stmt.Name, class)
+	class := NewClass(stmt.Name.Lexeme, superclass, methods)
+
+	if superclass != nil {
+		ip.env = ip.env.parent
+	}
+
+	// Methods only look the class up once called, so it can be defined last
+	ip.env.Define(stmt.Name.Lexeme, class)
 	return nil
 }
 
+func (ip *Interpreter) VisitImportStmt(stmt stmt.Import) error {
+	module, err := ip.importModule(stmt.Path)
+	if err != nil {
+		return err
+	}
 
-func (ip *Interpreter) execute(stmt stmt.Stmt) error {
-	return stmt.Accept(ip)
+	if len(stmt.Names) == 0 {
+		ip.env.Define(stmt.Alias.Lexeme, module)
+		return nil
+	}
+
+	for _, name := range stmt.Names {
+		value, err := module.Get(name)
+		if err != nil {
+			return err
+		}
+		ip.env.Define(name.Lexeme, value)
+	}
+	return nil
+}
+
+func (ip *Interpreter) VisitThrowStmt(stmt stmt.Throw) error {
+	value, err := ip.evaluate(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	return lox_error.ThrowError{Token: stmt.Keyword, Value: value}
+}
+
+func (ip *Interpreter) VisitTryStmt(stmt stmt.Try) error {
+	err := ip.VisitBlockStmt(*stmt.Body)
+
+	if stmt.Catch != nil {
+		if caught, ok := CaughtValue(err); ok {
+			env := newScope(ip.env)
+			env.Define(stmt.CatchName.Lexeme, caught)
+			err = ip.executeBlock(stmt.Catch.Statements, env)
+		}
+	}
+
+	// The finally block runs however the try and catch blocks exited,
+	// including via return, break and continue, and any error it raises wins
+	if stmt.Finally != nil {
+		finallyErr := ip.VisitBlockStmt(*stmt.Finally)
+		if finallyErr != nil {
+			return finallyErr
+		}
+	}
+
+	return err
 }
 
-func (ip *Interpreter) resolve(expr ast.Expr, depth int) {
-	ip.locals[expr] = depth
+
+func (ip *Interpreter) execute(stmt stmt.Stmt) error {
+	err := ip.limits.step()
+	if err != nil {
+		return err
+	}
+
+	if ip.debugger != nil {
+		err = ip.pause(stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return stmt.Accept(ip)
 }
 
 func (ip *Interpreter) executeBlock(statements []stmt.Stmt, env *Env) error {
@@ -440,17 +815,17 @@ func (ip *Interpreter) executeBlock(statements []stmt.Stmt, env *Env) error {
 	return nil
 }
 
-func (ip *Interpreter) lookUpVariable(name token.Token, expr ast.Expr) (any, error) {
-	distance, ok := ip.locals[expr]
-	if ok {
-		return ip.env.GetAt(distance, name)
+func (ip *Interpreter) lookUpVariable(name token.Token, binding *ast.Binding) (any, error) {
+	if binding.Depth >= 0 {
+		return ip.env.GetAt(binding.Depth, binding.Slot), nil
 	} else {
 		return ip.globals.Get(name)
 	}
 }
 
 /** HELPER METHODS */
-func isTruthy(expr any) bool {
+// Reports whether a value counts as true: everything but nil and false
+func IsTruthy(expr any) bool {
 	if expr == nil {
 		return false
 	}
@@ -461,7 +836,8 @@ func isTruthy(expr any) bool {
 	return true
 }
 
-func isEqual(left any, right any) bool {
+// Compares values the way == does
+func IsEqual(left any, right any) bool {
     if left == nil && right == nil {
         return true
     }
@@ -473,12 +849,38 @@ func isEqual(left any, right any) bool {
     return left == right
 }
 
-func runtimeError(err error) {
-	fmt.Println(err.Error())
+// Natives report failures as plain Go errors, so attribute them to the call site
+func CallError(paren token.Token, err error) error {
+	switch err.(type) {
+	case *lox_error.RuntimeError, *lox_error.LoxError, *lox_error.ParseError, *lox_error.CompileError, lox_error.ThrowError, *lox_error.InterruptError:
+		return err
+	}
+
+	return lox_error.NewRuntimeError(paren, err.Error())
+}
+
+// Returns the value a catch clause receives for err, if it can be caught.
+// Thrown values are passed through as-is; runtime errors become error objects.
+func CaughtValue(err error) (any, bool) {
+	switch err := err.(type) {
+	case lox_error.ThrowError:
+		return err.Value, true
+	case *lox_error.RuntimeError:
+		return NewErrorObject(err.Message, err.Token.Line), true
+	}
+
+	return nil, false
+}
+
+func (ip *Interpreter) runtimeError(err error) {
+	fmt.Fprintln(ip.stderr, lox_error.Render(err, ip.source))
 }
 
 func isNumber(vs ...any) bool {
     for _, v := range vs {
+        if v == nil {
+            return false
+        }
         switch reflect.TypeOf(v).Kind() {
             case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
                  reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
@@ -494,6 +896,9 @@ func isNumber(vs ...any) bool {
 
 func isBool(vs ...any) bool {
     for _, v := range vs {
+        if v == nil {
+            return false
+        }
         switch reflect.TypeOf(v).Kind() {
         case reflect.Bool:
             continue
@@ -507,6 +912,9 @@ func isBool(vs ...any) bool {
 
 func isString(vs ...any) bool {
     for _, v := range vs {
+        if v == nil {
+            return false
+        }
         switch reflect.TypeOf(v).Kind() {
         case reflect.String:
             continue
@@ -518,10 +926,25 @@ func isString(vs ...any) bool {
     return true
 }
 
-func stringify(value any) string {
+// Formats a value the way print does
+func Stringify(value any) string {
     if value == nil {
         return "nil"
     }
 
     return fmt.Sprintf("%v", value)
+}
+
+// Formats a value inside a list or map. seen holds the lists and maps being
+// formatted around it, so one that contains itself prints as [...] or {...}
+// instead of recursing forever.
+func stringifyIn(value any, seen map[any]bool) string {
+    switch value := value.(type) {
+    case *List:
+        return value.format(seen)
+    case *Map:
+        return value.format(seen)
+    }
+
+    return Stringify(value)
 }
\ No newline at end of file
@@ -0,0 +1,111 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+// Deep enough for any reasonable recursion, but well short of exhausting
+// the Go stack, which would crash the host process
+const defaultMaxCallDepth = 10000
+
+// How many statements run between checks of the context
+const cancelCheckInterval = 256
+
+// limits tracks what a script has used so untrusted code can be sandboxed.
+// A zero maximum means no limit. It is shared with imported modules.
+type limits struct {
+	contexts []context.Context // of each run in progress, outermost first
+	maxSteps int
+	maxCallDepth int
+	maxAllocations int
+
+	steps int
+	callDepth int
+	allocations int
+}
+
+// Caps the number of statements a single run may execute
+func WithMaxSteps(n int) Option {
+	return func(ip *Interpreter) {
+		ip.limits.maxSteps = n
+	}
+}
+
+// Caps how deeply calls may nest before raising "Stack overflow."
+func WithMaxCallDepth(n int) Option {
+	return func(ip *Interpreter) {
+		ip.limits.maxCallDepth = n
+	}
+}
+
+// Caps how many lists, maps, instances, closures and concatenated strings a
+// single run may create
+func WithMaxAllocations(n int) Option {
+	return func(ip *Interpreter) {
+		ip.limits.maxAllocations = n
+	}
+}
+
+func newLimits() *limits {
+	return &limits{maxCallDepth: defaultMaxCallDepth}
+}
+
+// Starts a run, returning a function that ends it. Only the outermost run
+// resets the usage counters: a run nested inside it, such as a host
+// function calling back into Lox, counts against the outer run and stops
+// when either context is cancelled.
+func (l *limits) start(ctx context.Context) func() {
+	if len(l.contexts) == 0 {
+		l.steps = 0
+		l.callDepth = 0
+		l.allocations = 0
+	}
+	l.contexts = append(l.contexts, ctx)
+
+	callDepth := l.callDepth
+	return func() {
+		l.contexts = l.contexts[:len(l.contexts) - 1]
+		l.callDepth = callDepth
+	}
+}
+
+func (l *limits) step() error {
+	l.steps++
+	if l.maxSteps > 0 && l.steps > l.maxSteps {
+		return lox_error.NewInterruptError(fmt.Sprintf("exceeded the limit of %d executed statements.", l.maxSteps))
+	}
+
+	if l.steps % cancelCheckInterval == 0 {
+		for _, ctx := range l.contexts {
+			select {
+			case <-ctx.Done():
+				return lox_error.NewInterruptError(ctx.Err().Error() + ".")
+			default:
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *limits) allocate() error {
+	l.allocations++
+	if l.maxAllocations > 0 && l.allocations > l.maxAllocations {
+		return lox_error.NewInterruptError(fmt.Sprintf("exceeded the limit of %d allocated values.", l.maxAllocations))
+	}
+
+	return nil
+}
+
+// Reports whether one more nested call would exceed the depth limit
+func (l *limits) enterCall() bool {
+	l.callDepth++
+	return l.maxCallDepth > 0 && l.callDepth > l.maxCallDepth
+}
+
+func (l *limits) exitCall() {
+	l.callDepth--
+}
@@ -0,0 +1,112 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+// Runs source on an interpreter with the given options until ctx is done,
+// returning what it printed and the error it stopped with
+func interpretLimited(ctx context.Context, source string, options ...interpreter.Option) (string, error) {
+	var output bytes.Buffer
+	options = append(options, interpreter.WithOutput(&output), interpreter.WithDiagnostics(io.Discard))
+	err := interpret(resolving{Interpreter: interpreter.NewInterpreter(options...), ctx: ctx}, "", source)
+	return output.String(), err
+}
+
+// Checks that err interrupted the script with message
+func expectInterrupt(t *testing.T, err error, message string) {
+	t.Helper()
+	interrupt, ok := err.(*lox_error.InterruptError)
+	if !ok {
+		t.Fatalf("expected an interrupt, got %T: %v", err, err)
+	}
+	if interrupt.Error() != "Execution stopped: " + message {
+		t.Errorf("message %q", interrupt.Error())
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	_, err := interpretLimited(context.Background(), "while (true) {}", interpreter.WithMaxSteps(100))
+	expectInterrupt(t, err, "exceeded the limit of 100 executed statements.")
+
+	// Ten iterations of two statements each, plus the loop and declaration
+	output, err := interpretLimited(context.Background(), "for (var i = 0; i < 10; i = i + 1) print i;", interpreter.WithMaxSteps(100))
+	if err != nil || !strings.HasSuffix(output, "9\n") {
+		t.Errorf("output %q, error %v", output, err)
+	}
+}
+
+func TestAllocationLimit(t *testing.T) {
+	_, err := interpretLimited(context.Background(), "var xs = [];\nwhile (true) xs = [xs];", interpreter.WithMaxAllocations(10))
+	expectInterrupt(t, err, "exceeded the limit of 10 allocated values.")
+
+	_, err = interpretLimited(context.Background(), "var s = \"\";\nwhile (true) s = s + \"a\";", interpreter.WithMaxAllocations(10))
+	expectInterrupt(t, err, "exceeded the limit of 10 allocated values.")
+
+	_, err = interpretLimited(context.Background(), "var xs = [[1], {2: 3}];", interpreter.WithMaxAllocations(10))
+	if err != nil {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := interpretLimited(ctx, "while (true) {}")
+	expectInterrupt(t, err, "context canceled.")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	_, err = interpretLimited(ctx, "fun spin() {\n  while (true) {}\n}\nspin();")
+	expectInterrupt(t, err, "context deadline exceeded.")
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := interpretLimited(context.Background(), "fun f(n) {\n  return f(n + 1);\n}\nf(0);", interpreter.WithMaxCallDepth(50))
+	runtimeErr, ok := err.(*lox_error.RuntimeError)
+	if !ok || runtimeErr.Message != "Stack overflow." || runtimeErr.Token.Line != 2 {
+		t.Fatalf("expected a stack overflow on line 2, got %T: %v", err, err)
+	}
+
+	// Calls within the limit are fine, and it doesn't carry over between runs
+	for i := 0; i < 2; i++ {
+		output, err := interpretLimited(context.Background(), "fun f(n) {\n  if (n > 0) return f(n - 1);\n  return \"done\";\n}\nprint f(49);", interpreter.WithMaxCallDepth(50))
+		if err != nil || output != "done\n" {
+			t.Errorf("output %q, error %v", output, err)
+		}
+	}
+}
+
+// Lox code can't catch an interrupt, so a sandboxed script can't keep
+// itself running past its limits
+func TestInterruptNotCaught(t *testing.T) {
+	sources := []string{
+		"try {\n  while (true) {}\n} catch (e) {\n  print \"caught\";\n}\nprint \"after\";",
+		"fun spin() {\n  while (true) {}\n}\nwhile (true) {\n  try {\n    spin();\n  } catch (e) {\n    print \"caught\";\n  }\n}",
+		"try {\n  while (true) {}\n} finally {\n  print \"finally\";\n}\nprint \"after\";",
+	}
+
+	for _, source := range sources {
+		output, err := interpretLimited(context.Background(), source, interpreter.WithMaxSteps(1000))
+		expectInterrupt(t, err, "exceeded the limit of 1000 executed statements.")
+		if output != "" {
+			t.Errorf("%q printed %q", source, output)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	output, err := interpretLimited(ctx, sources[1])
+	expectInterrupt(t, err, "context canceled.")
+	if output != "" {
+		t.Errorf("printed %q after being cancelled", output)
+	}
+}
@@ -0,0 +1,151 @@
+package interpreter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type List struct {
+	elements []any
+}
+
+func NewList(elements []any) *List {
+	return &List{elements: elements}
+}
+
+func (l *List) String() string {
+	return l.format(make(map[any]bool))
+}
+
+func (l *List) format(seen map[any]bool) string {
+	if seen[l] {
+		return "[...]"
+	}
+	seen[l] = true
+	defer delete(seen, l)
+
+	strs := make([]string, len(l.elements))
+	for i, element := range l.elements {
+		strs[i] = stringifyIn(element, seen)
+	}
+
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
+// Returns the list's backing slice
+func (l *List) Elements() []any {
+	return l.elements
+}
+
+func (l *List) Len() int {
+	return len(l.elements)
+}
+
+func (l *List) GetIndex(bracket token.Token, index any) (any, error) {
+	i, err := l.index(bracket, index, len(l.elements))
+	if err != nil {
+		return nil, err
+	}
+
+	return l.elements[i], nil
+}
+
+func (l *List) SetIndex(bracket token.Token, index any, value any) error {
+	i, err := l.index(bracket, index, len(l.elements))
+	if err != nil {
+		return err
+	}
+
+	l.elements[i] = value
+	return nil
+}
+
+// Converts a Lox value to an index in [0, length)
+func (l *List) index(bracket token.Token, index any, length int) (int, error) {
+	i, ok := toInt(index)
+	if !ok {
+		return 0, lox_error.NewRuntimeError(bracket, "List index must be an integer.")
+	}
+
+	if i < 0 || i >= length {
+		return 0, lox_error.NewRuntimeError(bracket, "List index out of range.")
+	}
+
+	return i, nil
+}
+
+// Looks up a built-in method, bound to this list
+func (l *List) Get(name token.Token) (any, error) {
+	switch name.Lexeme {
+	case "push":
+		return NewNativeFn("push", 1, func(ip *Interpreter, arguments []any) (any, error) {
+			l.elements = append(l.elements, arguments[0])
+			return nil, nil
+		}), nil
+	case "pop":
+		return NewNativeFn("pop", 0, func(ip *Interpreter, arguments []any) (any, error) {
+			if len(l.elements) == 0 {
+				return nil, errors.New("Can't pop from an empty list.")
+			}
+
+			last := l.elements[len(l.elements) - 1]
+			l.elements = l.elements[:len(l.elements) - 1]
+			return last, nil
+		}), nil
+	case "len":
+		return NewNativeFn("len", 0, func(ip *Interpreter, arguments []any) (any, error) {
+			return float64(len(l.elements)), nil
+		}), nil
+	case "insert":
+		return NewNativeFn("insert", 2, func(ip *Interpreter, arguments []any) (any, error) {
+			// Inserting at len(elements) appends
+			i, ok := toInt(arguments[0])
+			if !ok || i < 0 || i > len(l.elements) {
+				return nil, errors.New("List index out of range.")
+			}
+
+			l.elements = append(l.elements, nil)
+			copy(l.elements[i + 1:], l.elements[i:])
+			l.elements[i] = arguments[1]
+			return nil, nil
+		}), nil
+	case "remove":
+		return NewNativeFn("remove", 1, func(ip *Interpreter, arguments []any) (any, error) {
+			i, ok := toInt(arguments[0])
+			if !ok || i < 0 || i >= len(l.elements) {
+				return nil, errors.New("List index out of range.")
+			}
+
+			removed := l.elements[i]
+			l.elements = append(l.elements[:i], l.elements[i + 1:]...)
+			return removed, nil
+		}), nil
+	case "slice":
+		return NewNativeFn("slice", 2, func(ip *Interpreter, arguments []any) (any, error) {
+			start, startOk := toInt(arguments[0])
+			end, endOk := toInt(arguments[1])
+			if !startOk || !endOk || start < 0 || end > len(l.elements) || start > end {
+				return nil, errors.New("List slice out of range.")
+			}
+
+			elements := make([]any, end - start)
+			copy(elements, l.elements[start:end])
+			return NewList(elements), nil
+		}), nil
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+}
+
+// Lox numbers are float64, so only integral values are valid indices
+func toInt(value any) (int, bool) {
+	num, ok := value.(float64)
+	if !ok || num != float64(int(num)) {
+		return 0, false
+	}
+
+	return int(num), true
+}
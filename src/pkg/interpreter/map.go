@@ -0,0 +1,169 @@
+package interpreter
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Map is a hash map from Lox values to Lox values. Only numbers other than
+// NaN, strings, booleans and nil can be keys; they hash by value using Go's
+// own equality.
+type Map struct {
+	entries map[any]any
+	keys []any // insertion order, so iteration is deterministic
+}
+
+func NewMap() *Map {
+	return &Map{entries: make(map[any]any), keys: []any{}}
+}
+
+func (m *Map) String() string {
+	return m.format(make(map[any]bool))
+}
+
+func (m *Map) format(seen map[any]bool) string {
+	if seen[m] {
+		return "{...}"
+	}
+	seen[m] = true
+	defer delete(seen, m)
+
+	strs := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		strs[i] = Stringify(key) + ": " + stringifyIn(m.entries[key], seen)
+	}
+
+	return "{" + strings.Join(strs, ", ") + "}"
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) GetKey(bracket token.Token, key any) (any, error) {
+	if !isHashable(key) {
+		return nil, lox_error.NewRuntimeError(bracket, "Unhashable map key.")
+	}
+
+	value, exists := m.entries[key]
+	if !exists {
+		return nil, lox_error.NewRuntimeError(bracket, "Undefined key '"+Stringify(key)+"'.")
+	}
+
+	return value, nil
+}
+
+func (m *Map) SetKey(bracket token.Token, key any, value any) error {
+	if !isHashable(key) {
+		return lox_error.NewRuntimeError(bracket, "Unhashable map key.")
+	}
+
+	m.put(key, value)
+	return nil
+}
+
+// Sets a key from Go code, failing if the key is unhashable
+func (m *Map) Put(key any, value any) error {
+	if !isHashable(key) {
+		return errors.New("Unhashable map key.")
+	}
+
+	m.put(key, value)
+	return nil
+}
+
+// Returns the keys in insertion order
+func (m *Map) Keys() []any {
+	keys := make([]any, len(m.keys))
+	copy(keys, m.keys)
+	return keys
+}
+
+func (m *Map) Lookup(key any) (any, bool) {
+	if !isHashable(key) {
+		return nil, false
+	}
+
+	value, exists := m.entries[key]
+	return value, exists
+}
+
+func (m *Map) put(key any, value any) {
+	if _, exists := m.entries[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+func (m *Map) delete(key any) bool {
+	if _, exists := m.entries[key]; !exists {
+		return false
+	}
+
+	delete(m.entries, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i + 1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Looks up a built-in method, bound to this map
+func (m *Map) Get(name token.Token) (any, error) {
+	switch name.Lexeme {
+	case "keys":
+		return NewNativeFn("keys", 0, func(ip *Interpreter, arguments []any) (any, error) {
+			return NewList(m.Keys()), nil
+		}), nil
+	case "values":
+		return NewNativeFn("values", 0, func(ip *Interpreter, arguments []any) (any, error) {
+			values := make([]any, len(m.keys))
+			for i, key := range m.keys {
+				values[i] = m.entries[key]
+			}
+			return NewList(values), nil
+		}), nil
+	case "has":
+		return NewNativeFn("has", 1, func(ip *Interpreter, arguments []any) (any, error) {
+			if !isHashable(arguments[0]) {
+				return nil, errors.New("Unhashable map key.")
+			}
+
+			_, exists := m.entries[arguments[0]]
+			return exists, nil
+		}), nil
+	case "delete":
+		return NewNativeFn("delete", 1, func(ip *Interpreter, arguments []any) (any, error) {
+			if !isHashable(arguments[0]) {
+				return nil, errors.New("Unhashable map key.")
+			}
+
+			return m.delete(arguments[0]), nil
+		}), nil
+	case "len":
+		return NewNativeFn("len", 0, func(ip *Interpreter, arguments []any) (any, error) {
+			return float64(len(m.keys)), nil
+		}), nil
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+}
+
+// NaN is never equal to itself, so it could be stored as a key but never
+// found again
+func isHashable(value any) bool {
+	switch value := value.(type) {
+	case float64:
+		return !math.IsNaN(value)
+	case nil, string, bool:
+		return true
+	default:
+		return false
+	}
+}
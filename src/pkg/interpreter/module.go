@@ -0,0 +1,164 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Module is the namespace created by importing a file. Its members are the
+// top-level bindings of that file.
+type Module struct {
+	name string
+	path string
+	globals *Env
+}
+
+func NewModule(name string, path string, globals *Env) *Module {
+	return &Module{name: name, path: path, globals: globals}
+}
+
+func (m *Module) String() string {
+	return "<module " + m.name + ">"
+}
+
+func (m *Module) Get(name token.Token) (any, error) {
+	value, exists := m.globals.values[name.Lexeme]
+	if !exists {
+		return nil, lox_error.NewRuntimeError(name, "Module '"+m.name+"' has no member '"+name.Lexeme+"'.")
+	}
+
+	return value, nil
+}
+
+// Sets the file being interpreted, so imports inside it resolve relative to
+// its directory and importing it back is reported as a cycle. An empty
+// path means there's no file, as in the REPL.
+func (ip *Interpreter) SetPath(path string) error {
+	if path == "" {
+		ip.path = ""
+		return nil
+	}
+
+	canonical, err := CanonicalPath(path)
+	if err != nil {
+		return err
+	}
+
+	ip.path = canonical
+	return nil
+}
+
+// Loads the module at the given path, relative to the importing file. Each
+// file is executed at most once per program; later imports share the result.
+func (ip *Interpreter) importModule(pathToken token.Token) (*Module, error) {
+	path := pathToken.Literal.(string)
+	if !filepath.IsAbs(path) && ip.path != "" {
+		path = filepath.Join(filepath.Dir(ip.path), path)
+	}
+
+	canonical, err := CanonicalPath(path)
+	if err != nil {
+		return nil, lox_error.NewRuntimeError(pathToken, "Can't find module '"+pathToken.Literal.(string)+"'.")
+	}
+
+	if module, ok := ip.modules[canonical]; ok {
+		return module, nil
+	}
+
+	// Any file still being executed further up the import chain is a cycle
+	chain := []string{}
+	for importer := ip; importer != nil; importer = importer.importer {
+		if importer.path != "" {
+			chain = append([]string{importer.path}, chain...)
+		}
+	}
+	for i, p := range chain {
+		if p == canonical {
+			cycle := append(chain[i:], canonical)
+			for j := range cycle {
+				cycle[j] = DisplayPath(chain[0], cycle[j])
+			}
+			return nil, lox_error.NewRuntimeError(pathToken, "Import cycle: "+strings.Join(cycle, " -> ")+".")
+		}
+	}
+
+	data, err := os.ReadFile(canonical)
+	if err != nil {
+		return nil, lox_error.NewRuntimeError(pathToken, "Can't read module '"+pathToken.Literal.(string)+"'.")
+	}
+
+	// Each module gets its own globals, but shares the cache of loaded modules
+	child := NewInterpreter()
+	child.stdout, child.stderr, child.stdin = ip.stdout, ip.stderr, ip.stdin
+	child.warnings = ip.warnings
+	child.limits = ip.limits
+	child.calls = ip.calls
+	child.debugger = ip.debugger
+	child.path = canonical
+	child.source = string(data)
+	child.importer = ip
+	child.modules = ip.modules
+
+	// Errors in the module are reported against its file
+	tokens, err := scanner.NewScanner(string(data)).ScanTokens()
+	if err != nil {
+		return nil, lox_error.InModule(err, canonical)
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, lox_error.InModule(err, canonical)
+	}
+
+	_, err = NewResolver(child).ResolveStmts(statements)
+	if err != nil {
+		return nil, lox_error.InModule(err, canonical)
+	}
+
+	for _, statement := range statements {
+		err = child.execute(statement)
+		if err != nil {
+			return nil, lox_error.InModule(err, canonical)
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(canonical), filepath.Ext(canonical))
+	module := NewModule(name, canonical, child.globals)
+	ip.modules[canonical] = module
+	return module, nil
+}
+
+// Returns the path errors in this interpreter's code are reported against:
+// its file if it was imported, or "" for the file being run
+func (ip *Interpreter) modulePath() string {
+	if ip.importer == nil {
+		return ""
+	}
+	return ip.path
+}
+
+// Resolves a path to the absolute, symlink-free form modules are cached by
+func CanonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// Shows paths relative to the directory of the root file where possible
+func DisplayPath(root string, path string) string {
+	rel, err := filepath.Rel(filepath.Dir(root), path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
@@ -0,0 +1,186 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+// Writes files into a temporary directory, returning its canonical path
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err := os.WriteFile(path, []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Runs the file at path on a backend, returning the error it stopped with
+func runFile(t *testing.T, b backend, path string) error {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return interpret(b, path, string(data))
+}
+
+func TestModuleErrorFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"bad.lox": "var z = ;\n",
+		"lib/util.lox": "fun fail(x) {\n  return x - \"a\";\n}\nfun thrower() {\n  throw \"boom\";\n}\nprint 1 - nil;\n",
+		"lib/ok.lox": "fun fail(x) {\n  return x - \"a\";\n}\nfun thrower() {\n  throw \"boom\";\n}\n",
+		"syntax.lox": "import \"bad.lox\" as b;\n",
+		"top.lox": "import \"lib/util.lox\" as u;\n",
+		"call.lox": "import \"lib/ok.lox\" as u;\nfun run() {\n  u.fail(1);\n}\nrun();\n",
+		"throw.lox": "import \"lib/ok.lox\" as u;\nu.thrower();\n",
+		"main.lox": "print 1 - nil;\n",
+	})
+
+	tests := []struct {
+		file string
+		line int
+		module string // "" for the file being run
+	}{
+		{"syntax.lox", 1, "bad.lox"},
+		{"top.lox", 7, "lib/util.lox"},
+		{"call.lox", 2, "lib/ok.lox"},
+		{"throw.lox", 5, "lib/ok.lox"},
+		{"main.lox", 1, ""},
+	}
+
+	for _, b := range backends {
+		for _, test := range tests {
+			t.Run(b.name + "/" + test.file, func(t *testing.T) {
+				err := runFile(t, b.newBackend(streams{}), filepath.Join(dir, test.file))
+				if list, ok := err.(lox_error.ErrorList); ok {
+					err = list[0]
+				}
+				tok, ok := lox_error.ErrorToken(err)
+				if !ok {
+					t.Fatalf("error without a position: %v", err)
+				}
+
+				expected := ""
+				if test.module != "" {
+					expected = filepath.Join(dir, test.module)
+				}
+				if file := lox_error.ErrorFile(err); file != expected || tok.Line != test.line {
+					t.Errorf("error at %s line %d, expected %s line %d: %v", file, tok.Line, expected, test.line, err)
+				}
+			})
+		}
+	}
+}
+
+func TestModuleTrace(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib.lox": "fun fail() {\n  return nil + 1;\n}\n",
+		"main.lox": "import \"lib.lox\" as lib;\nfun run() {\n  lib.fail();\n}\nrun();\n",
+	})
+	lib := filepath.Join(dir, "lib.lox")
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			err := runFile(t, b.newBackend(streams{}), filepath.Join(dir, "main.lox"))
+			runtimeError, ok := err.(*lox_error.RuntimeError)
+			if !ok {
+				t.Fatalf("expected a runtime error, got %v", err)
+			}
+
+			expected := []lox_error.Frame{
+				{Function: "fail", Line: 2, Defined: 1, File: lib},
+				{Function: "run", Line: 3, Defined: 2},
+				{Function: "<script>", Line: 5},
+			}
+			if len(runtimeError.Trace) != len(expected) {
+				t.Fatalf("trace: %+v", runtimeError.Trace)
+			}
+			for i, frame := range expected {
+				if runtimeError.Trace[i] != frame {
+					t.Errorf("frame %d: expected %+v, got %+v", i, frame, runtimeError.Trace[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"counter.lox": "print \"loading counter\";\nvar count = 0;\nfun increment() {\n  count = count + 1;\n  return count;\n}\n",
+		"lib/greet.lox": "import \"../counter.lox\" as c;\nfun hello(name) {\n  return \"hello \" + name;\n}\n",
+		"main.lox": `import "counter.lox" as counter;
+import "counter.lox" as again;
+from "counter.lox" import increment;
+import "lib/greet.lox" as greet;
+print counter;
+print increment();
+print counter.count;
+print again.increment();
+print greet.hello("lox");
+`,
+	})
+
+	// A module runs once however often it's imported, and its members are
+	// its globals as they are now
+	expected := "loading counter\n<module counter>\n1\n1\n2\nhello lox\n"
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := runFile(t, b.newBackend(streams{output: &output}), filepath.Join(dir, "main.lox"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != expected {
+				t.Errorf("output:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib.lox": "var x = 1;\n",
+		"a.lox": "import \"b.lox\" as b;\n",
+		"b.lox": "import \"a.lox\" as a;\n",
+		"self.lox": "import \"self.lox\" as self;\n",
+		"missing.lox": "import \"nowhere.lox\" as n;\n",
+		"member.lox": "import \"lib.lox\" as lib;\nprint lib.y;\n",
+		"from.lox": "from \"lib.lox\" import x, y;\n",
+	})
+
+	tests := []struct {
+		file string
+		message string
+	}{
+		{"a.lox", "Import cycle: a.lox -> b.lox -> a.lox."},
+		{"self.lox", "Import cycle: self.lox -> self.lox."},
+		{"missing.lox", "Can't find module 'nowhere.lox'."},
+		{"member.lox", "Module 'lib' has no member 'y'."},
+		{"from.lox", "Module 'lib' has no member 'y'."},
+	}
+
+	for _, b := range backends {
+		for _, test := range tests {
+			t.Run(b.name + "/" + test.file, func(t *testing.T) {
+				err := runFile(t, b.newBackend(streams{}), filepath.Join(dir, test.file))
+				runtimeError, ok := err.(*lox_error.RuntimeError)
+				if !ok || runtimeError.Message != test.message {
+					t.Errorf("expected %q, got %v", test.message, err)
+				}
+			})
+		}
+	}
+}
@@ -1,8 +1,6 @@
 package interpreter
 
 import (
-	"fmt"
-
 	"github.com/lidanielm/glox/src/pkg/internal/ast"
 	"github.com/lidanielm/glox/src/pkg/internal/stmt"
 	"github.com/lidanielm/glox/src/pkg/internal/tool"
@@ -12,21 +10,53 @@ import (
 
 type Resolver struct {
 	ip *Interpreter
-	scopes tool.Stack[map[string]bool]
+	scopes tool.Stack[*scope]
 	currFunc FunctionType
 	currClass ClassType
+	symbols *Symbols // nil unless recording
+	tolerant bool
+	errors []error // when tolerant
 }
 
 func NewResolver(ip *Interpreter) *Resolver {
-	scopes := tool.NewStack[map[string]bool]()
+	scopes := tool.NewStack[*scope]()
 	return &Resolver{ip: ip, scopes: *scopes, currFunc: NONE_FUNC, currClass: NONE_CLASS}
 }
 
+// Makes the resolver record every declaration and the references to it as
+// it goes, for tools such as the language server. Warnings are collected
+// in the returned Symbols instead of being reported.
+func (r *Resolver) RecordSymbols() *Symbols {
+	r.symbols = newSymbols()
+	return r.symbols
+}
+
+// Makes the resolver carry on past errors instead of stopping at the first,
+// so tools such as the linter see the whole program. ResolveStmts then
+// returns nil and the errors are collected in Errors.
+func (r *Resolver) ContinueOnError() {
+	r.tolerant = true
+}
+
+// The errors found so far when continuing on error
+func (r *Resolver) Errors() []error {
+	return r.errors
+}
+
+// Returns err, or collects it and returns nil when continuing on error
+func (r *Resolver) fail(err error) error {
+	if r.tolerant {
+		r.errors = append(r.errors, err)
+		return nil
+	}
+	return err
+}
+
 func (r *Resolver) VisitBlockStmt(stmt stmt.Block) error {
-	r.beginScope()
-	r.ResolveStmts(stmt.Statements)
+	r.beginScope(stmt.Span())
+	_, err := r.ResolveStmts(stmt.Statements)
 	r.endScope()
-	return nil
+	return err
 }
 
 func (r *Resolver) VisitBreakStmt(stmt stmt.Break) error {
@@ -37,22 +67,56 @@ func (r *Resolver) VisitClassStmt(stmt stmt.Class) error {
 	enclosingClass := r.currClass
 	r.currClass = CLASS
 
+	defer func() { r.currClass = enclosingClass }()
+
 	r.declare(stmt.Name)
+	class := r.record(stmt.Name, CLASS_SYMBOL, stmt.Span())
+	r.define(stmt.Name)
 
-	r.beginScope()
-	r.scopes.Peek()["this"] = true
+	if stmt.Superclass != nil {
+		if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+			err := r.fail(lox_error.NewResolveError(stmt.Superclass.Name, "A class can't inherit from itself."))
+			if err != nil {
+				return err
+			}
+		}
+
+		r.currClass = SUBCLASS
+		_, err := r.resolveExpr(stmt.Superclass)
+		if err != nil {
+			return err
+		}
+
+		if class != nil {
+			class.Superclass = stmt.Superclass.Name.Lexeme
+		}
+
+		r.beginScope(stmt.Span())
+		r.scopes.Peek().add("super", true)
+		defer r.endScope()
+	}
+
+	r.beginScope(stmt.Span())
+	r.scopes.Peek().add("this", true)
+	defer r.endScope()
 
 	for _, method := range stmt.Methods {
+		ftype := METHOD
 		if method.Name.Lexeme == "init" {
-			r.resolveFunction(method, INITIALIZER)
-		} else {
-			r.resolveFunction(method, METHOD)
+			ftype = INITIALIZER
+		}
+
+		if symbol := r.record(method.Name, METHOD_SYMBOL, method.Span()); symbol != nil {
+			symbol.Params = method.Params
+			symbol.Class = class
+		}
+
+		err := r.resolveFunction(method, ftype)
+		if err != nil {
+			return err
 		}
 	}
 
-	r.define(stmt.Name)
-	r.endScope()
-	r.currClass = enclosingClass
 	return nil
 }
 
@@ -62,8 +126,12 @@ func (r *Resolver) VisitContinueStmt(stmt stmt.Continue) error {
 
 func (r *Resolver) VisitVarStmt(stmt stmt.Var) error {
 	r.declare(stmt.Name)
+	r.record(stmt.Name, VARIABLE_SYMBOL, stmt.Span())
 	if stmt.Initializer != nil {
-		r.resolveExpr(stmt.Initializer)
+		_, err := r.resolveExpr(stmt.Initializer)
+		if err != nil {
+			return err
+		}
 	}
 
 	r.define(stmt.Name)
@@ -72,9 +140,62 @@ func (r *Resolver) VisitVarStmt(stmt stmt.Var) error {
 
 func (r *Resolver) VisitFunctionStmt(stmt stmt.Function) error {
 	r.declare(stmt.Name)
+	if symbol := r.record(stmt.Name, FUNCTION_SYMBOL, stmt.Span()); symbol != nil {
+		symbol.Params = stmt.Params
+	}
 	r.define(stmt.Name)
 
-	r.resolveFunction(stmt, FUNCTION)
+	return r.resolveFunction(stmt, FUNCTION)
+}
+
+func (r *Resolver) VisitImportStmt(stmt stmt.Import) error {
+	if len(stmt.Names) == 0 {
+		r.declare(stmt.Alias)
+		if symbol := r.record(stmt.Alias, IMPORT_SYMBOL, stmt.Span()); symbol != nil {
+			symbol.Module = stmt.Path.Lexeme
+			symbol.Alias = true
+		}
+		r.define(stmt.Alias)
+		return nil
+	}
+
+	for _, name := range stmt.Names {
+		r.declare(name)
+		if symbol := r.record(name, IMPORT_SYMBOL, stmt.Span()); symbol != nil {
+			symbol.Module = stmt.Path.Lexeme
+		}
+		r.define(name)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt stmt.Throw) error {
+	_, err := r.resolveExpr(stmt.Value)
+	return err
+}
+
+func (r *Resolver) VisitTryStmt(stmt stmt.Try) error {
+	err := r.VisitBlockStmt(*stmt.Body)
+	if err != nil {
+		return err
+	}
+
+	if stmt.Catch != nil {
+		// The error variable is scoped to the catch body, like a parameter
+		r.beginScope(stmt.Catch.Span())
+		r.declare(stmt.CatchName)
+		r.record(stmt.CatchName, CATCH_SYMBOL, stmt.CatchName.Span)
+		r.define(stmt.CatchName)
+		_, err = r.ResolveStmts(stmt.Catch.Statements)
+		r.endScope()
+		if err != nil {
+			return err
+		}
+	}
+
+	if stmt.Finally != nil {
+		return r.VisitBlockStmt(*stmt.Finally)
+	}
 	return nil
 }
 
@@ -120,12 +241,22 @@ func (r *Resolver) VisitWhileStmt(stmt stmt.While) error {
 		return err
 	}
 
+	if stmt.Increment != nil {
+		_, err = r.resolveExpr(stmt.Increment)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (r *Resolver) VisitReturnStmt(stmt stmt.Return) error {
 	if r.currFunc == NONE_FUNC {
-		return lox_error.NewParseError(stmt.Keyword, "Can't return from top-level code.")
+		err := r.fail(lox_error.NewResolveError(stmt.Keyword, "Can't return from top-level code."))
+		if err != nil {
+			return err
+		}
 	}
 
 	if stmt.Value == nil {
@@ -133,7 +264,10 @@ func (r *Resolver) VisitReturnStmt(stmt stmt.Return) error {
 	}
 
 	if r.currFunc == INITIALIZER {
-		return lox_error.NewParseError(stmt.Keyword, "Can't return a value from an initializer.")
+		err := r.fail(lox_error.NewResolveError(stmt.Keyword, "Can't return a value from an initializer."))
+		if err != nil {
+			return err
+		}
 	}
 
 	_, err := r.resolveExpr(stmt.Value)
@@ -144,14 +278,16 @@ func (r *Resolver) VisitVariableExpr(expr ast.Variable) (any, error) {
 	// If variable exists in current scope but value is false,
 	// that means we have declared it but not yet defined it
 	if !r.scopes.IsEmpty() {
-		scope := r.scopes.Peek()
-		val, ok := scope[expr.Name.Lexeme]
-		if ok && !val {
-			return nil, lox_error.NewParseError(expr.Name, "Can't read local variable in its own initializer.")
+		local, ok := r.scopes.Peek().locals[expr.Name.Lexeme]
+		if ok && !local.defined {
+			err := r.fail(lox_error.NewResolveError(expr.Name, "Can't read local variable in its own initializer."))
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	r.resolveLocal(expr, expr.Name)
+	r.resolveLocal(expr.Binding, expr.Name)
 	return nil, nil
 }
 
@@ -161,7 +297,7 @@ func (r *Resolver) VisitAssignExpr(expr ast.Assign) (any, error) {
 		return nil, err
 	}
 	
-	r.resolveLocal(expr, expr.Name)
+	r.resolveLocal(expr.Binding, expr.Name)
 	return nil, nil
 }
 
@@ -255,12 +391,81 @@ func (r *Resolver) VisitTernaryExpr(expr ast.Ternary) (any, error) {
 
 func (r *Resolver) VisitThisExpr(expr ast.This) (any, error) {
 	if r.currClass == NONE_CLASS {
-		return nil, lox_error.NewRuntimeError(expr.Keyword, "Can't use 'this' outside of a class.")
+		return nil, r.fail(lox_error.NewResolveError(expr.Keyword, "Can't use 'this' outside of a class."))
+	}
+	r.resolveLocal(expr.Binding, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSuperExpr(expr ast.Super) (any, error) {
+	if r.currClass == NONE_CLASS {
+		return nil, r.fail(lox_error.NewResolveError(expr.Keyword, "Can't use 'super' outside of a class."))
+	} else if r.currClass != SUBCLASS {
+		return nil, r.fail(lox_error.NewResolveError(expr.Keyword, "Can't use 'super' in a class with no superclass."))
 	}
-	r.resolveLocal(expr, expr.Keyword)
+
+	r.resolveLocal(expr.Binding, expr.Keyword)
 	return nil, nil
 }
 
+func (r *Resolver) VisitLambdaExpr(expr ast.Lambda) (any, error) {
+	lambda := stmt.NewFunction(expr.Keyword, expr.Params, expr.Body.([]stmt.Stmt))
+	lambda.SetSpan(expr.Span())
+	return nil, r.resolveFunction(*lambda, FUNCTION)
+}
+
+func (r *Resolver) VisitListExpr(expr ast.List) (any, error) {
+	for _, element := range expr.Elements {
+		_, err := r.resolveExpr(element)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitMapExpr(expr ast.Map) (any, error) {
+	for i := range expr.Keys {
+		_, err := r.resolveExpr(expr.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = r.resolveExpr(expr.Values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *Resolver) VisitSubscriptExpr(expr ast.Subscript) (any, error) {
+	_, err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.resolveExpr(expr.Index)
+	return nil, err
+}
+
+func (r *Resolver) VisitSetSubscriptExpr(expr ast.SetSubscript) (any, error) {
+	_, err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.resolveExpr(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.resolveExpr(expr.Value)
+	return nil, err
+}
+
 func (r *Resolver) VisitUnaryExpr(expr ast.Unary) (any, error) {
 	return r.resolveExpr(expr.Right)
 }
@@ -283,33 +488,45 @@ func (r *Resolver) resolveExpr(expr ast.Expr) (any, error) {
 	return expr.Accept(r)
 }
 
-func (r *Resolver) resolveLocal(expr ast.Expr, name token.Token) {
+// Records on the node which scope and slot the variable lives in. Anything
+// not found is left as a global.
+func (r *Resolver) resolveLocal(binding *ast.Binding, name token.Token) {
 	for i := r.scopes.Length() - 1; i >= 0; i-- {
-		if _, ok := r.scopes.Get(i)[name.Lexeme]; ok {
-			r.ip.resolve(expr, r.scopes.Length() - 1 - i)
+		if local, ok := r.scopes.Get(i).locals[name.Lexeme]; ok {
+			binding.Depth = r.scopes.Length() - 1 - i
+			binding.Slot = local.slot
+			if r.symbols != nil && local.symbol != nil {
+				local.symbol.References = append(local.symbol.References, name)
+			}
 			return
 		}
 	}
+
+	if r.symbols != nil {
+		r.symbols.unresolved = append(r.symbols.unresolved, name)
+	}
 }
 
-func (r *Resolver) resolveFunction(function stmt.Function, ftype FunctionType) {
+func (r *Resolver) resolveFunction(function stmt.Function, ftype FunctionType) error {
 	enclosingFunc := r.currFunc
 	r.currFunc = ftype
 
-	r.beginScope()
+	r.beginScope(function.Span())
 	for _, param := range function.Params {
 		r.declare(param)
+		r.record(param, PARAMETER_SYMBOL, param.Span)
 		r.define(param)
 	}
-	r.ResolveStmts(function.Body)
+	_, err := r.ResolveStmts(function.Body)
 	r.endScope()
 
 	r.currFunc = enclosingFunc
+	return err
 }
 
-func (r *Resolver) beginScope() {
-	newScope := make(map[string]bool, 0)
-	r.scopes.Push(newScope)
+// Starts a scope covering span of the source
+func (r *Resolver) beginScope(span token.Span) {
+	r.scopes.Push(&scope{locals: make(map[string]*local), span: span})
 }
 
 func (r *Resolver) endScope() {
@@ -322,11 +539,11 @@ func (r *Resolver) declare(name token.Token) {
 	}
 
 	scope := r.scopes.Peek()
-	_, ok := scope[name.Lexeme]
+	_, ok := scope.locals[name.Lexeme]
 	if ok {
-		fmt.Println(lox_error.NewError(name, "Already a variable with this name in this scope.").Error())
+		r.warn(lox_error.NewResolveWarning(name, "Already a variable with this name in this scope."))
 	}
-	scope[name.Lexeme] = false
+	scope.add(name.Lexeme, false)
 }
 
 func (r *Resolver) define(name token.Token) {
@@ -334,6 +551,52 @@ func (r *Resolver) define(name token.Token) {
 		return
 	}
 
-	scope := r.scopes.Peek()
-	scope[name.Lexeme] = true
+	r.scopes.Peek().locals[name.Lexeme].defined = true
+}
+
+// Records a declaration if symbols are being recorded. Unless it's a
+// method, the name must have just been declared.
+func (r *Resolver) record(name token.Token, kind SymbolKind, span token.Span) *Symbol {
+	if r.symbols == nil {
+		return nil
+	}
+
+	symbol := &Symbol{Name: name, Kind: kind, Span: span}
+	if !r.scopes.IsEmpty() {
+		scope := r.scopes.Peek()
+		symbol.Scope = scope.span
+		if kind != METHOD_SYMBOL {
+			scope.locals[name.Lexeme].symbol = symbol
+		}
+	}
+	r.symbols.add(symbol)
+	return symbol
+}
+
+func (r *Resolver) warn(err error) {
+	if r.symbols != nil {
+		r.symbols.Warnings = append(r.symbols.Warnings, err)
+		return
+	}
+	r.ip.Warn(err)
+}
+
+// scope is a block being resolved. Each declaration takes the next slot,
+// matching the order Env.Define fills them in at runtime; a redeclared name
+// gets a fresh slot and shadows the old one.
+type scope struct {
+	locals map[string]*local
+	size int
+	span token.Span
+}
+
+type local struct {
+	slot int
+	defined bool
+	symbol *Symbol // when recording symbols
+}
+
+func (s *scope) add(name string, defined bool) {
+	s.locals[name] = &local{slot: s.size, defined: defined}
+	s.size++
 }
\ No newline at end of file
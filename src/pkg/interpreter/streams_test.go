@@ -0,0 +1,62 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStreams(t *testing.T) {
+	source := `var name = input("name? ");
+print "hi " + name;
+print readLine();
+print readLine();
+print 1 - nil;
+`
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			var output, diagnostics bytes.Buffer
+			err := interpret(b.newBackend(streams{output: &output, diagnostics: &diagnostics, input: strings.NewReader("lox\nlast")}), "", source)
+			if err == nil {
+				t.Fatal("expected a runtime error")
+			}
+
+			// The prompt goes to the output, and readLine gives nil at the end
+			// of the input
+			if output.String() != "name? hi lox\nlast\nnil\n" {
+				t.Errorf("output %q", output.String())
+			}
+			if !strings.HasPrefix(diagnostics.String(), "Runtime error at [line 5, column 9]: Operands must be numbers.") {
+				t.Errorf("diagnostics %q", diagnostics.String())
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	source := "{\n  var a = 1;\n  var a = 2;\n  print a;\n}\n"
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			var output, diagnostics bytes.Buffer
+			err := interpret(b.newBackend(streams{output: &output, diagnostics: &diagnostics}), "", source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != "2\n" || !strings.Contains(diagnostics.String(), "Already a variable with this name in this scope.") {
+				t.Errorf("output %q, diagnostics %q", output.String(), diagnostics.String())
+			}
+
+			// A handler gets warnings instead of the diagnostics stream
+			var warnings []error
+			diagnostics.Reset()
+			handle := func(err error) { warnings = append(warnings, err) }
+			err = interpret(b.newBackend(streams{diagnostics: &diagnostics, warnings: handle}), "", source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != 1 || diagnostics.Len() != 0 {
+				t.Errorf("warnings %v, diagnostics %q", warnings, diagnostics.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package interpreter
+
+import (
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type SymbolKind int
+
+const (
+	VARIABLE_SYMBOL SymbolKind = iota
+	FUNCTION_SYMBOL
+	CLASS_SYMBOL
+	METHOD_SYMBOL
+	PARAMETER_SYMBOL
+	IMPORT_SYMBOL
+	CATCH_SYMBOL // the error variable of a catch block
+)
+
+// Symbol is a name declared in a program, as found by the resolver, along
+// with every place it is referenced
+type Symbol struct {
+	Name token.Token
+	Kind SymbolKind
+	Span token.Span // the whole declaration, e.g. a function with its body
+	Scope token.Span // the block, function or class it is declared in; zero for globals
+	Params []token.Token // of functions and methods
+	Superclass string // of classes that have one
+	Class *Symbol // the class a method belongs to
+	Module string // the path of the module an import binds, or a name comes from
+	Alias bool // whether an import binds the whole module
+	References []token.Token
+}
+
+// Symbols is what the resolver records about the names in a program when
+// asked to with Resolver.RecordSymbols. Methods are recorded too, though
+// they're only ever referenced through properties, which aren't resolved.
+type Symbols struct {
+	All []*Symbol // in the order they were declared
+	Warnings []error // reported by the resolver while recording
+
+	globals map[string]*Symbol
+	unresolved []token.Token // references to globals that may be declared later
+}
+
+func newSymbols() *Symbols {
+	return &Symbols{globals: make(map[string]*Symbol)}
+}
+
+func (s *Symbols) add(symbol *Symbol) {
+	s.All = append(s.All, symbol)
+	if symbol.Scope == (token.Span{}) && symbol.Kind != METHOD_SYMBOL {
+		// A redeclared global keeps its first declaration
+		if _, ok := s.globals[symbol.Name.Lexeme]; !ok {
+			s.globals[symbol.Name.Lexeme] = symbol
+		}
+	}
+}
+
+// Globals are late bound, so a reference can come before the declaration it
+// refers to. They're matched up by name once the whole program is resolved.
+func (s *Symbols) link() {
+	for _, name := range s.unresolved {
+		if global, ok := s.globals[name.Lexeme]; ok {
+			global.References = append(global.References, name)
+		}
+	}
+	s.unresolved = nil
+}
+
+// Returns the symbol declared or referenced by the token at offset, or nil
+func (s *Symbols) At(offset int) *Symbol {
+	s.link()
+	within := func(tok token.Token) bool {
+		return tok.Start <= offset && offset <= tok.End
+	}
+
+	for _, symbol := range s.All {
+		if within(symbol.Name) {
+			return symbol
+		}
+		for _, reference := range symbol.References {
+			if within(reference) {
+				return symbol
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the symbols that can be referred to by name at offset: globals
+// anywhere, and locals after their declaration within their scope. Where a
+// local shadows another symbol only the innermost is returned.
+func (s *Symbols) Visible(offset int) []*Symbol {
+	visible := []*Symbol{}
+	index := make(map[string]int)
+	for _, symbol := range s.All {
+		if symbol.Kind == METHOD_SYMBOL {
+			continue
+		}
+
+		global := symbol.Scope == (token.Span{})
+		if !global && (offset < symbol.Name.End || offset >= symbol.Scope.End) {
+			continue
+		}
+
+		i, ok := index[symbol.Name.Lexeme]
+		if !ok {
+			index[symbol.Name.Lexeme] = len(visible)
+			visible = append(visible, symbol)
+		} else if !global && (visible[i].Scope == (token.Span{}) || symbol.Scope.Start >= visible[i].Scope.Start) {
+			// Scopes nest, so the one starting last is innermost
+			visible[i] = symbol
+		}
+	}
+	return visible
+}
@@ -0,0 +1,74 @@
+package interpreter
+
+import (
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// frame is a call to a Lox function that hasn't returned yet
+type frame struct {
+	function string
+	call token.Token // closing paren of the call, in the caller
+	defined int // line the callee was declared on
+	file string // imported module the callee is in, empty for the file being run
+	caller *Interpreter // running the call, for debuggers
+	env *Env // of the caller at the call
+}
+
+// callStack records the Lox calls in progress so runtime errors can show
+// how they were reached. It is shared with imported modules.
+type callStack struct {
+	frames []frame
+}
+
+func newCallStack() *callStack {
+	return &callStack{}
+}
+
+func (c *callStack) push(f frame) {
+	c.frames = append(c.frames, f)
+}
+
+func (c *callStack) pop() {
+	c.frames = c.frames[:len(c.frames) - 1]
+}
+
+// Attaches the current call stack to a runtime error raised inside the
+// innermost frame. Errors that already have a trace are left alone, so it
+// is taken where the error was raised rather than where it was caught.
+func (c *callStack) attach(err error) error {
+	runtimeError, ok := err.(*lox_error.RuntimeError)
+	if !ok || runtimeError.Trace != nil || len(c.frames) == 0 {
+		return err
+	}
+
+	// Each frame is at the line of the call into the frame after it
+	trace := make([]lox_error.Frame, 0, len(c.frames) + 1)
+	line := runtimeError.Token.Line
+	for i := len(c.frames) - 1; i >= 0; i-- {
+		trace = append(trace, lox_error.Frame{Function: c.frames[i].function, Line: line, Defined: c.frames[i].defined, File: c.frames[i].file})
+		line = c.frames[i].call.Line
+	}
+	trace = append(trace, lox_error.Frame{Function: "<script>", Line: line, File: c.frames[0].caller.modulePath()})
+
+	runtimeError.Trace = trace
+	return err
+}
+
+// Describes a call to callee for the call stack, or returns false if calling
+// it doesn't run any Lox code, as with natives and classes without an
+// initializer
+func frameFor(callee Callable) (frame, bool) {
+	switch callee := callee.(type) {
+	case *Function:
+		return frame{function: callee.Name(), defined: callee.declaration.Name.Line, file: callee.owner.modulePath()}, true
+	case *Class:
+		initializer, err := callee.FindMethod("init")
+		if err != nil {
+			return frame{}, false
+		}
+		return frameFor(initializer)
+	}
+
+	return frame{}, false
+}
@@ -0,0 +1,100 @@
+package interpreter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+)
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		expected []lox_error.Frame
+	}{
+		{
+			"functions",
+			"fun add(a, b) {\n  return a + b;\n}\nfun main() {\n  return add(1, nil);\n}\nmain();\n",
+			[]lox_error.Frame{{Function: "add", Line: 2, Defined: 1}, {Function: "main", Line: 5, Defined: 4}, {Function: "<script>", Line: 7}},
+		},
+		{
+			"methods",
+			"class Point {\n  init(x) {\n    this.x = x;\n    this.check();\n  }\n  check() {\n    return -this.x;\n  }\n}\nPoint(\"a\");\n",
+			[]lox_error.Frame{{Function: "Point.check", Line: 7, Defined: 6}, {Function: "Point.init", Line: 4, Defined: 2}, {Function: "<script>", Line: 10}},
+		},
+		{
+			"inherited methods",
+			"class A {\n  fail() { return nil.x; }\n}\nclass B < A {\n  fail() {\n    return super.fail();\n  }\n}\nclass C < B {}\nC().fail();\n",
+			[]lox_error.Frame{{Function: "A.fail", Line: 2, Defined: 2}, {Function: "B.fail", Line: 6, Defined: 5}, {Function: "<script>", Line: 10}},
+		},
+		{
+			"lambdas",
+			"var f = fun (x) {\n  return x.y;\n};\nfun g() { return f(1); }\ng();\n",
+			[]lox_error.Frame{{Function: "anonymous", Line: 2, Defined: 1}, {Function: "g", Line: 4, Defined: 4}, {Function: "<script>", Line: 5}},
+		},
+		{
+			"outside functions",
+			"fun ok() { return 1; }\nok();\nprint ok() + nil;\n",
+			nil,
+		},
+		{
+			"after a caught error",
+			"fun f() { return nil - 1; }\ntry { f(); } catch (e) {}\nprint -nil;\n",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		for _, b := range backends {
+			t.Run(b.name + "/" + test.name, func(t *testing.T) {
+				err := interpret(b.newBackend(streams{}), "", test.source)
+				runtimeError, ok := err.(*lox_error.RuntimeError)
+				if !ok {
+					t.Fatalf("expected a runtime error, got %v", err)
+				}
+
+				if len(runtimeError.Trace) != len(test.expected) {
+					t.Fatalf("trace: %+v", runtimeError.Trace)
+				}
+				for i, frame := range test.expected {
+					if runtimeError.Trace[i] != frame {
+						t.Errorf("frame %d: expected %+v, got %+v", i, frame, runtimeError.Trace[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+// Deep recursion is traced in full, and shortened only when rendered
+func TestTraceRecursion(t *testing.T) {
+	source := "fun r(n) {\n  if (n == 0) return nil.x;\n  return r(n - 1);\n}\nr(30);\n"
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			err := interpret(b.newBackend(streams{}), "", source)
+			runtimeError, ok := err.(*lox_error.RuntimeError)
+			if !ok {
+				t.Fatalf("expected a runtime error, got %v", err)
+			}
+			if len(runtimeError.Trace) != 32 {
+				t.Fatalf("expected 32 frames, got %d", len(runtimeError.Trace))
+			}
+
+			lines := strings.Split(lox_error.Render(err, source), "\n")
+			expected := []string{
+				"Runtime error at [line 2, column 26]: Only instances have properties.",
+				"    2 |   if (n == 0) return nil.x;",
+				"      |                          ^",
+				"  at r (line 2)",
+				"  called from r (line 3)",
+			}
+			if strings.Join(lines[:len(expected)], "\n") != strings.Join(expected, "\n") {
+				t.Errorf("rendered:\n%s", strings.Join(lines, "\n"))
+			}
+			if !strings.Contains(strings.Join(lines, "\n"), "\n  ... 12 more calls\n") || lines[len(lines) - 1] != "  called from <script> (line 5)" {
+				t.Errorf("rendered:\n%s", strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
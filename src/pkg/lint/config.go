@@ -0,0 +1,77 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigFile is the name of the config file FindConfig looks for
+const ConfigFile = ".gloxlint.json"
+
+// Config sets the severity of rules, overriding their defaults. It's read
+// from JSON such as:
+//
+//	{"rules": {"shadowed-variable": "off", "unused-parameter": "warning"}}
+type Config struct {
+	severities map[string]Severity
+}
+
+// Reads a config file, rejecting rules and severities it doesn't know
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Rules map[string]string `json:"rules"`
+	}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	config := &Config{severities: make(map[string]Severity)}
+	for id, name := range file.Rules {
+		if _, ok := findRule(id); !ok {
+			return nil, fmt.Errorf("%s: unknown rule %q", path, id)
+		}
+		severity, err := ParseSeverity(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %v", path, id, err)
+		}
+		config.severities[id] = severity
+	}
+	return config, nil
+}
+
+// Finds the config file in dir or the nearest directory above it
+func FindConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, ConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func (c *Config) severity(rule string) Severity {
+	if c != nil {
+		if severity, ok := c.severities[rule]; ok {
+			return severity
+		}
+	}
+	r, _ := findRule(rule)
+	return r.Severity
+}
@@ -0,0 +1,213 @@
+// Package lint finds likely mistakes in Lox programs that aren't errors:
+// unused variables, unreachable code, conditions that never change and the
+// like. Each finding comes from a rule with an ID, so rules can be turned
+// off or made more severe in a config file and silenced on a line with a
+// comment:
+//
+//	var unused = 1; // lint:ignore unused-variable
+package lint
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type Severity int
+
+const (
+	OFF Severity = iota
+	INFO
+	WARNING
+	ERROR
+)
+
+var severityNames = []string{"off", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for i, severityName := range severityNames {
+		if name == severityName {
+			return Severity(i), nil
+		}
+	}
+	return OFF, fmt.Errorf("unknown severity %q, expected one of %s", name, strings.Join(severityNames, ", "))
+}
+
+type Rule struct {
+	ID string
+	Severity Severity // unless configured otherwise
+	Description string
+}
+
+var Rules = []Rule{
+	{"unused-variable", WARNING, "A local variable, function or class is declared but never used."},
+	{"unused-parameter", INFO, "A parameter is never used. Prefix its name with _ to show that's intended."},
+	{"unreachable-code", WARNING, "A statement comes after a return, break, continue or throw, so it never runs."},
+	{"shadowed-variable", INFO, "A local variable hides another of the same name in an enclosing scope."},
+	{"redeclared-variable", WARNING, "A local variable is declared twice in the same scope."},
+	{"undeclared-assignment", ERROR, "A variable is assigned to but never declared, which fails when it runs."},
+	{"constant-condition", WARNING, "An if, while or ternary condition is a literal, so it is always true or always false."},
+	{"this-misuse", ERROR, "'this' or 'super' is used outside a class, or 'super' in a class without a superclass."},
+	{"resolve-error", ERROR, "The program can't be resolved, e.g. it returns from top-level code."},
+}
+
+func findRule(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Diagnostic is a finding, at the token it is about
+type Diagnostic struct {
+	Rule string
+	Severity Severity
+	Message string
+	Token token.Token
+}
+
+// Formats a diagnostic as path:line:column: severity: message (rule)
+func (d Diagnostic) Format(path string) string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", path, d.Token.Line, d.Token.Column, d.Severity, d.Message, d.Rule)
+}
+
+// Converts a diagnostic about source, read from path, to the form shared
+// with errors
+func (d Diagnostic) Structured(path string, source string) lox_error.Diagnostic {
+	text := d.Token.Lexeme
+	if text == "" && d.Token.Start >= 0 && d.Token.Start <= d.Token.End && d.Token.End <= len(source) {
+		text = source[d.Token.Start:d.Token.End]
+	}
+	return lox_error.Diagnostic{
+		Kind: "lint",
+		Code: d.Rule,
+		Severity: d.Severity.String(),
+		Message: d.Message,
+		File: path,
+		Line: d.Token.Line,
+		Column: d.Token.Column,
+		Span: lox_error.TokenSpan(d.Token, text),
+	}
+}
+
+// Lints source with the given config, or the defaults if it's nil. Source
+// that doesn't parse returns its syntax errors instead.
+func Source(source string, config *Config) ([]Diagnostic, error) {
+	scan := scanner.NewScanner(source)
+	tokens, err := scan.ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	for _, statement := range statements {
+		l.statement(statement)
+	}
+
+	// The resolver binds variables to their declarations, which the scope
+	// rules need. It carries on past errors so the rules still cover the
+	// rest of the program.
+	ip := interpreter.NewInterpreter(interpreter.WithOutput(io.Discard), interpreter.WithDiagnostics(io.Discard))
+	resolver := interpreter.NewResolver(ip)
+	resolver.ContinueOnError()
+	symbols := resolver.RecordSymbols()
+	_, err = resolver.ResolveStmts(statements)
+	if err != nil {
+		l.resolveError(err)
+	}
+	for _, err := range resolver.Errors() {
+		l.resolveError(err)
+	}
+	l.scopes(symbols)
+	l.assignments(symbols)
+
+	diagnostics := []Diagnostic{}
+	ignored := suppressions(source, scan.Comments())
+	for _, d := range l.diagnostics {
+		d.Severity = config.severity(d.Rule)
+		if d.Severity == OFF || ignored.has(d.Token.Line, d.Rule) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Token.Start < diagnostics[j].Token.Start })
+	return diagnostics, nil
+}
+
+// Resolution errors the walk already reported, such as 'this' outside a
+// class, aren't reported again
+func (l *linter) resolveError(err error) {
+	tok, _ := lox_error.ErrorToken(err)
+	for _, d := range l.diagnostics {
+		if d.Token.Start == tok.Start && d.Token.Line == tok.Line {
+			return
+		}
+	}
+
+	message := err.Error()
+	switch err := err.(type) {
+	case *lox_error.ParseError:
+		message = err.Message
+	case *lox_error.RuntimeError:
+		message = err.Message
+	}
+	l.report("resolve-error", tok, message)
+}
+
+// ignores are the rules silenced on each line, with "*" for every rule
+type ignores map[int]map[string]bool
+
+const ignoreDirective = "lint:ignore"
+
+// Finds the lint:ignore comments in source, which name the rules to silence
+// or silence them all if they name none. A comment after code silences its
+// own line; a comment on a line of its own silences the next line.
+func suppressions(source string, comments []token.Token) ignores {
+	ignored := make(ignores)
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Lexeme, "//"))
+		if text != ignoreDirective && !strings.HasPrefix(text, ignoreDirective + " ") {
+			continue
+		}
+
+		line := comment.Line
+		lineStart := strings.LastIndexByte(source[:comment.Start], '\n') + 1
+		if strings.TrimSpace(source[lineStart:comment.Start]) == "" {
+			line++
+		}
+		if ignored[line] == nil {
+			ignored[line] = make(map[string]bool)
+		}
+
+		rules := strings.FieldsFunc(text[len(ignoreDirective):], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(rules) == 0 {
+			rules = []string{"*"}
+		}
+		for _, rule := range rules {
+			ignored[line][rule] = true
+		}
+	}
+	return ignored
+}
+
+func (ignored ignores) has(line int, rule string) bool {
+	return ignored[line]["*"] || ignored[line][rule]
+}
@@ -0,0 +1,108 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Lints source and returns each finding as line:rule
+func findings(t *testing.T, source string, config *Config) []string {
+	t.Helper()
+	diagnostics, err := Source(source, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, d := range diagnostics {
+		found = append(found, fmt.Sprintf("%d:%s", d.Token.Line, d.Rule))
+	}
+	return found
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		expected []string
+	}{
+		{"unused", "fun f(a, b, _c) {\n  var unused = 1;\n  var _spare = 2;\n  return a;\n}\n", []string{"1:unused-parameter", "2:unused-variable"}},
+		{"globals are never unused", "var x = 1;\nfun f() {}\n", []string{}},
+		{"catch variables are never unused", "try {\n  throw 1;\n} catch (e) {\n  print 2;\n}\n", []string{}},
+		{"unreachable", "fun f(x) {\n  if (x) return 1; else return 2;\n  print x;\n  print x;\n}\n", []string{"3:unreachable-code"}},
+		{"unreachable after break", "while (1 < 2) {\n  break;\n  print 1;\n}\n", []string{"3:unreachable-code"}},
+		{"shadowed", "fun f(x) {\n  {\n    var x = 1;\n    print x;\n  }\n  return x;\n}\n", []string{"3:shadowed-variable"}},
+		{"redeclared", "{\n  var a = 1;\n  var a = 2;\n  print a;\n}\n", []string{"3:redeclared-variable"}},
+		{"undeclared assignment", "var declared;\ndeclared = 1;\nclock = 2;\nmissing = 3;\n", []string{"4:undeclared-assignment"}},
+		{"constant conditions", "if (true) print 1;\nwhile ((nil)) print 2;\nwhile (true) break;\nfor (;;) break;\n", []string{"1:constant-condition", "2:constant-condition"}},
+		{"this outside a class", "fun f() {\n  return this;\n}\n", []string{"2:this-misuse"}},
+		{"super without a superclass", "class A {\n  m() {\n    return super.m();\n  }\n}\n", []string{"3:this-misuse"}},
+		{"this in a method", "class A {\n  m() {\n    return fun () { return this; };\n  }\n}\n", []string{}},
+		{"resolve error", "return 1;\n", []string{"1:resolve-error"}},
+		{"scope rules after a resolve error", "return 1;\nfun f() {\n  var unused = 1;\n  missing = 2;\n}\n", []string{"1:resolve-error", "3:unused-variable", "4:undeclared-assignment"}},
+		{"every resolve error", "class A {\n  init() {\n    return 1;\n  }\n}\nfun f() {\n  var a = a;\n  print a;\n}\nreturn 2;\n", []string{"3:resolve-error", "7:resolve-error", "10:resolve-error"}},
+		{"scope rules with this outside a class", "fun f(a) {\n  return this;\n}\n", []string{"1:unused-parameter", "2:this-misuse"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found := findings(t, test.source, nil)
+			if !reflect.DeepEqual(found, test.expected) {
+				t.Errorf("expected %v, found %v", test.expected, found)
+			}
+		})
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	source := `{
+  var a = 1; // lint:ignore unused-variable
+  var b = 2; // lint:ignore
+  // lint:ignore shadowed-variable, unused-variable
+  var c = 3;
+  var d = 4; // lint:ignore shadowed-variable
+}
+`
+	found := findings(t, source, nil)
+	if !reflect.DeepEqual(found, []string{"6:unused-variable"}) {
+		t.Errorf("found %v", found)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ConfigFile)
+	err := os.WriteFile(path, []byte(`{"rules": {"unused-parameter": "off", "unused-variable": "error"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The config is found from directories below it
+	nested := filepath.Join(dir, "src", "lib")
+	os.MkdirAll(nested, 0755)
+	found, ok := FindConfig(nested)
+	if !ok || found != path {
+		t.Fatalf("found %q", found)
+	}
+
+	config, err := LoadConfig(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics, err := Source("fun f(a) {\n  var b = 1;\n}\n", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Rule != "unused-variable" || diagnostics[0].Severity != ERROR {
+		t.Errorf("diagnostics: %v", diagnostics)
+	}
+
+	for _, bad := range []string{`{"rules": {"no-such-rule": "off"}}`, `{"rules": {"unused-variable": "loud"}}`, `{"rules": `} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("no error loading %s", bad)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/internal/ast"
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// linter walks a program checking the rules that only need its syntax, and
+// collects what the scope rules check once it's resolved
+type linter struct {
+	diagnostics []Diagnostic
+	class interpreter.ClassType // of the code being walked
+	assigns []ast.Assign
+}
+
+func (l *linter) report(rule string, tok token.Token, message string) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Rule: rule, Message: message, Token: tok})
+}
+
+// Reports a finding about a node, which has a span but no token of its own
+func (l *linter) reportAt(rule string, span token.Span, message string) {
+	l.report(rule, token.Token{Span: span}, message)
+}
+
+func (l *linter) statement(s stmt.Stmt) {
+	s.Accept(l)
+}
+
+func (l *linter) expression(e ast.Expr) {
+	if e != nil {
+		e.Accept(l)
+	}
+}
+
+// Walks a list of statements, reporting the first that can't be reached
+func (l *linter) statements(statements []stmt.Stmt) {
+	for i, s := range statements {
+		if i > 0 && terminates(statements[i - 1]) {
+			l.reportAt("unreachable-code", s.Span(), "Unreachable code.")
+			// Walk the rest, but only report the first unreachable statement
+			for _, rest := range statements[i:] {
+				l.statement(rest)
+			}
+			return
+		}
+		l.statement(s)
+	}
+}
+
+// Reports whether control never goes past s to the next statement
+func terminates(s stmt.Stmt) bool {
+	switch s := s.(type) {
+	case *stmt.Return, *stmt.Break, *stmt.Continue, *stmt.Throw:
+		return true
+	case *stmt.Block:
+		for _, inner := range s.Statements {
+			if terminates(inner) {
+				return true
+			}
+		}
+	case *stmt.If:
+		return s.ElseBranch != nil && terminates(s.ThenBranch) && terminates(s.ElseBranch)
+	case *stmt.Try:
+		if s.Finally != nil && terminates(s.Finally) {
+			return true
+		}
+		return terminates(s.Body) && s.Catch != nil && terminates(s.Catch)
+	}
+	return false
+}
+
+// Reports a condition that is a literal, except the true of an infinite
+// while or for loop
+func (l *linter) condition(condition ast.Expr, loop bool) {
+	for {
+		grouping, ok := condition.(*ast.Grouping)
+		if !ok {
+			break
+		}
+		condition = grouping.Expression
+	}
+
+	literal, ok := condition.(*ast.Literal)
+	if !ok || (loop && literal.Value == true) {
+		return
+	}
+	if literal.Value == nil || literal.Value == false {
+		l.reportAt("constant-condition", literal.Span(), "Condition is always false.")
+	} else {
+		l.reportAt("constant-condition", literal.Span(), "Condition is always true.")
+	}
+}
+
+func (l *linter) function(function stmt.Function) {
+	l.statements(function.Body)
+}
+
+func (l *linter) VisitExpressionStmt(s stmt.Expression) error {
+	l.expression(s.Expr)
+	return nil
+}
+
+func (l *linter) VisitPrintStmt(s stmt.Print) error {
+	l.expression(s.Expr)
+	return nil
+}
+
+func (l *linter) VisitVarStmt(s stmt.Var) error {
+	l.expression(s.Initializer)
+	return nil
+}
+
+func (l *linter) VisitBlockStmt(s stmt.Block) error {
+	l.statements(s.Statements)
+	return nil
+}
+
+func (l *linter) VisitIfStmt(s stmt.If) error {
+	l.condition(s.Condition, false)
+	l.expression(s.Condition)
+	l.statement(s.ThenBranch)
+	if s.ElseBranch != nil {
+		l.statement(s.ElseBranch)
+	}
+	return nil
+}
+
+func (l *linter) VisitWhileStmt(s stmt.While) error {
+	l.condition(s.Condition, true)
+	l.expression(s.Condition)
+	l.statement(s.Body)
+	l.expression(s.Increment)
+	return nil
+}
+
+func (l *linter) VisitBreakStmt(s stmt.Break) error {
+	return nil
+}
+
+func (l *linter) VisitContinueStmt(s stmt.Continue) error {
+	return nil
+}
+
+func (l *linter) VisitFunctionStmt(s stmt.Function) error {
+	l.function(s)
+	return nil
+}
+
+func (l *linter) VisitReturnStmt(s stmt.Return) error {
+	l.expression(s.Value)
+	return nil
+}
+
+func (l *linter) VisitClassStmt(s stmt.Class) error {
+	enclosing := l.class
+	defer func() { l.class = enclosing }()
+
+	l.class = interpreter.CLASS
+	if s.Superclass != nil {
+		l.class = interpreter.SUBCLASS
+	}
+	for _, method := range s.Methods {
+		l.function(method)
+	}
+	return nil
+}
+
+func (l *linter) VisitImportStmt(s stmt.Import) error {
+	return nil
+}
+
+func (l *linter) VisitThrowStmt(s stmt.Throw) error {
+	l.expression(s.Value)
+	return nil
+}
+
+func (l *linter) VisitTryStmt(s stmt.Try) error {
+	l.statement(s.Body)
+	if s.Catch != nil {
+		l.statement(s.Catch)
+	}
+	if s.Finally != nil {
+		l.statement(s.Finally)
+	}
+	return nil
+}
+
+func (l *linter) VisitBinaryExpr(e ast.Binary) (any, error) {
+	l.expression(e.Left)
+	l.expression(e.Right)
+	return nil, nil
+}
+
+func (l *linter) VisitGroupingExpr(e ast.Grouping) (any, error) {
+	l.expression(e.Expression)
+	return nil, nil
+}
+
+func (l *linter) VisitLiteralExpr(e ast.Literal) (any, error) {
+	return nil, nil
+}
+
+func (l *linter) VisitUnaryExpr(e ast.Unary) (any, error) {
+	l.expression(e.Right)
+	return nil, nil
+}
+
+func (l *linter) VisitTernaryExpr(e ast.Ternary) (any, error) {
+	l.condition(e.Condition, false)
+	l.expression(e.Condition)
+	l.expression(e.Left)
+	l.expression(e.Right)
+	return nil, nil
+}
+
+func (l *linter) VisitVariableExpr(e ast.Variable) (any, error) {
+	return nil, nil
+}
+
+func (l *linter) VisitAssignExpr(e ast.Assign) (any, error) {
+	// Checked once the resolver has bound it
+	l.assigns = append(l.assigns, e)
+	l.expression(e.Value)
+	return nil, nil
+}
+
+func (l *linter) VisitLogicalExpr(e ast.Logical) (any, error) {
+	l.expression(e.Left)
+	l.expression(e.Right)
+	return nil, nil
+}
+
+func (l *linter) VisitCallExpr(e ast.Call) (any, error) {
+	l.expression(e.Callee)
+	for _, argument := range e.Arguments {
+		l.expression(argument)
+	}
+	return nil, nil
+}
+
+func (l *linter) VisitGetExpr(e ast.Get) (any, error) {
+	l.expression(e.Object)
+	return nil, nil
+}
+
+func (l *linter) VisitSetExpr(e ast.Set) (any, error) {
+	l.expression(e.Object)
+	l.expression(e.Value)
+	return nil, nil
+}
+
+func (l *linter) VisitThisExpr(e ast.This) (any, error) {
+	if l.class == interpreter.NONE_CLASS {
+		l.report("this-misuse", e.Keyword, "Can't use 'this' outside of a class.")
+	}
+	return nil, nil
+}
+
+func (l *linter) VisitSuperExpr(e ast.Super) (any, error) {
+	if l.class == interpreter.NONE_CLASS {
+		l.report("this-misuse", e.Keyword, "Can't use 'super' outside of a class.")
+	} else if l.class != interpreter.SUBCLASS {
+		l.report("this-misuse", e.Keyword, "Can't use 'super' in a class with no superclass.")
+	}
+	return nil, nil
+}
+
+func (l *linter) VisitLambdaExpr(e ast.Lambda) (any, error) {
+	l.statements(e.Body.([]stmt.Stmt))
+	return nil, nil
+}
+
+func (l *linter) VisitListExpr(e ast.List) (any, error) {
+	for _, element := range e.Elements {
+		l.expression(element)
+	}
+	return nil, nil
+}
+
+func (l *linter) VisitSubscriptExpr(e ast.Subscript) (any, error) {
+	l.expression(e.Object)
+	l.expression(e.Index)
+	return nil, nil
+}
+
+func (l *linter) VisitSetSubscriptExpr(e ast.SetSubscript) (any, error) {
+	l.expression(e.Object)
+	l.expression(e.Index)
+	l.expression(e.Value)
+	return nil, nil
+}
+
+func (l *linter) VisitMapExpr(e ast.Map) (any, error) {
+	for i := range e.Keys {
+		l.expression(e.Keys[i])
+		l.expression(e.Values[i])
+	}
+	return nil, nil
+}
+
+// Checks the locals the resolver found for ones that are never used or
+// that shadow another
+func (l *linter) scopes(symbols *interpreter.Symbols) {
+	for _, warning := range symbols.Warnings {
+		if err, ok := warning.(*lox_error.LoxError); ok {
+			l.report("redeclared-variable", err.Token, fmt.Sprintf("'%s' is already declared in this scope.", err.Token.Lexeme))
+		}
+	}
+
+	// A redeclared variable's uses all go to its last declaration, so the
+	// earlier ones aren't reported as unused too
+	type declaration struct {
+		scope token.Span
+		name string
+	}
+	declarations := make(map[declaration]int)
+	for _, symbol := range symbols.All {
+		declarations[declaration{symbol.Scope, symbol.Name.Lexeme}]++
+	}
+
+	for _, symbol := range symbols.All {
+		local := symbol.Scope != (token.Span{})
+		if !local || symbol.Kind == interpreter.METHOD_SYMBOL {
+			continue
+		}
+		name := symbol.Name.Lexeme
+		redeclared := declarations[declaration{symbol.Scope, name}] > 1
+
+		if len(symbol.References) == 0 && !redeclared && !strings.HasPrefix(name, "_") {
+			switch symbol.Kind {
+			case interpreter.PARAMETER_SYMBOL:
+				l.report("unused-parameter", symbol.Name, fmt.Sprintf("Parameter '%s' is never used.", name))
+			case interpreter.VARIABLE_SYMBOL, interpreter.FUNCTION_SYMBOL, interpreter.CLASS_SYMBOL, interpreter.IMPORT_SYMBOL:
+				l.report("unused-variable", symbol.Name, fmt.Sprintf("'%s' is declared but never used.", name))
+			}
+		}
+
+		for _, outer := range symbols.Visible(symbol.Name.Start) {
+			if outer.Name.Lexeme == name && outer.Scope != (token.Span{}) && outer.Scope != symbol.Scope {
+				l.report("shadowed-variable", symbol.Name, fmt.Sprintf("'%s' shadows the variable declared on line %d.", name, outer.Name.Line))
+			}
+		}
+	}
+}
+
+// Reports assignments to globals that are never declared, which fail when
+// they run
+func (l *linter) assignments(symbols *interpreter.Symbols) {
+	declared := make(map[string]bool)
+	for _, name := range interpreter.Natives() {
+		declared[name] = true
+	}
+	for _, symbol := range symbols.All {
+		if symbol.Scope == (token.Span{}) {
+			declared[symbol.Name.Lexeme] = true
+		}
+	}
+
+	for _, assign := range l.assigns {
+		if assign.Binding.Depth < 0 && !declared[assign.Name.Lexeme] {
+			l.report("undeclared-assignment", assign.Name, fmt.Sprintf("Assignment to undeclared variable '%s'.", assign.Name.Lexeme))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package lox_error
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Diagnostic is an error in a structured form, for tools that would otherwise
+// have to pick apart its message
+type Diagnostic struct {
+	Kind string `json:"kind"` // syntax, resolve, compile, runtime, exception, interrupt, lint or error
+	Code string `json:"code"` // identifies the kind of error, or the lint rule
+	Severity string `json:"severity"` // error, warning or info
+	Message string `json:"message"`
+	File string `json:"file,omitempty"` // the imported module an error is in, or the file being run
+	Line int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	Span *Span `json:"span,omitempty"` // unless the error has no position in the source
+	Trace []Frame `json:"trace,omitempty"` // for runtime errors raised inside functions
+}
+
+// Span is the part of the source a diagnostic is about: byte offsets with End
+// exclusive, and the line and column End is at
+type Span struct {
+	Start int `json:"start"`
+	End int `json:"end"`
+	EndLine int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+// The code of each kind of error. Lint findings use their rule ID instead.
+var codes = map[string]string{
+	"error": "GLOX000", // not from Lox, e.g. a file that can't be read
+	"compile": "GLOX001",
+	"syntax": "GLOX002",
+	"runtime": "GLOX003",
+	"exception": "GLOX004",
+	"interrupt": "GLOX005",
+	"resolve": "GLOX006",
+}
+
+// Converts err, found in file, to diagnostics: one for each error in an
+// ErrorList and one for anything else
+func Diagnostics(err error, file string) []Diagnostic {
+	if list, ok := err.(ErrorList); ok {
+		diagnostics := []Diagnostic{}
+		for _, err := range list {
+			diagnostics = append(diagnostics, Diagnostics(err, file)...)
+		}
+		return diagnostics
+	}
+	return []Diagnostic{NewDiagnostic(err, file)}
+}
+
+// Converts an error found running file to a diagnostic. Its message doesn't
+// repeat the position the way Error() does. An error in a module that file
+// imported is attributed to the module.
+func NewDiagnostic(err error, file string) Diagnostic {
+	d := Diagnostic{Kind: "error", Severity: "error", Message: err.Error(), File: file}
+	if kind, ok := KindOf(err); ok {
+		d.Kind = string(kind)
+	}
+	if module := ErrorFile(err); module != "" {
+		d.File = DisplayFile(module)
+	}
+
+	switch err := err.(type) {
+	case *LoxError:
+		// The message starts with the position, e.g. " at 'x': "
+		d.Message = strings.TrimPrefix(err.Message, " at end: ")
+		d.Message = strings.TrimPrefix(d.Message, " at '" + err.Token.Lexeme + "': ")
+	case *ParseError:
+		d.Message = err.Message
+	case *CompileError:
+		d.Message = err.Message
+	case *RuntimeError:
+		d.Message = err.Message
+		// Every frame names its file, since they may be in different modules
+		for _, frame := range err.Trace {
+			if frame.File == "" {
+				frame.File = file
+			} else {
+				frame.File = DisplayFile(frame.File)
+			}
+			d.Trace = append(d.Trace, frame)
+		}
+	case ThrowError:
+		d.Message = "Uncaught exception: nil"
+		if err.Value != nil {
+			d.Message = fmt.Sprintf("Uncaught exception: %v", err.Value)
+		}
+	case *InterruptError:
+		d.Message = err.Message
+	}
+	d.Code = codes[d.Kind]
+
+	if tok, ok := ErrorToken(err); ok {
+		d.Line = tok.Line
+		d.Column = tok.Column
+		d.Span = TokenSpan(tok, tok.Lexeme)
+	}
+	return d
+}
+
+// Returns the span of a token with the given text, or nil if the token
+// wasn't scanned from source
+func TokenSpan(tok token.Token, text string) *Span {
+	if tok.Column == 0 {
+		return nil
+	}
+	span := &Span{Start: tok.Start, End: tok.End, EndLine: tok.Line, EndColumn: tok.Column + len(text)}
+	if newlines := strings.Count(text, "\n"); newlines > 0 {
+		span.EndLine += newlines
+		span.EndColumn = len(text) - strings.LastIndexByte(text, '\n')
+	}
+	if tok.End == tok.Start {
+		span.EndColumn = tok.Column
+	}
+	return span
+}
+
+// Writes diagnostics as a JSON array
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
@@ -0,0 +1,151 @@
+package lox_error
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+func TestDiagnostics(t *testing.T) {
+	at := token.Token{Type: token.IDENTIFIER, Lexeme: "name", Span: token.Span{Line: 2, Column: 5, Start: 10, End: 14}}
+	list := ErrorList{
+		NewError(at, "Unexpected character."),
+		NewParseError(at, "Expect ';' after value."),
+		NewResolveError(at, "Can't return from top-level code."),
+		NewCompileError(at, "Too many constants in one chunk."),
+	}
+	runtime := NewRuntimeError(at, "Undefined variable 'name'.")
+	runtime.Trace = []Frame{{Function: "f", Line: 2, Defined: 1}}
+
+	diagnostics := append(Diagnostics(list, "a.lox"), Diagnostics(runtime, "a.lox")...)
+	diagnostics = append(diagnostics, NewDiagnostic(errors.New("can't read"), "b.lox"))
+
+	expected := []struct{ kind, code, message string }{
+		{"syntax", "GLOX002", "Unexpected character."},
+		{"syntax", "GLOX002", "Expect ';' after value."},
+		{"resolve", "GLOX006", "Can't return from top-level code."},
+		{"compile", "GLOX001", "Too many constants in one chunk."},
+		{"runtime", "GLOX003", "Undefined variable 'name'."},
+		{"error", "GLOX000", "can't read"},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("diagnostics: %v", diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.Kind != expected[i].kind || d.Code != expected[i].code || d.Message != expected[i].message {
+			t.Errorf("diagnostic %d: %+v", i, d)
+		}
+	}
+
+	span := diagnostics[0].Span
+	if span == nil || span.Start != 10 || span.End != 14 || span.EndLine != 2 || span.EndColumn != 9 {
+		t.Errorf("span: %+v", span)
+	}
+	if diagnostics[5].Span != nil || diagnostics[5].Line != 0 {
+		t.Errorf("an error without a token has a position: %+v", diagnostics[5])
+	}
+	if len(diagnostics[4].Trace) != 1 || diagnostics[4].Trace[0].File != "a.lox" {
+		t.Errorf("trace: %+v", diagnostics[4].Trace)
+	}
+}
+
+// Errors in an imported module are attributed to the module, as are the
+// frames of its functions
+func TestModuleDiagnostics(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := filepath.Join(wd, "lib", "util.lox")
+
+	at := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Span: token.Span{Line: 1, Column: 1, End: 1}}
+	runtime := NewRuntimeError(at, "Operand must be a number.")
+	runtime.Trace = []Frame{{Function: "f", Line: 1, Defined: 1, File: module}, {Function: "<script>", Line: 4}}
+	InModule(runtime, module)
+
+	d := NewDiagnostic(runtime, "main.lox")
+	expected := filepath.Join("lib", "util.lox")
+	if d.File != expected {
+		t.Errorf("file: %q", d.File)
+	}
+	if len(d.Trace) != 2 || d.Trace[0].File != expected || d.Trace[1].File != "main.lox" {
+		t.Errorf("trace: %+v", d.Trace)
+	}
+
+	syntax := NewDiagnostic(InModule(ErrorList{NewParseError(at, "Expect expression.")}, module).(ErrorList)[0], "main.lox")
+	if syntax.File != expected {
+		t.Errorf("file: %q", syntax.File)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	at := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Span: token.Span{Line: 3, Column: 7, Start: 20, End: 21}}
+	warning := NewDiagnostic(NewResolveWarning(at, "Already a variable with this name in this scope."), "dir/a.lox")
+	warning.Severity = "warning"
+	diagnostics := []Diagnostic{warning, NewDiagnostic(NewRuntimeError(at, "Operand must be a number."), "dir/a.lox")}
+
+	var out bytes.Buffer
+	err := WriteSARIF(&out, diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	err = json.Unmarshal(out.Bytes(), &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("log: %s", out.String())
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "GLOX003" || run.Tool.Driver.Rules[1].ID != "GLOX006" {
+		t.Errorf("rules: %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 || run.Results[0].Level != "warning" || run.Results[1].Level != "error" {
+		t.Fatalf("results: %+v", run.Results)
+	}
+	// The file can't be read, so the columns are left as they are
+	location := run.Results[1].Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "dir/a.lox" || location.Region.StartLine != 3 || location.Region.StartColumn != 7 || location.Region.CharOffset != nil {
+		t.Errorf("location: %+v %+v", location, location.Region)
+	}
+}
+
+// SARIF positions are in UTF-16 code units, not bytes
+func TestSARIFUTF16(t *testing.T) {
+	source := "var s = 1;\nprint \"é😀\" + x;\n"
+	path := filepath.Join(t.TempDir(), "a.lox")
+	err := os.WriteFile(path, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := strings.Index(source, "x;")
+	at := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Span: token.Span{Line: 2, Column: start - 11 + 1, Start: start, End: start + 1}}
+	var out bytes.Buffer
+	err = WriteSARIF(&out, []Diagnostic{NewDiagnostic(NewRuntimeError(at, "Undefined variable 'x'."), path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	err = json.Unmarshal(out.Bytes(), &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	region := log.Runs[0].Results[0].Locations[0].PhysicalLocation.Region
+	// "print \"é😀\" + " is 17 bytes but 14 code units: é is one, 😀 a surrogate pair
+	if region.StartColumn != 15 || region.EndColumn != 16 || *region.CharOffset != 11 + 14 || *region.CharLength != 1 {
+		t.Errorf("region: %+v offset %d length %d", region, *region.CharOffset, *region.CharLength)
+	}
+	if log.Runs[0].ColumnKind != "utf16CodeUnits" {
+		t.Errorf("column kind: %q", log.Runs[0].ColumnKind)
+	}
+}
@@ -2,34 +2,87 @@ package lox_error
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lidanielm/glox/src/pkg/token"
 )
 
+// Kind is the stage of running a program an error comes from. Tools report
+// it rather than working it out from the error's type.
+type Kind string
+
+const (
+	SYNTAX_ERROR Kind = "syntax" // scanning or parsing
+	RESOLVE_ERROR Kind = "resolve" // binding names, e.g. 'return' outside a function
+	COMPILE_ERROR Kind = "compile" // fitting a program into the VM's bytecode
+	RUNTIME_ERROR Kind = "runtime"
+	EXCEPTION Kind = "exception" // a value thrown by 'throw' that was never caught
+	INTERRUPT Kind = "interrupt"
+)
+
+// Returns the kind of a Lox error, or false for any other error
+func KindOf(err error) (Kind, bool) {
+	switch err := err.(type) {
+	case *LoxError:
+		return err.Kind, true
+	case *ParseError:
+		return err.Kind, true
+	case *CompileError:
+		return COMPILE_ERROR, true
+	case *RuntimeError:
+		return RUNTIME_ERROR, true
+	case ThrowError:
+		return EXCEPTION, true
+	case *InterruptError:
+		return INTERRUPT, true
+	}
+	return "", false
+}
+
 type LoxError struct {
 	Token token.Token
 	Message string
+	Kind Kind
+	File string // imported module the error is in, empty for the file being run
 }
 
+// Returns a syntax error found by the scanner
 func NewError(tok token.Token, msg string) *LoxError {
-	err := &LoxError{Token: tok}
+	return newError(SYNTAX_ERROR, tok, msg)
+}
+
+// Returns a warning found by the resolver, such as a variable declared twice
+func NewResolveWarning(tok token.Token, msg string) *LoxError {
+	return newError(RESOLVE_ERROR, tok, msg)
+}
+
+func newError(kind Kind, tok token.Token, msg string) *LoxError {
+	err := &LoxError{Token: tok, Kind: kind}
 	if tok.Type == token.EOF {
 		err.Message = " at end: " + msg
-		fmt.Println(err.Error())
 	} else {
 		err.Message = " at '" + tok.Lexeme + "': " + msg
-		fmt.Println(err.Error())
 	}
 	return err
 }
 
 func (e *LoxError) Error() string {
-	return fmt.Sprintf("Error at [line %d]: %s", e.Token.Line, e.Message)
+	return fmt.Sprintf("Error at %s: %s", location(e.File, e.Token), e.Message)
 }
 
 type RuntimeError struct {
 	Token token.Token
 	Message string
+	File string // imported module the error is in, empty for the file being run
+	Trace []Frame // Lox calls active when the error was raised, innermost first
+}
+
+// Frame is a Lox function call that was in progress when an error was raised
+type Frame struct {
+	Function string `json:"function"` // function name, or Class.method for methods
+	Line int `json:"line"` // line the function had reached: the error, or the call to the next frame
+	Defined int `json:"defined"` // line the function was declared on
+	File string `json:"file,omitempty"` // imported module the function is in, empty for the file being run
 }
 
 func NewRuntimeError(tok token.Token, msg string) *RuntimeError {
@@ -38,21 +91,130 @@ func NewRuntimeError(tok token.Token, msg string) *RuntimeError {
 }
 
 func (e *RuntimeError) Error() string {
-	return fmt.Sprintf("Runtime error at [line %d]: %s", e.Token.Line, e.Message)
+	return fmt.Sprintf("Runtime error at %s: %s", location(e.File, e.Token), e.Message)
 }
 
 type ParseError struct {
 	Token token.Token
 	Message string
+	Kind Kind // SYNTAX_ERROR or RESOLVE_ERROR
+	File string // imported module the error is in, empty for the file being run
 }
 
 func NewParseError(tok token.Token, message string) *ParseError {
-	err := &ParseError{Token: tok, Message: message}
+	err := &ParseError{Token: tok, Message: message, Kind: SYNTAX_ERROR}
 	return err
 }
 
+// Returns an error found by the resolver, which stops the program running
+func NewResolveError(tok token.Token, message string) *ParseError {
+	return &ParseError{Token: tok, Message: message, Kind: RESOLVE_ERROR}
+}
+
 func (e *ParseError) Error() string {
-	return fmt.Sprintf("Syntax error at [line %d] at '%v': %s", e.Token.Line, e.Token.Lexeme, e.Message)
+	stage := "Syntax"
+	if e.Kind == RESOLVE_ERROR {
+		stage = "Resolve"
+	}
+	return fmt.Sprintf("%s error at %s at '%v': %s", stage, location(e.File, e.Token), e.Token.Lexeme, e.Message)
+}
+
+// CompileError is a program the VM's compiler can't fit into bytecode, e.g.
+// a function with more locals than an instruction can address. The program
+// is valid Lox and runs on the tree-walker.
+type CompileError struct {
+	Token token.Token
+	Message string
+	File string // imported module the error is in, empty for the file being run
+}
+
+func NewCompileError(tok token.Token, message string) *CompileError {
+	return &CompileError{Token: tok, Message: message}
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("Compile error at %s: %s", location(e.File, e.Token), e.Message)
+}
+
+// Records that err was raised in the imported module at path, unless it
+// already names a file, e.g. a module imported by that one. Returns err.
+func InModule(err error, path string) error {
+	switch e := err.(type) {
+	case ErrorList:
+		for _, err := range e {
+			InModule(err, path)
+		}
+	case *LoxError:
+		if e.File == "" {
+			e.File = path
+		}
+	case *ParseError:
+		if e.File == "" {
+			e.File = path
+		}
+	case *CompileError:
+		if e.File == "" {
+			e.File = path
+		}
+	case *RuntimeError:
+		if e.File == "" {
+			e.File = path
+		}
+	case ThrowError:
+		// Thrown values are passed around as values, so return a copy
+		if e.File == "" {
+			e.File = path
+		}
+		return e
+	}
+	return err
+}
+
+// Returns the imported module an error was raised in, or "" if it was in
+// the file being run
+func ErrorFile(err error) string {
+	switch err := err.(type) {
+	case *LoxError:
+		return err.File
+	case *ParseError:
+		return err.File
+	case *CompileError:
+		return err.File
+	case *RuntimeError:
+		return err.File
+	case ThrowError:
+		return err.File
+	}
+	return ""
+}
+
+// ErrorList holds every error found in one pass over a file, in source order
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// InterruptError stops a script that was cancelled or ran past one of its
+// execution limits. Unlike RuntimeError, it can't be caught by Lox code.
+type InterruptError struct {
+	Message string
+}
+
+func NewInterruptError(message string) *InterruptError {
+	return &InterruptError{Message: message}
+}
+
+func (e *InterruptError) Error() string {
+	return "Execution stopped: " + e.Message
 }
 
 // BreakError is a special error type used to handle break statements
@@ -75,4 +237,18 @@ type ReturnError struct {
 
 func (r ReturnError) Error() string {
 	return "return"
+}
+
+// ThrowError carries a value thrown by a Lox 'throw' statement until it is caught
+type ThrowError struct {
+	Token token.Token
+	Value any
+	File string // imported module the error is in, empty for the file being run
+}
+
+func (t ThrowError) Error() string {
+	if t.Value == nil {
+		return fmt.Sprintf("Uncaught exception at %s: nil", location(t.File, t.Token))
+	}
+	return fmt.Sprintf("Uncaught exception at %s: %v", location(t.File, t.Token), t.Value)
 }
\ No newline at end of file
@@ -0,0 +1,163 @@
+package lox_error
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Formats where a token is, with its column when it came from the scanner
+// and its file when it's in an imported module
+func location(file string, tok token.Token) string {
+	where := fmt.Sprintf("line %d", tok.Line)
+	if tok.Column != 0 {
+		where += fmt.Sprintf(", column %d", tok.Column)
+	}
+	if file != "" {
+		where = DisplayFile(file) + ", " + where
+	}
+	return "[" + where + "]"
+}
+
+// Shows a module's path relative to the working directory where possible
+func DisplayFile(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// Returns the token an error points at, if it has one
+func ErrorToken(err error) (token.Token, bool) {
+	switch err := err.(type) {
+	case *LoxError:
+		return err.Token, true
+	case *ParseError:
+		return err.Token, true
+	case *CompileError:
+		return err.Token, true
+	case *RuntimeError:
+		return err.Token, true
+	case ThrowError:
+		return err.Token, true
+	}
+
+	return token.Token{}, false
+}
+
+// Formats an error followed by the line of source it points at, with the
+// offending token underlined:
+//
+//	Runtime error at [line 3, column 9]: Operands must be numbers.
+//	    3 | print a - "x";
+//	      |         ^
+//
+// Each error in an ErrorList is rendered in turn. The line of an error in an
+// imported module is read from that module rather than source.
+func Render(err error, source string) string {
+	if list, ok := err.(ErrorList); ok {
+		rendered := make([]string, len(list))
+		for i, err := range list {
+			rendered[i] = Render(err, source)
+		}
+		return strings.Join(rendered, "\n")
+	}
+
+	tok, ok := ErrorToken(err)
+	if !ok {
+		return err.Error()
+	}
+
+	if file := ErrorFile(err); file != "" {
+		// If the module can't be read, the error is shown without its line
+		data, _ := os.ReadFile(file)
+		source = string(data)
+	}
+
+	rendered := err.Error()
+	snippet := Snippet(source, tok)
+	if snippet != "" {
+		rendered += "\n" + snippet
+	}
+	if runtimeError, ok := err.(*RuntimeError); ok && len(runtimeError.Trace) > 0 {
+		rendered += "\n" + Traceback(runtimeError.Trace)
+	}
+	return rendered
+}
+
+// How many frames at each end of a deep traceback are shown
+const tracebackEdge = 10
+
+// Formats a call stack, innermost call first:
+//
+//	  at add (line 3)
+//	  called from main (line 10)
+//	  called from <script> (line 14)
+//
+// The middle of a very deep stack, e.g. after a stack overflow, is elided.
+func Traceback(trace []Frame) string {
+	lines := []string{}
+	for i, frame := range trace {
+		if len(trace) > 2 * tracebackEdge && i == tracebackEdge {
+			lines = append(lines, fmt.Sprintf("  ... %d more calls", len(trace) - 2 * tracebackEdge))
+		}
+		if len(trace) > 2 * tracebackEdge && i >= tracebackEdge && i < len(trace) - tracebackEdge {
+			continue
+		}
+
+		where := fmt.Sprintf("line %d", frame.Line)
+		if frame.File != "" {
+			where = DisplayFile(frame.File) + ", " + where
+		}
+		if i == 0 {
+			lines = append(lines, fmt.Sprintf("  at %s (%s)", frame.Function, where))
+		} else {
+			lines = append(lines, fmt.Sprintf("  called from %s (%s)", frame.Function, where))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Renders the source line containing tok with a caret under each of its
+// characters on that line. Returns "" if tok doesn't belong to source, e.g. it
+// was made up by the interpreter or comes from another file.
+func Snippet(source string, tok token.Token) string {
+	if tok.Column == 0 || tok.Start < 0 || tok.End < tok.Start || tok.End > len(source) {
+		return ""
+	}
+	if tok.Type != token.EOF && tok.Type != token.ERROR && source[tok.Start:tok.End] != tok.Lexeme {
+		return ""
+	}
+
+	lineStart := strings.LastIndexByte(source[:tok.Start], '\n') + 1
+	lineEnd := strings.IndexByte(source[tok.Start:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += tok.Start
+	}
+
+	// Keep tabs in the padding so the carets line up with the source
+	var padding strings.Builder
+	for _, c := range source[lineStart:tok.Start] {
+		if c == '\t' {
+			padding.WriteByte('\t')
+		} else {
+			padding.WriteByte(' ')
+		}
+	}
+
+	carets := max(utf8.RuneCountInString(source[tok.Start:min(tok.End, lineEnd)]), 1)
+	gutter := fmt.Sprintf("%5d | ", tok.Line)
+	return gutter + source[lineStart:lineEnd] + "\n" +
+		strings.Repeat(" ", len(gutter) - 2) + "| " + padding.String() + strings.Repeat("^", carets)
+}
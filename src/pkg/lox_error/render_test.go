@@ -0,0 +1,119 @@
+package lox_error
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Makes a token for the first occurrence of lexeme in source
+func tokenIn(source string, lexeme string, line int, column int) token.Token {
+	start := strings.Index(source, lexeme)
+	return token.Token{Type: token.IDENTIFIER, Lexeme: lexeme, Span: token.Span{Line: line, Column: column, Start: start, End: start + len(lexeme)}}
+}
+
+func TestRender(t *testing.T) {
+	source := "var a = 1;\n\tprint a - \"x\";\nprint \"two\nlines\";\n"
+	tests := []struct {
+		name string
+		err error
+		expected string
+	}{
+		{
+			"operator",
+			NewRuntimeError(tokenIn(source, "-", 2, 10), "Operands must be numbers."),
+			"Runtime error at [line 2, column 10]: Operands must be numbers.\n" +
+				"    2 | \tprint a - \"x\";\n" +
+				"      | \t        ^",
+		},
+		{
+			"token longer than a byte",
+			NewRuntimeError(tokenIn(source, "\"x\"", 2, 12), "Not a number."),
+			"Runtime error at [line 2, column 12]: Not a number.\n" +
+				"    2 | \tprint a - \"x\";\n" +
+				"      | \t          ^^^",
+		},
+		{
+			"token over several lines",
+			NewRuntimeError(tokenIn(source, "\"two\nlines\"", 3, 7), "Too long."),
+			"Runtime error at [line 3, column 7]: Too long.\n" +
+				"    3 | print \"two\n" +
+				"      |       ^^^^",
+		},
+		{
+			"token without a position",
+			NewRuntimeError(token.Token{Lexeme: "a", Span: token.Span{Line: 1}}, "Made up."),
+			"Runtime error at [line 1]: Made up.",
+		},
+		{
+			"token from other source",
+			NewRuntimeError(token.Token{Lexeme: "zzz", Span: token.Span{Line: 1, Column: 1, Start: 0, End: 3}}, "Elsewhere."),
+			"Runtime error at [line 1, column 1]: Elsewhere.",
+		},
+		{
+			"error without a token",
+			errors.New("plain"),
+			"plain",
+		},
+		{
+			"several errors",
+			ErrorList{NewParseError(token.Token{Type: token.IDENTIFIER, Lexeme: "a", Span: token.Span{Line: 1, Column: 5, Start: 4, End: 5}}, "First."), NewParseError(tokenIn(source, "print", 2, 2), "Second.")},
+			"Syntax error at [line 1, column 5] at 'a': First.\n" +
+				"    1 | var a = 1;\n" +
+				"      |     ^\n" +
+				"Syntax error at [line 2, column 2] at 'print': Second.\n" +
+				"    2 | \tprint a - \"x\";\n" +
+				"      | \t^^^^^",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := Render(test.err, source); actual != test.expected {
+				t.Errorf("expected:\n%s\nactual:\n%s", test.expected, actual)
+			}
+		})
+	}
+}
+
+// Carets line up by character, not byte, after and under multibyte text
+func TestSnippetMultibyte(t *testing.T) {
+	source := "var s = \"h\u00e9llo\U0001F600\"; print s - 1;"
+	tests := []struct {
+		lexeme string
+		expected string
+	}{
+		{"-", "      |                           ^"},
+		{"\"h\u00e9llo\U0001F600\"", "      |         ^^^^^^^^"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lexeme, func(t *testing.T) {
+			lines := strings.Split(Snippet(source, tokenIn(source, test.lexeme, 1, 1)), "\n")
+			if len(lines) != 2 || lines[1] != test.expected {
+				t.Errorf("expected:\n%s\nactual:\n%s", test.expected, strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	trace := []Frame{{Function: "add", Line: 3, Defined: 1}, {Function: "Point.move", Line: 10, Defined: 8}, {Function: "<script>", Line: 14}}
+	expected := "  at add (line 3)\n  called from Point.move (line 10)\n  called from <script> (line 14)"
+	if actual := Traceback(trace); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	// The middle of a deep stack is elided, keeping each end
+	deep := []Frame{}
+	for i := 0; i < 25; i++ {
+		deep = append(deep, Frame{Function: "recurse", Line: 2, Defined: 1})
+	}
+	lines := strings.Split(Traceback(deep), "\n")
+	if len(lines) != 2 * tracebackEdge + 1 || lines[tracebackEdge] != fmt.Sprintf("  ... %d more calls", 25 - 2 * tracebackEdge) {
+		t.Errorf("deep traceback:\n%s", strings.Join(lines, "\n"))
+	}
+}
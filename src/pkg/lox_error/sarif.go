@@ -0,0 +1,183 @@
+package lox_error
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The parts of SARIF 2.1.0 that diagnostics use. See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema string `json:"$schema"`
+	Version string `json:"version"`
+	Runs []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool sarifTool `json:"tool"`
+	ColumnKind string `json:"columnKind"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name string `json:"name"`
+	InformationURI string `json:"informationUri"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+}
+
+type sarifResult struct {
+	RuleID string `json:"ruleId"`
+	Level string `json:"level"`
+	Message sarifMessage `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region *sarifRegion `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine int `json:"endLine,omitempty"`
+	EndColumn int `json:"endColumn,omitempty"`
+	CharOffset *int `json:"charOffset,omitempty"`
+	CharLength *int `json:"charLength,omitempty"`
+}
+
+// SARIF levels by severity
+var sarifLevels = map[string]string{
+	"error": "error",
+	"warning": "warning",
+	"info": "note",
+}
+
+// Writes diagnostics as a SARIF log with a single run, for code scanning
+// tools. Each kind of error and lint rule becomes one of the run's rules.
+// SARIF counts columns and offsets in UTF-16 code units, so the files the
+// diagnostics are in are read to convert their byte positions; if one
+// can't be read, its positions are assumed to be ASCII.
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{Name: "glox", InformationURI: "https://github.com/lidanielm/glox", Rules: []sarifRule{}}},
+		ColumnKind: "utf16CodeUnits",
+		Results: []sarifResult{},
+	}
+
+	rules := make(map[string]string)
+	sources := make(map[string]*string) // nil if the file can't be read
+	for _, d := range diagnostics {
+		// Lint rules are named by their IDs, errors by their kind
+		rules[d.Code] = d.Kind
+		if d.Kind == "lint" {
+			rules[d.Code] = d.Code
+		}
+		result := sarifResult{RuleID: d.Code, Level: sarifLevels[d.Severity], Message: sarifMessage{Text: d.Message}}
+		if result.Level == "" {
+			result.Level = "error"
+		}
+
+		if d.File != "" {
+			location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(d.File)}}
+			if d.Line > 0 {
+				if _, ok := sources[d.File]; !ok {
+					sources[d.File] = readSource(d.File)
+				}
+				location.Region = region(d, sources[d.File])
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: location}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	for code, name := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: code, Name: name})
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool { return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID })
+
+	log := sarifLog{
+		Schema: "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{run},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func readSource(path string) *string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	source := string(data)
+	return &source
+}
+
+// Returns where a diagnostic is in UTF-16 code units. Without its source,
+// the byte columns are kept and there are no offsets.
+func region(d Diagnostic, source *string) *sarifRegion {
+	r := &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+	if d.Span != nil {
+		r.EndLine = d.Span.EndLine
+		r.EndColumn = d.Span.EndColumn
+	}
+	if source == nil || d.Span == nil || d.Span.End > len(*source) || d.Span.Start > d.Span.End {
+		return r
+	}
+
+	start, startColumn := utf16Position(*source, d.Span.Start)
+	end, endColumn := utf16Position(*source, d.Span.End)
+	length := end - start
+	r.StartColumn, r.EndColumn = startColumn, endColumn
+	r.CharOffset, r.CharLength = &start, &length
+	return r
+}
+
+// Converts a byte offset in source to UTF-16 code units: from the start of
+// the source, and as a column (from 1) in its line
+func utf16Position(source string, offset int) (int, int) {
+	lineStart := strings.LastIndexByte(source[:offset], '\n') + 1
+	column := utf16Length(source[lineStart:offset]) + 1
+	return utf16Length(source[:lineStart]) + column - 1, column
+}
+
+func utf16Length(s string) int {
+	length := 0
+	for _, r := range s {
+		// Runes outside the Basic Multilingual Plane take a surrogate pair
+		length++
+		if r >= 0x10000 {
+			length++
+		}
+	}
+	return length
+}
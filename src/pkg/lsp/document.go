@@ -0,0 +1,178 @@
+package lsp
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// document is an open file and what was found analysing its latest text
+type document struct {
+	uri string
+	text string
+	lineStarts []int // offset of the start of each line
+	errors []error // syntax and resolution errors
+	warnings []error
+	symbols *interpreter.Symbols // nil if the text doesn't parse
+	stale bool // symbols are from an earlier text that did parse
+}
+
+func newDocument(uri string, text string) *document {
+	doc := &document{uri: uri, text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i + 1)
+		}
+	}
+	doc.analyse()
+	return doc
+}
+
+// Scans, parses and resolves the text the way running it would, recording
+// errors rather than stopping at them
+func (d *document) analyse() {
+	tokens, err := scanner.NewScanner(d.text).ScanTokens()
+	if err != nil {
+		d.errors = flatten(err)
+		return
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		d.errors = flatten(err)
+		return
+	}
+
+	ip := interpreter.NewInterpreter(interpreter.WithOutput(io.Discard), interpreter.WithDiagnostics(io.Discard))
+	resolver := interpreter.NewResolver(ip)
+	d.symbols = resolver.RecordSymbols()
+	_, err = resolver.ResolveStmts(statements)
+	if err != nil {
+		// Resolution stops at its first error, so later symbols are missing
+		d.errors = flatten(err)
+	}
+	d.warnings = d.symbols.Warnings
+}
+
+func flatten(err error) []error {
+	if list, ok := err.(lox_error.ErrorList); ok {
+		return list
+	}
+	return []error{err}
+}
+
+func (d *document) diagnostics() []diagnostic {
+	diagnostics := []diagnostic{}
+	add := func(err error, severity int) {
+		diagnostics = append(diagnostics, diagnostic{
+			Range: d.errorRange(err),
+			Severity: severity,
+			Source: "glox",
+			Message: errorMessage(err),
+		})
+	}
+
+	for _, err := range d.errors {
+		add(err, severityError)
+	}
+	for _, err := range d.warnings {
+		add(err, severityWarning)
+	}
+	return diagnostics
+}
+
+// The range of the token an error points at, or its whole line if the
+// token has no position
+func (d *document) errorRange(err error) textRange {
+	tok, ok := lox_error.ErrorToken(err)
+	if !ok || tok.Line == 0 {
+		return textRange{}
+	}
+	if tok.Column == 0 || tok.End > len(d.text) {
+		line := min(tok.Line, len(d.lineStarts)) - 1
+		end := len(d.text)
+		if line + 1 < len(d.lineStarts) {
+			end = d.lineStarts[line + 1] - 1
+		}
+		return d.textRange(token.Span{Start: d.lineStarts[line], End: end})
+	}
+	return d.textRange(tok.Span)
+}
+
+// An error's message without its location, which the editor shows itself
+func errorMessage(err error) string {
+	switch err := err.(type) {
+	case *lox_error.ParseError:
+		return err.Message
+	case *lox_error.RuntimeError:
+		return err.Message
+	case *lox_error.LoxError:
+		// The message starts with where the error is, e.g. " at 'x': "
+		where := " at '" + err.Token.Lexeme + "': "
+		if err.Token.Type == token.EOF {
+			where = " at end: "
+		}
+		return strings.TrimPrefix(err.Message, where)
+	}
+	return err.Error()
+}
+
+// Converts a position in the editor to a byte offset in the text
+func (d *document) offset(pos position) int {
+	if pos.Line < 0 {
+		return 0
+	} else if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[pos.Line]
+	for units := 0; offset < len(d.text) && d.text[offset] != '\n' && units < pos.Character; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		units += utf16Len(r)
+		offset += size
+	}
+	return offset
+}
+
+// Converts a byte offset in the text to a position in the editor
+func (d *document) position(offset int) position {
+	offset = max(min(offset, len(d.text)), 0)
+	line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		character += utf16Len(r)
+	}
+	return position{Line: line, Character: character}
+}
+
+// Characters outside the Basic Multilingual Plane take two UTF-16 units
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func (d *document) textRange(span token.Span) textRange {
+	return textRange{Start: d.position(span.Start), End: d.position(span.End)}
+}
+
+func (d *document) location(span token.Span) location {
+	return location{URI: d.uri, Range: d.textRange(span)}
+}
+
+// Returns the symbol declared or referenced at pos, or nil
+func (d *document) symbolAt(pos position) *interpreter.Symbol {
+	if d.symbols == nil || d.stale {
+		return nil
+	}
+	return d.symbols.At(d.offset(pos))
+}
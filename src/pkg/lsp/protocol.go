@@ -0,0 +1,171 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/lidanielm/glox/src/pkg/internal/framing"
+)
+
+// The parts of the Language Server Protocol the server uses. See
+// https://microsoft.github.io/language-server-protocol/specification
+
+// message is a JSON-RPC request, response or notification. Requests have an
+// ID; notifications don't.
+type message struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID json.RawMessage `json:"id,omitempty"`
+	Method string `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error *responseError `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code int `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	parseError = -32700
+	invalidParams = -32602
+	methodNotFound = -32601
+)
+
+// Reads a message framed by a Content-Length header
+func readMessage(r *bufio.Reader) (*message, error) {
+	body, err := framing.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &message{}
+	err = json.Unmarshal(body, msg)
+	if err != nil {
+		return nil, &responseError{Code: parseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = "2.0"
+	return framing.Write(w, msg)
+}
+
+type position struct {
+	Line int `json:"line"`
+	Character int `json:"character"` // in UTF-16 code units
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End position `json:"end"`
+}
+
+type location struct {
+	URI string `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+// Documents are synced in full, so each change holds the whole text
+type didChangeParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type referenceParams struct {
+	textDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+type documentSymbolParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type diagnostic struct {
+	Range textRange `json:"range"`
+	Severity int `json:"severity"`
+	Source string `json:"source"`
+	Message string `json:"message"`
+}
+
+const (
+	severityError = 1
+	severityWarning = 2
+)
+
+type publishDiagnosticsParams struct {
+	URI string `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range textRange `json:"range"`
+}
+
+type markupContent struct {
+	Kind string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type documentSymbol struct {
+	Name string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	Kind int `json:"kind"`
+	Range textRange `json:"range"`
+	SelectionRange textRange `json:"selectionRange"`
+	Children []documentSymbol `json:"children,omitempty"`
+}
+
+// SymbolKind values
+const (
+	symbolClass = 5
+	symbolMethod = 6
+	symbolFunction = 12
+)
+
+type completionItem struct {
+	Label string `json:"label"`
+	Kind int `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CompletionItemKind values
+const (
+	completionFunction = 3
+	completionVariable = 6
+	completionClass = 7
+	completionModule = 9
+	completionKeyword = 14
+)
@@ -0,0 +1,358 @@
+// Package lsp is a Language Server Protocol server for Lox, so editors can
+// show errors as you type and navigate between declarations and their uses.
+// It analyses documents with the same scanner, parser and resolver that run
+// them.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type Server struct {
+	in *bufio.Reader
+	out io.Writer
+	log io.Writer // for problems that can't be reported to the client
+	documents map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer, log io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, log: log, documents: make(map[string]*document)}
+}
+
+// Handles messages until the client sends exit or closes the input. Returns
+// an error if the client exits without asking the server to shut down first.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if respErr, ok := err.(*responseError); ok {
+			s.reply(nil, nil, respErr)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// Notifications get no response, even when they fail
+			if err != nil {
+				fmt.Fprintf(s.log, "%s: %v\n", msg.Method, err)
+			}
+			continue
+		}
+
+		respErr, _ := err.(*responseError)
+		if err != nil && respErr == nil {
+			respErr = &responseError{Code: invalidParams, Message: err.Error()}
+		}
+		s.reply(msg.ID, result, respErr)
+	}
+}
+
+func (s *Server) reply(id json.RawMessage, result any, respErr *responseError) {
+	msg := &message{ID: id, Error: respErr}
+	if id == nil {
+		msg.ID = json.RawMessage("null")
+	}
+	if respErr == nil {
+		// A response must have a result, even if it's null
+		msg.Result, _ = json.Marshal(result)
+	}
+
+	err := writeMessage(s.out, msg)
+	if err != nil {
+		fmt.Fprintln(s.log, "Error writing response:", err)
+	}
+}
+
+func (s *Server) notify(method string, params any) {
+	body, _ := json.Marshal(params)
+	err := writeMessage(s.out, &message{Method: method, Params: body})
+	if err != nil {
+		fmt.Fprintln(s.log, "Error writing notification:", err)
+	}
+}
+
+func (s *Server) handle(msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": 1, // full text on every change
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider": true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "glox"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		s.open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) > 0 {
+			s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges) - 1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		return nil, nil
+	case "textDocument/definition":
+		return withPosition(s, msg, s.definition)
+	case "textDocument/references":
+		var params referenceParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return s.references(doc, params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/hover":
+		return withPosition(s, msg, s.hover)
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return s.documentSymbols(doc), nil
+	case "textDocument/completion":
+		return withPosition(s, msg, s.completion)
+	}
+
+	if strings.HasPrefix(msg.Method, "$/") || msg.ID == nil {
+		// Optional notifications can be ignored
+		return nil, nil
+	}
+	return nil, &responseError{Code: methodNotFound, Message: "Unsupported method " + msg.Method + "."}
+}
+
+// Decodes the parameters of a request about a position in a document and
+// passes them to handler. Requests about unknown documents get null.
+func withPosition[T any](s *Server, msg *message, handler func(*document, position) T) (any, error) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return handler(doc, params.Position), nil
+}
+
+// Analyses a document's new text and publishes its diagnostics
+func (s *Server) open(uri string, text string) {
+	doc := newDocument(uri, text)
+	if doc.symbols == nil {
+		// Keep the symbols from the last text that parsed, so completion
+		// still works while a statement is half typed
+		if previous, ok := s.documents[uri]; ok {
+			doc.symbols = previous.symbols
+			doc.stale = true
+		}
+	}
+	s.documents[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()})
+}
+
+func (s *Server) definition(doc *document, pos position) *location {
+	symbol := doc.symbolAt(pos)
+	if symbol == nil {
+		return nil
+	}
+	loc := doc.location(symbol.Name.Span)
+	return &loc
+}
+
+func (s *Server) references(doc *document, pos position, includeDeclaration bool) []location {
+	symbol := doc.symbolAt(pos)
+	if symbol == nil {
+		return nil
+	}
+
+	locations := []location{}
+	if includeDeclaration {
+		locations = append(locations, doc.location(symbol.Name.Span))
+	}
+	for _, reference := range symbol.References {
+		locations = append(locations, doc.location(reference.Span))
+	}
+	return locations
+}
+
+func (s *Server) hover(doc *document, pos position) *hover {
+	symbol := doc.symbolAt(pos)
+	if symbol == nil {
+		return nil
+	}
+
+	offset := doc.offset(pos)
+	name := symbol.Name
+	for _, reference := range symbol.References {
+		if reference.Start <= offset && offset <= reference.End {
+			name = reference
+		}
+	}
+
+	value := fmt.Sprintf("```lox\n%s\n```\nDeclared on line %d", declaration(symbol), symbol.Name.Line)
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: doc.textRange(name.Span)}
+}
+
+// Describes a symbol the way it was declared, e.g. "fun add(a, b)"
+func declaration(symbol *interpreter.Symbol) string {
+	switch symbol.Kind {
+	case interpreter.FUNCTION_SYMBOL:
+		return "fun " + symbol.Name.Lexeme + parameters(symbol.Params)
+	case interpreter.METHOD_SYMBOL:
+		if symbol.Class != nil {
+			return "(method) " + symbol.Class.Name.Lexeme + "." + symbol.Name.Lexeme + parameters(symbol.Params)
+		}
+		return "(method) " + symbol.Name.Lexeme + parameters(symbol.Params)
+	case interpreter.CLASS_SYMBOL:
+		if symbol.Superclass != "" {
+			return "class " + symbol.Name.Lexeme + " < " + symbol.Superclass
+		}
+		return "class " + symbol.Name.Lexeme
+	case interpreter.PARAMETER_SYMBOL:
+		return "(parameter) " + symbol.Name.Lexeme
+	case interpreter.CATCH_SYMBOL:
+		return "(catch) " + symbol.Name.Lexeme
+	case interpreter.IMPORT_SYMBOL:
+		if symbol.Alias {
+			return "import " + symbol.Module + " as " + symbol.Name.Lexeme
+		}
+		return "from " + symbol.Module + " import " + symbol.Name.Lexeme
+	}
+	return "var " + symbol.Name.Lexeme
+}
+
+func parameters(params []token.Token) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Lexeme
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// Lists the classes, with their methods, and the functions in a document
+func (s *Server) documentSymbols(doc *document) []documentSymbol {
+	symbols := []documentSymbol{}
+	if doc.symbols == nil || doc.stale {
+		return symbols
+	}
+
+	classes := make(map[*interpreter.Symbol]int) // index in symbols
+	for _, symbol := range doc.symbols.All {
+		entry := documentSymbol{
+			Name: symbol.Name.Lexeme,
+			Detail: declaration(symbol),
+			Range: doc.textRange(symbol.Span),
+			SelectionRange: doc.textRange(symbol.Name.Span),
+		}
+
+		switch symbol.Kind {
+		case interpreter.CLASS_SYMBOL:
+			entry.Kind = symbolClass
+			classes[symbol] = len(symbols)
+			symbols = append(symbols, entry)
+		case interpreter.METHOD_SYMBOL:
+			entry.Kind = symbolMethod
+			entry.Detail = parameters(symbol.Params)
+			if i, ok := classes[symbol.Class]; ok {
+				symbols[i].Children = append(symbols[i].Children, entry)
+			}
+		case interpreter.FUNCTION_SYMBOL:
+			entry.Kind = symbolFunction
+			entry.Detail = parameters(symbol.Params)
+			symbols = append(symbols, entry)
+		}
+	}
+	return symbols
+}
+
+// Suggests the names in scope at pos, the natives and the keywords
+func (s *Server) completion(doc *document, pos position) []completionItem {
+	items := []completionItem{}
+	seen := make(map[string]bool)
+
+	if doc.symbols != nil {
+		for _, symbol := range doc.symbols.Visible(doc.offset(pos)) {
+			kind := completionVariable
+			switch symbol.Kind {
+			case interpreter.FUNCTION_SYMBOL:
+				kind = completionFunction
+			case interpreter.CLASS_SYMBOL:
+				kind = completionClass
+			case interpreter.IMPORT_SYMBOL:
+				kind = completionModule
+			}
+			items = append(items, completionItem{Label: symbol.Name.Lexeme, Kind: kind, Detail: declaration(symbol)})
+			seen[symbol.Name.Lexeme] = true
+		}
+	}
+
+	for _, name := range interpreter.Natives() {
+		if !seen[name] {
+			items = append(items, completionItem{Label: name, Kind: completionFunction, Detail: "native"})
+			seen[name] = true
+		}
+	}
+
+	for _, keyword := range sortedKeys(token.Keywords) {
+		if !seen[keyword] {
+			items = append(items, completionItem{Label: keyword, Kind: completionKeyword})
+		}
+	}
+	return items
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const program = `class Greeter {
+  init(name) {
+    this.name = name;
+  }
+  greet() {
+    print "Hello, " + this.name;
+  }
+}
+
+fun make(name) {
+  var greeter = Greeter(name);
+  return greeter;
+}
+
+make("world").greet();
+`
+
+// Runs a session of requests, each a method and its params, returning the
+// server's responses by position in the session and the notifications it sent
+func session(t *testing.T, requests ...any) (map[int]*message, []*message) {
+	t.Helper()
+	var in bytes.Buffer
+	for i := 0; i < len(requests); i += 2 {
+		params, _ := json.Marshal(requests[i + 1])
+		msg := &message{Method: requests[i].(string), Params: params}
+		if !strings.HasPrefix(msg.Method, "textDocument/did") && msg.Method != "exit" {
+			msg.ID = json.RawMessage(fmt.Sprint(i / 2))
+		}
+		writeMessage(&in, msg)
+	}
+
+	var out bytes.Buffer
+	err := NewServer(&in, &out, io.Discard).Serve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := make(map[int]*message)
+	notifications := []*message{}
+	reader := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(reader)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.ID == nil {
+			notifications = append(notifications, msg)
+			continue
+		}
+		var id int
+		json.Unmarshal(msg.ID, &id)
+		responses[id] = msg
+	}
+	return responses, notifications
+}
+
+func open(text string) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": "file:///test.lox", "text": text}}
+}
+
+func at(line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": "file:///test.lox"},
+		"position": position{Line: line, Character: character},
+		"context": map[string]any{"includeDeclaration": true},
+	}
+}
+
+func decode[T any](t *testing.T, msg *message) T {
+	t.Helper()
+	var result T
+	if msg == nil {
+		t.Fatal("no response")
+	} else if msg.Error != nil {
+		t.Fatal(msg.Error.Message)
+	}
+	err := json.Unmarshal(msg.Result, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestNavigation(t *testing.T) {
+	responses, _ := session(t,
+		"initialize", map[string]any{},
+		"textDocument/didOpen", open(program),
+		"textDocument/definition", at(14, 1), // make
+		"textDocument/references", at(9, 9), // name, the parameter of make
+		"textDocument/hover", at(10, 17), // Greeter
+		"textDocument/documentSymbol", at(0, 0),
+		"textDocument/completion", at(11, 2),
+	)
+
+	definition := decode[location](t, responses[2])
+	if definition.Range.Start != (position{Line: 9, Character: 4}) {
+		t.Errorf("definition of make at %v", definition.Range.Start)
+	}
+
+	references := decode[[]location](t, responses[3])
+	if len(references) != 2 || references[1].Range.Start != (position{Line: 10, Character: 24}) {
+		t.Errorf("references to name: %v", references)
+	}
+
+	hovered := decode[hover](t, responses[4])
+	if !strings.Contains(hovered.Contents.Value, "class Greeter") {
+		t.Errorf("hover: %q", hovered.Contents.Value)
+	}
+
+	symbols := decode[[]documentSymbol](t, responses[5])
+	if len(symbols) != 2 || symbols[0].Name != "Greeter" || len(symbols[0].Children) != 2 || symbols[1].Name != "make" {
+		t.Errorf("document symbols: %+v", symbols)
+	}
+
+	labels := map[string]bool{}
+	for _, item := range decode[[]completionItem](t, responses[6]) {
+		labels[item.Label] = true
+	}
+	for _, label := range []string{"greeter", "name", "make", "Greeter", "clock", "while"} {
+		if !labels[label] {
+			t.Errorf("completion is missing %s", label)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	_, notifications := session(t,
+		"textDocument/didOpen", open("var a = 1;\nprint a +;\n"),
+		"textDocument/didChange", map[string]any{
+			"textDocument": map[string]any{"uri": "file:///test.lox"},
+			"contentChanges": []any{map[string]any{"text": "{ var a = 1; var a = 2; }\n"}},
+		},
+	)
+
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+
+	syntax := decode[publishDiagnosticsParams](t, &message{Result: notifications[0].Params})
+	if len(syntax.Diagnostics) != 1 || syntax.Diagnostics[0].Range.Start.Line != 1 || syntax.Diagnostics[0].Severity != severityError {
+		t.Errorf("syntax error diagnostics: %+v", syntax.Diagnostics)
+	}
+
+	warning := decode[publishDiagnosticsParams](t, &message{Result: notifications[1].Params})
+	if len(warning.Diagnostics) != 1 || warning.Diagnostics[0].Severity != severityWarning ||
+		warning.Diagnostics[0].Message != "Already a variable with this name in this scope." {
+		t.Errorf("warning diagnostics: %+v", warning.Diagnostics)
+	}
+}
+
+// A malformed frame stops the server with an error instead of a panic
+func TestBadContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "x", "", "99999999999"} {
+		t.Run(length, func(t *testing.T) {
+			in := strings.NewReader("Content-Length: " + length + "\r\n\r\n{}")
+			err := NewServer(in, io.Discard, io.Discard).Serve()
+			if err == nil || err.Error() != fmt.Sprintf("bad Content-Length header: %q", length) {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package parser
 
 import (
 	"slices"
+	"strings"
 
 	"github.com/lidanielm/glox/src/pkg/internal/ast"
 	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/internal/tool"
 	"github.com/lidanielm/glox/src/pkg/lox_error"
 	"github.com/lidanielm/glox/src/pkg/token"
 )
@@ -14,6 +16,9 @@ type Parser struct {
 	tokens []token.Token
 	curr int
 	enclosingLoop *stmt.While
+	errors lox_error.ErrorList
+	blockDepth int
+	interactive bool // parsing REPL input, see ParseInteractive
 }
 
 // Constructor for Parser
@@ -22,21 +27,78 @@ func NewParser(tokens []token.Token) *Parser {
 }
 
 
+// Parses the whole program. Syntax errors don't stop the parse: every one
+// found is returned together as a lox_error.ErrorList.
 func (p *Parser) Parse() ([]stmt.Stmt, error) {
 	statements := []stmt.Stmt{}
 	for !p.isAtEnd() {
-		declaration, err := p.declaration()
-		if err != nil {
-			return nil, err
+		declaration := p.declaration()
+		if declaration != nil {
+			statements = append(statements, declaration)
+		}
+	}
+
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+	return statements, nil
+}
+
+
+// Parses input typed at the REPL. The final expression statement may leave
+// off its semicolon, and is turned into a print statement so the REPL shows
+// its value.
+func (p *Parser) ParseInteractive() ([]stmt.Stmt, error) {
+	p.interactive = true
+	statements, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statements) > 0 {
+		if expression, ok := statements[len(statements) - 1].(*stmt.Expression); ok {
+			statements[len(statements) - 1] = &stmt.Print{Node: expression.Node, Expr: expression.Expr}
 		}
-		statements = append(statements, declaration)
 	}
-	
 	return statements, nil
 }
 
 
-func (p *Parser) declaration() (stmt.Stmt, error) {
+// Parses a single expression and renders its syntax tree, e.g.
+// "(+ 1 (* 2 3))". Used by the REPL's :ast command.
+func (p *Parser) PrintExpression() (string, error) {
+	expr, err := p.expression()
+	if err != nil {
+		return "", err
+	}
+
+	if !p.isAtEnd() {
+		return "", lox_error.NewParseError(p.peek(), "Expect end of expression.")
+	}
+	return tool.NewAstPrinter().Print(expr), nil
+}
+
+
+// Parses a declaration, recording any syntax error in it and skipping ahead
+// to the next statement. Returns nil if the declaration had an error.
+func (p *Parser) declaration() stmt.Stmt {
+	start := p.curr
+	declaration, err := p.parseDeclaration()
+	if err != nil {
+		p.errors = append(p.errors, err)
+		// A missing ';' is reported at the start of the next statement, which
+		// is left to be parsed
+		if p.curr == start || !p.atStatementStart() {
+			p.synchronize()
+		}
+		return nil
+	}
+
+	return declaration
+}
+
+
+func (p *Parser) parseDeclaration() (stmt.Stmt, error) {
 	if p.match(token.CLASS) {
 		class, err := p.classDeclaration()
 		if err != nil {
@@ -45,7 +107,9 @@ func (p *Parser) declaration() (stmt.Stmt, error) {
 
 		return class, nil
 	}
-	if p.match(token.FUN) {
+	// A 'fun' not followed by a name starts a lambda expression instead
+	if p.check(token.FUN) && p.checkNext(token.IDENTIFIER) {
+		p.advance()
 		fn, err := p.function("function")
 		if err != nil {
 			return nil, err
@@ -53,26 +117,36 @@ func (p *Parser) declaration() (stmt.Stmt, error) {
 
 		return fn, nil
 	}
+	if p.match(token.IMPORT) {
+		return p.importDeclaration()
+	}
+	if p.match(token.FROM) {
+		return p.fromImportDeclaration()
+	}
 	if p.match(token.VAR) {
-		stmt, err := p.varDeclaration()
-		if err != nil {
-			p.synchronize()
-			return nil, err
-		}
-
-		return stmt, nil
+		return p.varDeclaration()
 	}
 
 	return p.statement()
 }
 
 func (p *Parser) classDeclaration() (stmt.Stmt, error) {
+	start := p.previous().Span
 	name, err := p.consume(token.IDENTIFIER, "Expect class name.")
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = p.consume(token.LEFT_BRACE, "Expect '{' after class name.")
+	var superclass *ast.Variable
+	if p.match(token.LESS) {
+		_, err = p.consume(token.IDENTIFIER, "Expect superclass name.")
+		if err != nil {
+			return nil, err
+		}
+		superclass = spanned(p, ast.NewVariable(p.previous()), p.previous().Span)
+	}
+
+	_, err = p.consume(token.LEFT_BRACE, "Expect '{' before class body.")
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +155,10 @@ func (p *Parser) classDeclaration() (stmt.Stmt, error) {
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
 		fn, err := p.function("method")
 		if err != nil {
-			return nil, err
+			// Keep parsing the rest of the class after a broken method
+			p.errors = append(p.errors, err)
+			p.synchronizeMethod()
+			continue
 		}
 		methods = append(methods, fn)
 	}
@@ -91,10 +168,16 @@ func (p *Parser) classDeclaration() (stmt.Stmt, error) {
 		return nil, err
 	}
 
-	return stmt.NewClass(name, methods), nil
+	return spanned(p, stmt.NewClass(name, superclass, methods), start), nil
 }
 
 func (p *Parser) function(kind string) (stmt.Function, error) {
+	// Functions start at 'fun', methods at their name
+	start := p.peek().Span
+	if p.previous().Type == token.FUN {
+		start = p.previous().Span
+	}
+
 	name, err := p.consume(token.IDENTIFIER, "Expect "+kind+" name.")
 	if err != nil {
 		return stmt.Function{}, err
@@ -105,16 +188,42 @@ func (p *Parser) function(kind string) (stmt.Function, error) {
 		return stmt.Function{}, err
 	}
 
+	params, body, err := p.functionBody(kind)
+	if err != nil {
+		return stmt.Function{}, err
+	}
+
+	return *spanned(p, stmt.NewFunction(name, params, body), start), nil
+}
+
+func (p *Parser) lambda() (ast.Expr, error) {
+	keyword := p.previous()
+	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'fun'.")
+	if err != nil {
+		return nil, err
+	}
+
+	params, body, err := p.functionBody("function")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, ast.NewLambda(keyword, params, body), keyword.Span), nil
+}
+
+// Parses the parameter list and body shared by named functions and lambdas,
+// starting just after the opening '('
+func (p *Parser) functionBody(kind string) ([]token.Token, []stmt.Stmt, error) {
 	params := []token.Token{}
 	if !p.check(token.RIGHT_PAREN) {
 		for {
 			if len(params) >= 255 {
-				return stmt.Function{}, lox_error.NewParseError(p.peek(), "Can't have more than 255 parameters.")
+				return nil, nil, lox_error.NewParseError(p.peek(), "Can't have more than 255 parameters.")
 			}
 	
 			identifier, err := p.consume(token.IDENTIFIER, "Expect parameter name.")
 			if err != nil {
-				return stmt.Function{}, err
+				return nil, nil, err
 			}
 	
 			params = append(params, identifier)
@@ -125,25 +234,84 @@ func (p *Parser) function(kind string) (stmt.Function, error) {
 		}
 	}
 
-	_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after parameters.")
+	_, err := p.consume(token.RIGHT_PAREN, "Expect ')' after parameters.")
 	if err != nil {
-		return stmt.Function{}, err
+		return nil, nil, err
 	}
 
 	_, err = p.consume(token.LEFT_BRACE, "Expect '{' before "+kind+" body.")
 	if err != nil {
-		return stmt.Function{}, err
+		return nil, nil, err
 	}
 
 	body, err := p.block()
 	if err != nil {
-		return stmt.Function{}, err
+		return nil, nil, err
 	}
 
-	return *stmt.NewFunction(name, params, body), nil
+	return params, body, nil
+}
+
+func (p *Parser) importDeclaration() (stmt.Stmt, error) {
+	keyword := p.previous()
+	path, err := p.consume(token.STRING, "Expect module path after 'import'.")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.AS, "Expect 'as' after module path.")
+	if err != nil {
+		return nil, err
+	}
+
+	alias, err := p.consume(token.IDENTIFIER, "Expect module name after 'as'.")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after import.")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, stmt.NewImport(keyword, path, alias, nil), keyword.Span), nil
+}
+
+func (p *Parser) fromImportDeclaration() (stmt.Stmt, error) {
+	keyword := p.previous()
+	path, err := p.consume(token.STRING, "Expect module path after 'from'.")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.IMPORT, "Expect 'import' after module path.")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []token.Token{}
+	for {
+		name, err := p.consume(token.IDENTIFIER, "Expect name to import.")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after import.")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, stmt.NewImport(keyword, path, token.Token{}, names), keyword.Span), nil
 }
 
 func (p *Parser) varDeclaration() (stmt.Stmt, error) {
+	start := p.previous().Span
 	name, err := p.consume(token.IDENTIFIER, "Expect variable name.")
 	if err != nil {
 		return nil, err
@@ -161,7 +329,7 @@ func (p *Parser) varDeclaration() (stmt.Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return stmt.NewVar(name, initializer), nil
+	return spanned(p, stmt.NewVar(name, initializer), start), nil
 }
 
 
@@ -180,18 +348,24 @@ func (p *Parser) statement() (stmt.Stmt, error) {
 		return p.continueStatement()
 	} else if p.match(token.RETURN) {
 		return p.returnStatement()
+	} else if p.match(token.THROW) {
+		return p.throwStatement()
+	} else if p.match(token.TRY) {
+		return p.tryStatement()
 	} else if p.match(token.LEFT_BRACE) {
+		start := p.previous().Span
 		block, err := p.block()
 		if err != nil {
 			return nil, err
 		}
-		return stmt.NewBlock(block), nil
+		return spanned(p, stmt.NewBlock(block), start), nil
 	}
 
 	return p.expressionStatement()
 }
 
 func (p *Parser) ifStatement() (stmt.Stmt, error) {
+	start := p.previous().Span
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'if'.")
 	if err != nil {
 		return nil, err
@@ -216,13 +390,15 @@ func (p *Parser) ifStatement() (stmt.Stmt, error) {
 			return nil, err
 		}
 
-		return stmt.NewIf(condition, thenBranch, elseBranch), nil
+		return spanned(p, stmt.NewIf(condition, thenBranch, elseBranch), start), nil
 	} else {
-		return stmt.NewIf(condition, thenBranch, nil), nil
+		return spanned(p, stmt.NewIf(condition, thenBranch, nil), start), nil
 	}
 }
 
 func (p *Parser) whileStatement() (stmt.Stmt, error) {
+	keyword := p.previous()
+	start := keyword.Span
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'.")
 	if err != nil {
 		return nil, err
@@ -239,7 +415,7 @@ func (p *Parser) whileStatement() (stmt.Stmt, error) {
 	}
 
 	prevLoop := p.enclosingLoop
-	whileStmt := stmt.NewWhile(condition)
+	whileStmt := stmt.NewWhile(keyword, condition)
 	p.enclosingLoop = whileStmt
 
 	body, err := p.statement()
@@ -250,10 +426,12 @@ func (p *Parser) whileStatement() (stmt.Stmt, error) {
 
 	whileStmt = whileStmt.WithBody(body)
 
-	return whileStmt, nil
+	return spanned(p, whileStmt, start), nil
 }
 
 func (p *Parser) forStatement() (stmt.Stmt, error) {
+	keyword := p.previous()
+	start := keyword.Span
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'for'.")
 	if err != nil {
 		return nil, err
@@ -300,8 +478,12 @@ func (p *Parser) forStatement() (stmt.Stmt, error) {
 		return nil, err
 	}
 
+	if condition == nil {
+		condition = ast.NewLiteral(true)
+	}
+
 	prevLoop := p.enclosingLoop
-	whileStmt := stmt.NewWhile(condition)
+	whileStmt := stmt.NewWhile(keyword, condition)
 	p.enclosingLoop = whileStmt
 	
 	body, err := p.statement()
@@ -314,23 +496,20 @@ func (p *Parser) forStatement() (stmt.Stmt, error) {
 		whileStmt = whileStmt.WithIncrement(increment)
 	}
 
-	if condition == nil {
-		condition = ast.NewLiteral(true)
-	}
-
-	body = whileStmt.WithBody(body)
+	body = spanned(p, whileStmt.WithBody(body), start)
 
 	if initializer != nil {
-		body = stmt.NewBlock([]stmt.Stmt{
+		body = spanned(p, stmt.NewBlock([]stmt.Stmt{
 			initializer,
 			body,
-		})
+		}), start)
 	}
 
 	return body, nil
 }
 
 func (p *Parser) breakStatement() (stmt.Stmt, error) {
+	start := p.previous().Span
 	if p.enclosingLoop == nil {
 		return nil, lox_error.NewParseError(p.peek(), "'break' statement has no enclosing loop.")
 	}
@@ -340,10 +519,11 @@ func (p *Parser) breakStatement() (stmt.Stmt, error) {
 		return nil, err
 	}
 
-	return stmt.NewBreak(p.enclosingLoop), nil
+	return spanned(p, stmt.NewBreak(p.enclosingLoop), start), nil
 }
 
 func (p *Parser) continueStatement() (stmt.Stmt, error) {
+	start := p.previous().Span
 	if p.enclosingLoop == nil {
 		return nil, lox_error.NewParseError(p.peek(), "'continue' statement has no enclosing loop.")
 	}
@@ -353,7 +533,7 @@ func (p *Parser) continueStatement() (stmt.Stmt, error) {
 		return nil, err
 	}
 
-	return stmt.NewContinue(p.enclosingLoop), nil
+	return spanned(p, stmt.NewContinue(p.enclosingLoop), start), nil
 }
 
 func (p *Parser) returnStatement() (stmt.Stmt, error) {
@@ -373,10 +553,90 @@ func (p *Parser) returnStatement() (stmt.Stmt, error) {
 		return nil, err
 	}
 	
-	return stmt.NewReturn(keyword, expr), nil
+	return spanned(p, stmt.NewReturn(keyword, expr), keyword.Span), nil
+}
+
+func (p *Parser) throwStatement() (stmt.Stmt, error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after thrown value.")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, stmt.NewThrow(keyword, value), keyword.Span), nil
+}
+
+func (p *Parser) tryStatement() (stmt.Stmt, error) {
+	keyword := p.previous()
+	bodyStart, err := p.consume(token.LEFT_BRACE, "Expect '{' after 'try'.")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	tryBlock := spanned(p, stmt.NewBlock(body), bodyStart.Span)
+
+	var catchName token.Token
+	var catch *stmt.Block
+	if p.match(token.CATCH) {
+		_, err = p.consume(token.LEFT_PAREN, "Expect '(' after 'catch'.")
+		if err != nil {
+			return nil, err
+		}
+
+		catchName, err = p.consume(token.IDENTIFIER, "Expect error variable name.")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after error variable.")
+		if err != nil {
+			return nil, err
+		}
+
+		catchStart, err := p.consume(token.LEFT_BRACE, "Expect '{' before catch body.")
+		if err != nil {
+			return nil, err
+		}
+
+		statements, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		catch = spanned(p, stmt.NewBlock(statements), catchStart.Span)
+	}
+
+	var finally *stmt.Block
+	if p.match(token.FINALLY) {
+		finallyStart, err := p.consume(token.LEFT_BRACE, "Expect '{' after 'finally'.")
+		if err != nil {
+			return nil, err
+		}
+
+		statements, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		finally = spanned(p, stmt.NewBlock(statements), finallyStart.Span)
+	}
+
+	if catch == nil && finally == nil {
+		return nil, lox_error.NewParseError(p.peek(), "Expect 'catch' or 'finally' after try block.")
+	}
+
+	return spanned(p, stmt.NewTry(keyword, tryBlock, catchName, catch, finally), keyword.Span), nil
 }
 
 func (p *Parser) printStatement() (stmt.Stmt, error) {
+	start := p.previous().Span
 	// Evaluate argument
 	value, err := p.expression()
 	if err != nil {
@@ -384,8 +644,11 @@ func (p *Parser) printStatement() (stmt.Stmt, error) {
 	}
 
 	// Check if statement is terminated by semicolon
-	p.consume(token.SEMICOLON, "Expect ';' after value.")
-	return stmt.NewPrint(value), nil
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after value.")
+	if err != nil {
+		return nil, err
+	}
+	return spanned(p, stmt.NewPrint(value), start), nil
 }
 
 func (p *Parser) expressionStatement() (stmt.Stmt, error) {
@@ -394,23 +657,34 @@ func (p *Parser) expressionStatement() (stmt.Stmt, error) {
 		return nil, err
 	}
 
-	p.consume(token.SEMICOLON, "Expect ';' after expression.")
-	return stmt.NewExpression(expr), nil
+	if p.interactive && p.isAtEnd() {
+		return spanned(p, stmt.NewExpression(expr), expr.Span()), nil
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after expression.")
+	if err != nil {
+		return nil, err
+	}
+	return spanned(p, stmt.NewExpression(expr), expr.Span()), nil
 }
 
 
 func (p *Parser) block() ([]stmt.Stmt, error) {
 	statements := []stmt.Stmt{}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
-		decl, err := p.declaration()
-		if err != nil {
-			return nil, err
+		decl := p.declaration()
+		if decl != nil {
+			statements = append(statements, decl)
 		}
-		statements = append(statements, decl)
 	}
 
-	p.consume(token.RIGHT_BRACE, "Expect '}' after block.")
+	_, err := p.consume(token.RIGHT_BRACE, "Expect '}' after block.")
+	if err != nil {
+		return nil, err
+	}
 	return statements, nil
 }
 
@@ -440,7 +714,11 @@ func (p *Parser) assignment() (ast.Expr, error) {
 
 		if variable, ok := expr.(*ast.Variable); ok {
 			name := variable.Name
-			return ast.NewAssign(name, value), nil
+			return spanned(p, ast.NewAssign(name, value), expr.Span()), nil
+		} else if get, ok := expr.(*ast.Get); ok {
+			return spanned(p, ast.NewSet(get.Object, get.Name, value), expr.Span()), nil
+		} else if subscript, ok := expr.(*ast.Subscript); ok {
+			return spanned(p, ast.NewSetSubscript(subscript.Object, subscript.Bracket, subscript.Index, value), expr.Span()), nil
 		}
 
 		return nil, lox_error.NewParseError(equals, "Invalid assignment target.")
@@ -470,7 +748,7 @@ func (p *Parser) ternary() (ast.Expr, error) {
 			return nil, err
 		}
 
-		expr = ast.NewTernary(expr, operator1, left, operator2, right)
+		expr = spanned(p, ast.NewTernary(expr, operator1, left, operator2, right), expr.Span())
 	}
 
 	return expr, nil
@@ -489,7 +767,7 @@ func (p *Parser) logical_or() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return ast.NewLogical(expr, operator, right), nil
+		return spanned(p, ast.NewLogical(expr, operator, right), expr.Span()), nil
 	}
 
 	return expr, nil
@@ -509,7 +787,7 @@ func (p *Parser) logical_and() (ast.Expr, error) {
 			return nil, err
 		}
 
-		return ast.NewLogical(expr, operator, right), nil
+		return spanned(p, ast.NewLogical(expr, operator, right), expr.Span()), nil
 	}
 
 	return expr, nil
@@ -529,7 +807,7 @@ func (p *Parser) equality() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = ast.NewBinary(expr, operator, right)
+		expr = spanned(p, ast.NewBinary(expr, operator, right), expr.Span())
 	}
 
 	return expr, nil
@@ -549,7 +827,7 @@ func (p *Parser) comparison() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = ast.NewBinary(expr, operator, right)
+		expr = spanned(p, ast.NewBinary(expr, operator, right), expr.Span())
 	}
 
 	return expr, nil
@@ -568,7 +846,7 @@ func (p *Parser) term() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = ast.NewBinary(expr, operator, right)
+		expr = spanned(p, ast.NewBinary(expr, operator, right), expr.Span())
 	}
 
 	return expr, nil
@@ -587,7 +865,7 @@ func (p *Parser) factor() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = ast.NewBinary(expr, operator, right)
+		expr = spanned(p, ast.NewBinary(expr, operator, right), expr.Span())
 	}
 
 	return expr, nil
@@ -601,7 +879,7 @@ func (p *Parser) unary() (ast.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return ast.NewUnary(operator, right), nil
+		return spanned(p, ast.NewUnary(operator, right), operator.Span), nil
 	}
 
 	return p.call()
@@ -625,7 +903,20 @@ func (p *Parser) call() (ast.Expr, error) {
 				return nil, err
 			}
 
-			expr = ast.NewGet(expr, name)
+			expr = spanned(p, ast.NewGet(expr, name), expr.Span())
+		} else if p.match(token.LEFT_BRACKET) {
+			bracket := p.previous()
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = p.consume(token.RIGHT_BRACKET, "Expect ']' after index.")
+			if err != nil {
+				return nil, err
+			}
+
+			expr = spanned(p, ast.NewSubscript(expr, bracket, index), expr.Span())
 		} else {
 			break
 		}
@@ -662,32 +953,65 @@ func (p *Parser) finishCall(callee ast.Expr) (ast.Expr, error) {
 		return nil, err
 	}
 
-	return ast.NewCall(callee, paren, arguments), nil
+	return spanned(p, ast.NewCall(callee, paren, arguments), callee.Span()), nil
 }
 
 func (p *Parser) primary() (ast.Expr, error) {
+	start := p.peek().Span
 	if p.match(token.FALSE) {
-		return ast.NewLiteral(false), nil
+		return spanned(p, ast.NewLiteral(false), start), nil
 	}
 
 	if p.match(token.TRUE) {
-		return ast.NewLiteral(true), nil
+		return spanned(p, ast.NewLiteral(true), start), nil
 	}
 
 	if p.match(token.NIL) {
-		return ast.NewLiteral(nil), nil
+		return spanned(p, ast.NewLiteral(nil), start), nil
 	}
 
 	if p.match(token.NUMBER, token.STRING) {
-		return ast.NewLiteral(p.previous().Literal), nil
+		return spanned(p, ast.NewLiteral(p.previous().Literal), start), nil
 	} 
 
+	if p.match(token.INTERPOLATION) {
+		return p.interpolation()
+	}
+
+	if p.match(token.FUN) {
+		return p.lambda()
+	}
+
+	if p.match(token.SUPER) {
+		keyword := p.previous()
+		_, err := p.consume(token.DOT, "Expect '.' after 'super'.")
+		if err != nil {
+			return nil, err
+		}
+
+		method, err := p.consume(token.IDENTIFIER, "Expect superclass method name.")
+		if err != nil {
+			return nil, err
+		}
+		return spanned(p, ast.NewSuper(keyword, method), start), nil
+	}
+
 	if p.match(token.THIS) {
-		return ast.NewThis(p.previous()), nil
+		return spanned(p, ast.NewThis(p.previous()), start), nil
 	}
 
 	if p.match(token.IDENTIFIER) {
-		return ast.NewVariable(p.previous()), nil
+		return spanned(p, ast.NewVariable(p.previous()), start), nil
+	}
+
+	if p.match(token.LEFT_BRACKET) {
+		return p.list()
+	}
+
+	// A '{' at the start of a statement is always a block, so one reaching
+	// this point must be in expression position and begins a map literal
+	if p.match(token.LEFT_BRACE) {
+		return p.mapLiteral()
 	}
 
 	if p.match(token.LEFT_PAREN) {
@@ -698,42 +1022,196 @@ func (p *Parser) primary() (ast.Expr, error) {
 		if !p.match(token.RIGHT_PAREN) {
 			return nil, lox_error.NewParseError(p.peek(), "Expect ')' after expression.")
 		}
-		return ast.NewGrouping(expr), nil
+		return spanned(p, ast.NewGrouping(expr), start), nil
 	}
 
 	return nil, lox_error.NewParseError(p.peek(), "Expecting expression.")
 }
 
 
+// Desugars an interpolated string such as "a ${x} b" into concatenation. Each
+// part is joined to the string before it by an INTERPOLATION operator, which
+// converts the part to a string first.
+func (p *Parser) interpolation() (ast.Expr, error) {
+	start := p.previous().Span
+	var expr ast.Expr = spanned(p, ast.NewLiteral(p.previous().Literal), start)
+	for {
+		operator := p.previous()
+		if p.resumesString() {
+			return nil, lox_error.NewParseError(operator, "Expect expression after '${'.")
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		joined := ast.NewBinary(expr, operator, value)
+
+		if !p.resumesString() {
+			return nil, lox_error.NewParseError(p.peek(), "Expect '}' after interpolated expression.")
+		}
+		part := p.advance()
+		if part.Literal != "" {
+			literal := ast.NewLiteral(part.Literal)
+			literal.SetSpan(part.Span)
+			operator := part
+			operator.Type = token.INTERPOLATION
+			joined = ast.NewBinary(spanned(p, joined, start), operator, literal)
+		}
+		// Either way the expression spans the string so far
+		expr = spanned(p, joined, start)
+		if part.Type == token.STRING {
+			return expr, nil
+		}
+	}
+}
+
+// Reports whether the next token is the rest of a string, scanned from the }
+// ending an interpolated expression
+func (p *Parser) resumesString() bool {
+	return (p.check(token.INTERPOLATION) || p.check(token.STRING)) && strings.HasPrefix(p.peek().Lexeme, "}")
+}
+
+func (p *Parser) list() (ast.Expr, error) {
+	bracket := p.previous()
+	elements := []ast.Expr{}
+	if !p.check(token.RIGHT_BRACKET) {
+		for {
+			element, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after list elements.")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, ast.NewList(bracket, elements), bracket.Span), nil
+}
+
+
+func (p *Parser) mapLiteral() (ast.Expr, error) {
+	brace := p.previous()
+	keys := []ast.Expr{}
+	values := []ast.Expr{}
+	if !p.check(token.RIGHT_BRACE) {
+		for {
+			key, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = p.consume(token.COLON, "Expect ':' after map key.")
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, key)
+			values = append(values, value)
+
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, err := p.consume(token.RIGHT_BRACE, "Expect '}' after map entries.")
+	if err != nil {
+		return nil, err
+	}
+
+	return spanned(p, ast.NewMap(brace, keys, values), brace.Span), nil
+}
+
+
 // Continues parsing tokens until it reaches a statement boundary
 // Used after ParseError is thrown
 func (p *Parser) synchronize() {
-	p.advance()
-
+	// Braces opened while skipping are skipped as a whole, but a '}' closing
+	// the block we're in is left for block() to consume
+	depth := 0
 	for !p.isAtEnd() {
-		if p.previous().Type == token.SEMICOLON {
+		stray := false
+		switch p.peek().Type {
+			case token.LEFT_BRACE:
+				depth++
+			case token.RIGHT_BRACE:
+				if depth == 0 && p.blockDepth > 0 {
+					return
+				}
+				// A stray '}' at the top level closes nothing, so it doesn't
+				// end the statement either
+				stray = depth == 0
+				depth = max(depth - 1, 0)
+		}
+		p.advance()
+
+		if depth > 0 {
+			continue
+		}
+		if p.previous().Type == token.SEMICOLON || (p.previous().Type == token.RIGHT_BRACE && !stray) {
 			return
 		}
 
-		switch p.peek().Type {
-			case token.CLASS:
-			case token.FUN:
-			case token.VAR:
-			case token.FOR:
-			case token.IF:
-			case token.WHILE:
-			case token.PRINT:
-			case token.RETURN:
-				return
+		if p.atStatementStart() {
+			return
 		}
+	}
+}
+
+// Reports whether the current token is a keyword that starts a statement
+func (p *Parser) atStatementStart() bool {
+	switch p.peek().Type {
+		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE,
+			token.PRINT, token.RETURN, token.IMPORT, token.FROM, token.THROW, token.TRY:
+			return true
+	}
+	return false
+}
 
+// Skips past a method with a syntax error, to the start of the next method
+// or the '}' closing the class
+func (p *Parser) synchronizeMethod() {
+	depth := 0
+	for !p.isAtEnd() {
+		switch p.peek().Type {
+			case token.LEFT_BRACE:
+				depth++
+			case token.RIGHT_BRACE:
+				if depth == 0 {
+					return
+				}
+				depth--
+		}
 		p.advance()
+
+		if depth == 0 && p.previous().Type == token.RIGHT_BRACE {
+			return
+		}
 	}
 }
 
 
 /* HELPERS */
 
+// Records that node spans from start through the most recently consumed token
+func spanned[T interface{ SetSpan(token.Span) }](p *Parser, node T, start token.Span) T {
+	node.SetSpan(start.To(p.previous().Span))
+	return node
+}
+
 // Check if the current token has any of the given type. If so, it consumes the token
 // and returns true. Otherwise, it returns false and leaves the token alone.
 func (p *Parser) match(tokenTypes ...token.TokenType) bool {
@@ -763,6 +1241,15 @@ func (p *Parser) check(tokenType token.TokenType) bool {
 	return p.peek().Type == tokenType
 }
 
+// Check if the token after the current one is of the given type
+func (p *Parser) checkNext(tokenType token.TokenType) bool {
+	if p.isAtEnd() || p.tokens[p.curr + 1].Type == token.EOF {
+		return false
+	}
+
+	return p.tokens[p.curr + 1].Type == tokenType
+}
+
 // Advance to the next token in the sequence
 func (p *Parser) advance() token.Token {
 	if !p.isAtEnd() {
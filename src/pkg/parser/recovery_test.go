@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// Every syntax error in a program is reported, and none of them cascade
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		expected []string
+	}{
+		{
+			"statements",
+			"var = 1;\nprint 2;\nprint x\nvar y = (1 + ;\nprint y;\n",
+			[]string{
+				"[line 1, column 5] at '=': Expect variable name.",
+				"[line 4, column 1] at 'var': Expect ';' after value.",
+				"[line 4, column 14] at ';': Expecting expression.",
+			},
+		},
+		{
+			"inside blocks",
+			"fun f() {\n  var = 1;\n  print 2;\n  if (true { print 3; }\n}\nprint f(;\n",
+			[]string{
+				"[line 2, column 7] at '=': Expect variable name.",
+				"[line 4, column 12] at '{': Expect ')' after 'if'.",
+				"[line 6, column 9] at ';': Expecting expression.",
+			},
+		},
+		{
+			"methods",
+			"class A {\n  m( {}\n  n() { return 1 }\n  1\n}\nprint A;\nclass {}\nfun g(a, {}\n",
+			[]string{
+				"[line 2, column 6] at '{': Expect parameter name.",
+				"[line 3, column 18] at '}': Expect ';' after return value.",
+				"[line 4, column 3] at '1': Expect method name.",
+				"[line 7, column 7] at '{': Expect class name.",
+				"[line 8, column 10] at '{': Expect parameter name.",
+			},
+		},
+		{
+			"expressions",
+			"print [1, 2;\nprint {1: };\nx = = 2;\n1 + 2 = 3;\nprint fun (a) { return a + ; };\n",
+			[]string{
+				"[line 1, column 12] at ';': Expect ']' after list elements.",
+				"[line 2, column 11] at '}': Expecting expression.",
+				"[line 3, column 5] at '=': Expecting expression.",
+				"[line 4, column 7] at '=': Invalid assignment target.",
+				"[line 5, column 28] at ';': Expecting expression.",
+			},
+		},
+		{
+			"unterminated block",
+			"{\n  print 1\n",
+			[]string{
+				"[line 3, column 1] at '': Expect ';' after value.",
+				"[line 3, column 1] at '': Expect '}' after block.",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := scanner.NewScanner(test.source).ScanTokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			statements, err := NewParser(tokens).Parse()
+			if statements != nil {
+				t.Errorf("expected no statements, got %d", len(statements))
+			}
+			list, ok := err.(lox_error.ErrorList)
+			if !ok {
+				t.Fatalf("expected an ErrorList, got %v", err)
+			}
+
+			actual := []string{}
+			for _, e := range list {
+				actual = append(actual, strings.TrimPrefix(e.Error(), "Syntax error at "))
+			}
+			if strings.Join(actual, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected:\n%s\nactual:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
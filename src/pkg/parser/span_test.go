@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/internal/ast"
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Each node spans exactly the source it was parsed from
+func TestSpans(t *testing.T) {
+	source := "var total = add(1, 2) * -x;\nif (total > 2) {\n  print [total, {\"a\": 1}];\n}\n"
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := func(span token.Span) string {
+		return source[span.Start:span.End]
+	}
+	declaration := statements[0].(*stmt.Var)
+	product := declaration.Initializer.(*ast.Binary)
+	branch := statements[1].(*stmt.If)
+	block := branch.ThenBranch.(*stmt.Block)
+	list := block.Statements[0].(*stmt.Print).Expr.(*ast.List)
+
+	tests := []struct {
+		span token.Span
+		expected string
+	}{
+		{declaration.Span(), "var total = add(1, 2) * -x;"},
+		{product.Span(), "add(1, 2) * -x"},
+		{product.Left.Span(), "add(1, 2)"},
+		{product.Right.Span(), "-x"},
+		{branch.Span(), "if (total > 2) {\n  print [total, {\"a\": 1}];\n}"},
+		{branch.Condition.Span(), "total > 2"},
+		{block.Span(), "{\n  print [total, {\"a\": 1}];\n}"},
+		{block.Statements[0].Span(), "print [total, {\"a\": 1}];"},
+		{list.Span(), "[total, {\"a\": 1}]"},
+		{list.Elements[1].Span(), "{\"a\": 1}"},
+	}
+	for _, test := range tests {
+		if actual := text(test.span); actual != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+	}
+
+	if span := branch.Span(); span.Line != 2 || span.Column != 1 {
+		t.Errorf("if at line %d, column %d", span.Line, span.Column)
+	}
+	if span := list.Span(); span.Line != 3 || span.Column != 9 {
+		t.Errorf("list at line %d, column %d", span.Line, span.Column)
+	}
+}
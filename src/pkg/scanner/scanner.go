@@ -2,6 +2,8 @@ package scanner
 
 import (
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/lidanielm/glox/src/pkg/lox_error"
 	"github.com/lidanielm/glox/src/pkg/token"
@@ -13,6 +15,17 @@ type Scanner struct {
 	start int
 	current int
 	line int
+	lineStart int // offset of the first byte of the current line
+	startLine int // line and column of the token being scanned
+	startColumn int
+	comments []token.Token
+	interpolations []interpolation // the ${ being scanned, innermost last
+}
+
+// interpolation is a ${ in a string whose expression is being scanned
+type interpolation struct {
+	braces int // unclosed '{' inside the expression
+	start token.Token // the ${, for reporting it unterminated
 }
 
 func NewScanner(source string) *Scanner {
@@ -23,16 +36,29 @@ func NewScanner(source string) *Scanner {
 func (scan *Scanner) ScanTokens() ([]token.Token, error) {
 	for !scan.isEOF() {
 		scan.start = scan.current
+		scan.startLine = scan.line
+		scan.startColumn = scan.current - scan.lineStart + 1
 		err := scan.scanToken()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	scan.tokens = append(scan.tokens, *token.NewToken(token.EOF, "", nil, scan.line))
+	if len(scan.interpolations) > 0 {
+		return nil, lox_error.NewError(scan.interpolations[len(scan.interpolations) - 1].start, "Unterminated string interpolation.")
+	}
+
+	eof := token.Span{Line: scan.line, Column: scan.current - scan.lineStart + 1, Start: scan.current, End: scan.current}
+	scan.tokens = append(scan.tokens, *token.NewTokenAt(token.EOF, "", nil, eof))
 	return scan.tokens, nil
 }
 
+// Returns the comments found by ScanTokens, in source order. They aren't
+// part of the token stream, but tools like the formatter need them.
+func (scan *Scanner) Comments() []token.Token {
+	return scan.comments
+}
+
 func (scan *Scanner) scanToken() error {
 	switch c := scan.advance(); c {
 	case '(':
@@ -40,9 +66,24 @@ func (scan *Scanner) scanToken() error {
 	case ')':
 		scan.addToken(token.RIGHT_PAREN)
 	case '{':
+		if n := len(scan.interpolations); n > 0 {
+			scan.interpolations[n - 1].braces++
+		}
 		scan.addToken(token.LEFT_BRACE)
 	case '}':
+		if n := len(scan.interpolations); n > 0 {
+			if scan.interpolations[n - 1].braces == 0 {
+				// The end of an interpolated expression, so the string resumes
+				scan.interpolations = scan.interpolations[:n - 1]
+				return scan.addString()
+			}
+			scan.interpolations[n - 1].braces--
+		}
 		scan.addToken(token.RIGHT_BRACE)
+	case '[':
+		scan.addToken(token.LEFT_BRACKET)
+	case ']':
+		scan.addToken(token.RIGHT_BRACKET)
 	case ',':
 		scan.addToken(token.COMMA)
 	case '.':
@@ -53,6 +94,8 @@ func (scan *Scanner) scanToken() error {
 		scan.addToken(token.PLUS)
 	case ';':
 		scan.addToken(token.SEMICOLON)
+	case ':':
+		scan.addToken(token.COLON)
 	case '*':
 		scan.addToken(token.STAR)
 	case '!':
@@ -84,6 +127,7 @@ func (scan *Scanner) scanToken() error {
 			for !scan.isEOF() && scan.peek() != '\n' {
 				scan.advance()
 			}
+			scan.comments = append(scan.comments, *token.NewTokenAt(token.COMMENT, scan.source[scan.start:scan.current], nil, scan.span()))
 		} else {
 			scan.addToken(token.SLASH)
 		}
@@ -91,45 +135,122 @@ func (scan *Scanner) scanToken() error {
 	case '\r':
 	case '\t':
 	case '\n':
-		scan.line++
+		scan.newline()
 	case '"':
-		scan.addString()
-	case 'o':
-		if scan.matchNext('r') {
-			scan.addToken(token.OR)
-			break
-		}
-		fallthrough
+		return scan.addString()
+	case '`':
+		return scan.addRawString()
 	default:
 		if isDigit(c) {
-			scan.addNumber()
+			return scan.addNumber()
 		} else if isAlpha(c) {
 			scan.addIdentifier()
 		} else {
-			return lox_error.NewError(*token.NewToken(token.ERROR, string(c), nil, scan.line), "Unexpected character.")
+			return lox_error.NewError(scan.errorToken(), "Unexpected character.")
 		}
 	}
 	return nil
 }
 
+// Scans a string from after its opening quote, or after the } ending an
+// interpolated expression, to its closing quote or the next ${
 func (scan *Scanner) addString() error {
-	if scan.isEOF() {
-		return lox_error.NewError(*token.NewToken(token.ERROR, "", nil, scan.line), "Unterminated string.")
-	}
-
+	var value strings.Builder
 	for !scan.isEOF() && scan.peek() != '"' {
-		if scan.peek() == '\n' {
-			scan.line++
+		c := scan.advance()
+		switch {
+		case c == '\n':
+			scan.newline()
+			value.WriteByte(c)
+		case c == '\\':
+			err := scan.escape(&value)
+			if err != nil {
+				return err
+			}
+		case c == '$' && !scan.isEOF() && scan.peek() == '{':
+			scan.advance()
+			start := scan.tokenFrom(scan.current - 2)
+			scan.interpolations = append(scan.interpolations, interpolation{start: start})
+			scan.addTokenLiteral(token.INTERPOLATION, value.String())
+			return nil
+		default:
+			value.WriteByte(c)
 		}
+	}
 
-		scan.advance()
+	if scan.isEOF() {
+		// Point at the opening quote rather than the rest of the file
+		quote := scan.span()
+		quote.End = quote.Start + 1
+		return lox_error.NewError(*token.NewTokenAt(token.ERROR, scan.source[quote.Start:quote.End], nil, quote), "Unterminated string.")
 	}
 
 	// Last '"'
 	scan.advance()
 
-    str := scan.source[scan.start + 1:scan.current - 1]
-	scan.addTokenLiteral(token.STRING, str)
+	scan.addTokenLiteral(token.STRING, value.String())
+	return nil
+}
+
+// Decodes the escape sequence after a backslash in a string
+func (scan *Scanner) escape(value *strings.Builder) error {
+	start := scan.current - 1
+	if scan.isEOF() {
+		// Reported as an unterminated string
+		return nil
+	}
+
+	switch c := scan.advance(); c {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '0':
+		value.WriteByte(0)
+	case '"', '\\', '$':
+		value.WriteByte(c)
+	case 'u':
+		// \u{...} with 1 to 6 hex digits
+		if !scan.matchNext('{') {
+			return lox_error.NewError(scan.tokenFrom(start), "Invalid Unicode escape, expected \\u{...}.")
+		}
+		digits := scan.current
+		for !scan.isEOF() && isHexDigit(scan.peek()) {
+			scan.advance()
+		}
+		code, err := strconv.ParseUint(scan.source[digits:scan.current], 16, 32)
+		if !scan.matchNext('}') || scan.current - digits > 7 || err != nil || !utf8.ValidRune(rune(code)) {
+			return lox_error.NewError(scan.tokenFrom(start), "Invalid Unicode escape, expected \\u{...} with a code point.")
+		}
+		value.WriteRune(rune(code))
+	default:
+		// Take the whole character, which may be more than one byte
+		_, size := utf8.DecodeRuneInString(scan.source[scan.current - 1:])
+		scan.current += size - 1
+		return lox_error.NewError(scan.tokenFrom(start), "Invalid escape sequence.")
+	}
+	return nil
+}
+
+// Scans a raw string from after its opening backtick. It may span lines and
+// has no escapes or interpolation.
+func (scan *Scanner) addRawString() error {
+	for !scan.isEOF() && scan.peek() != '`' {
+		if scan.advance() == '\n' {
+			scan.newline()
+		}
+	}
+
+	if scan.isEOF() {
+		quote := scan.span()
+		quote.End = quote.Start + 1
+		return lox_error.NewError(*token.NewTokenAt(token.ERROR, "`", nil, quote), "Unterminated string.")
+	}
+
+	scan.advance()
+	scan.addTokenLiteral(token.STRING, scan.source[scan.start + 1:scan.current - 1])
 	return nil
 }
 
@@ -153,12 +274,12 @@ func (scan *Scanner) addNumber() error {
 
     // Validate number
 	if numStr[len(numStr) - 1] == '.' {
-		return lox_error.NewError(*token.NewToken(token.ERROR, "", nil, scan.line), "Invalid number (trailing decimal point).")
+		return lox_error.NewError(scan.errorToken(), "Invalid number (trailing decimal point).")
 	}
 
 	num, err := strconv.ParseFloat(numStr, 64)
 	if err != nil {
-		return lox_error.NewError(*token.NewToken(token.ERROR, "", nil, scan.line), "Invalid number.")
+		return lox_error.NewError(scan.errorToken(), "Invalid number.")
 	}
 
     // Add token
@@ -216,7 +337,30 @@ func (scan *Scanner) addToken(typ token.TokenType) {
 
 func (scan *Scanner) addTokenLiteral(typ token.TokenType, literal interface{}) {
 	text := scan.source[scan.start:scan.current]
-	scan.tokens = append(scan.tokens, *token.NewToken(typ, text, literal, scan.line))
+	scan.tokens = append(scan.tokens, *token.NewTokenAt(typ, text, literal, scan.span()))
+}
+
+// Span of the token being scanned, up to the current position
+func (scan *Scanner) span() token.Span {
+	return token.Span{Line: scan.startLine, Column: scan.startColumn, Start: scan.start, End: scan.current}
+}
+
+// Token pointing at the text scanned so far, for reporting errors
+func (scan *Scanner) errorToken() token.Token {
+	return *token.NewTokenAt(token.ERROR, scan.source[scan.start:scan.current], nil, scan.span())
+}
+
+// Token for the text from start to the current position, which must be on
+// the current line
+func (scan *Scanner) tokenFrom(start int) token.Token {
+	span := token.Span{Line: scan.line, Column: start - scan.lineStart + 1, Start: start, End: scan.current}
+	return *token.NewTokenAt(token.ERROR, scan.source[start:scan.current], nil, span)
+}
+
+// Called after consuming a '\n'
+func (scan *Scanner) newline() {
+	scan.line++
+	scan.lineStart = scan.current
 }
 
 func (scan *Scanner) isEOF() bool {
@@ -227,6 +371,10 @@ func isDigit(c byte) bool {
 	return int(c) >= 48 && int(c) <= 57
 }
 
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
 func isAlpha(c byte) bool {
 	return (int(c) >= 65 && int(c) <= 90) || (int(c) >= 97 && int(c) <= 122) || c == '_'
 }
@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+func TestSpans(t *testing.T) {
+	source := "var x = 1.5;\n  print \"a\nb\" + x; // done\n"
+	scan := NewScanner(source)
+	tokens, err := scan.ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []token.Span{
+		{Line: 1, Column: 1, Start: 0, End: 3}, // var
+		{Line: 1, Column: 5, Start: 4, End: 5}, // x
+		{Line: 1, Column: 7, Start: 6, End: 7}, // =
+		{Line: 1, Column: 9, Start: 8, End: 11}, // 1.5
+		{Line: 1, Column: 12, Start: 11, End: 12}, // ;
+		{Line: 2, Column: 3, Start: 15, End: 20}, // print
+		{Line: 2, Column: 9, Start: 21, End: 26}, // "a\nb", which starts on line 2
+		{Line: 3, Column: 4, Start: 27, End: 28}, // +
+		{Line: 3, Column: 6, Start: 29, End: 30}, // x
+		{Line: 3, Column: 7, Start: 30, End: 31}, // ;
+		{Line: 4, Column: 1, Start: 40, End: 40}, // EOF
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokens: %v", tokens)
+	}
+	for i, span := range expected {
+		if tokens[i].Span != span {
+			t.Errorf("token %d %q: expected %+v, got %+v", i, tokens[i].Lexeme, span, tokens[i].Span)
+		}
+		if tokens[i].Type != token.EOF && source[span.Start:span.End] != tokens[i].Lexeme {
+			t.Errorf("token %d: lexeme %q isn't its source %q", i, tokens[i].Lexeme, source[span.Start:span.End])
+		}
+	}
+
+	comments := scan.Comments()
+	if len(comments) != 1 || comments[0].Span != (token.Span{Line: 3, Column: 9, Start: 32, End: 39}) {
+		t.Errorf("comments: %+v", comments)
+	}
+}
+
+// Columns count bytes, so they match the offsets editors are given
+func TestSpansAfterMultibyte(t *testing.T) {
+	tokens, err := NewScanner("print \"é\" + x;").ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span := tokens[3].Span; span != (token.Span{Line: 1, Column: 14, Start: 13, End: 14}) {
+		t.Errorf("x: %+v", span)
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	_, err := NewScanner("var a;\nvar b = @;").ScanTokens()
+	loxError, ok := err.(*lox_error.LoxError)
+	if !ok {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	if loxError.Token.Span != (token.Span{Line: 2, Column: 9, Start: 15, End: 16}) || loxError.Message != " at '@': Unexpected character." {
+		t.Errorf("error %+v", loxError)
+	}
+}
@@ -0,0 +1,134 @@
+// Package testrunner finds and runs tests written in Lox. A test is a
+// top-level function named test_* in a file named *_test.lox.
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+// Result is the outcome of a single test function
+type Result struct {
+	Name string
+	Err error // nil if the test passed
+	Output string // everything the test printed, including diagnostics
+	Elapsed time.Duration
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Returns the test files under each path in lexical order. Paths naming a
+// file are used as given.
+func Discover(paths ...string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), "_test.lox") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// File is a parsed test file
+type File struct {
+	Path string
+	Source string
+	Tests []string // test function names in the order they are declared
+	statements []stmt.Stmt
+}
+
+// Reads and parses a test file, returning the syntax errors if it has any
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := scanner.NewScanner(string(data)).ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Path: path, Source: string(data), statements: statements}
+	for _, statement := range statements {
+		if function, ok := statement.(stmt.Function); ok && strings.HasPrefix(function.Name.Lexeme, "test_") {
+			file.Tests = append(file.Tests, function.Name.Lexeme)
+		}
+	}
+	return file, nil
+}
+
+// Runs one test in a fresh interpreter: the file's top-level code runs
+// first, then the test function is called with no arguments
+func (f *File) Run(name string) Result {
+	var output bytes.Buffer
+	ip := interpreter.NewInterpreter(interpreter.WithOutput(&output), interpreter.WithDiagnostics(&output))
+	ip.SetSource(f.Source)
+
+	start := time.Now()
+	err := f.run(ip, name)
+	return Result{Name: name, Err: err, Output: output.String(), Elapsed: time.Since(start)}
+}
+
+func (f *File) run(ip *interpreter.Interpreter, name string) error {
+	err := ip.SetPath(f.Path)
+	if err != nil {
+		return err
+	}
+
+	_, err = interpreter.NewResolver(ip).ResolveStmts(f.statements)
+	if err != nil {
+		return err
+	}
+
+	_, err = ip.Run(f.statements)
+	if err != nil {
+		return err
+	}
+
+	value, _ := ip.LookupGlobal(name)
+	test, ok := value.(interpreter.Callable)
+	if !ok || test.Arity() != 0 {
+		return errors.New("Test '" + name + "' must be a function with no parameters.")
+	}
+
+	_, err = ip.Call(context.Background(), test, []any{})
+	return err
+}
@@ -0,0 +1,84 @@
+package testrunner
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	files, err := Discover("testdata", filepath.Join("testdata", "helper.lox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files given by name are used even if they aren't named *_test.lox
+	expected := []string{
+		filepath.Join("testdata", "math_test.lox"),
+		filepath.Join("testdata", "nested", "broken_test.lox"),
+		filepath.Join("testdata", "nested", "state_test.lox"),
+		filepath.Join("testdata", "helper.lox"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, found %v", expected, files)
+	}
+
+	if _, err := Discover("testdata/missing"); err == nil {
+		t.Error("no error for a missing path")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file, err := Load(filepath.Join("testdata", "math_test.lox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"test_add", "test_lists", "test_fails", "test_throws"}
+	if !reflect.DeepEqual(file.Tests, expected) {
+		t.Errorf("expected %v, found %v", expected, file.Tests)
+	}
+
+	_, err = Load(filepath.Join("testdata", "nested", "broken_test.lox"))
+	if err == nil || !strings.Contains(err.Error(), "Expect variable name.") {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		file string
+		name string
+		err string // "" if the test passes
+		output string
+	}{
+		{"math_test.lox", "test_add", "", ""},
+		{"math_test.lox", "test_lists", "", ""},
+		{"math_test.lox", "test_fails", "Assertion failed: expected [1, 3] but got [1, 2].", "checking\n"},
+		{"math_test.lox", "test_throws", "", ""},
+		{"nested/state_test.lox", "test_first", "", ""},
+		{"nested/state_test.lox", "test_second", "", ""},
+		{"nested/state_test.lox", "test_arguments", "Test 'test_arguments' must be a function with no parameters.", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := Load(filepath.Join("testdata", filepath.FromSlash(test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := file.Run(test.name)
+			if result.Name != test.name || result.Output != test.output {
+				t.Errorf("result: %+v", result)
+			}
+			if test.err == "" {
+				if !result.Passed() {
+					t.Errorf("failed: %v", result.Err)
+				}
+			} else if result.Passed() || !strings.Contains(result.Err.Error(), test.err) {
+				t.Errorf("expected an error containing %q, got %v", test.err, result.Err)
+			}
+		})
+	}
+}
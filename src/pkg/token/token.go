@@ -2,17 +2,36 @@ package token
 
 import "fmt"
 
+// Span locates a token or syntax node in its source. Start and End are byte
+// offsets with End exclusive; Line and Column (both from 1) locate Start.
+type Span struct {
+	Line int
+	Column int
+	Start int
+	End int
+}
+
+// Returns a span covering both s and end, which must not come before s
+func (s Span) To(end Span) Span {
+	return Span{Line: s.Line, Column: s.Column, Start: s.Start, End: max(s.End, end.End)}
+}
+
 type Token struct {
 	Type TokenType
 	Lexeme string
 	Literal any
-	Line int
+	Span
 }
 
 func NewToken(typ TokenType, lexeme string, literal any, line int) *Token {
-	return &Token{Type: typ, Lexeme: lexeme, Literal: literal, Line: line}
+	return &Token{Type: typ, Lexeme: lexeme, Literal: literal, Span: Span{Line: line}}
+}
+
+// Like NewToken, but for a token whose exact position in the source is known
+func NewTokenAt(typ TokenType, lexeme string, literal any, span Span) *Token {
+	return &Token{Type: typ, Lexeme: lexeme, Literal: literal, Span: span}
 }
 
 func (token *Token) ToString() string {
-	return "Type: " + string(byte(token.Type)) + ", Lexeme: " + token.Lexeme + ", Literal: " + fmt.Sprintf("%v", token.Literal)
+	return "Type: " + token.Type.String() + ", Lexeme: " + token.Lexeme + ", Literal: " + fmt.Sprintf("%v", token.Literal)
 }
@@ -1,5 +1,7 @@
 package token
 
+import "strconv"
+
 type TokenType int
 
 const (
@@ -8,6 +10,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
 	DOT
 	MINUS
@@ -15,10 +19,10 @@ const (
 	SEMICOLON
 	COLON
 	SLASH
-	STAR // 11
+	STAR // 13
 
 	// One or two character tokens
-	BANG // 12
+	BANG // 14
 	BANG_EQUAL
 	EQUAL
 	EQUAL_EQUAL
@@ -26,15 +30,19 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
-	INTERRO // 20
+	INTERRO // 22
   
 	// Literals
-	IDENTIFIER // 21
+	IDENTIFIER // 23
 	STRING
-	NUMBER // 23
+	NUMBER // 25
+	// A string up to a ${, whose literal is the text before it. Also the
+	// operator the parser joins the parts of an interpolated string with,
+	// which appends its right operand as a string.
+	INTERPOLATION // 26
   
 	// Keywords
-	AND // 24
+	AND // 27
 	CLASS
 	ELSE
 	FALSE
@@ -51,10 +59,18 @@ const (
 	VAR
 	WHILE
 	BREAK
-	CONTINUE // 41
+	CONTINUE
+	IMPORT
+	FROM
+	AS
+	THROW
+	TRY
+	CATCH
+	FINALLY // 51
   
-	EOF // 42
+	EOF // 52
 	ERROR
+	COMMENT // kept aside by the scanner, never passed to the parser
 )
 
 var Keywords = map[string]TokenType{
@@ -76,4 +92,28 @@ var Keywords = map[string]TokenType{
 	"while":  WHILE,
 	"break": BREAK,
 	"continue": CONTINUE,
-}
\ No newline at end of file
+	"import": IMPORT,
+	"from": FROM,
+	"as": AS,
+	"throw": THROW,
+	"try": TRY,
+	"catch": CATCH,
+	"finally": FINALLY,
+}
+var names = [...]string{
+	"LEFT_PAREN", "RIGHT_PAREN", "LEFT_BRACE", "RIGHT_BRACE", "LEFT_BRACKET", "RIGHT_BRACKET",
+	"COMMA", "DOT", "MINUS", "PLUS", "SEMICOLON", "COLON", "SLASH", "STAR",
+	"BANG", "BANG_EQUAL", "EQUAL", "EQUAL_EQUAL", "GREATER", "GREATER_EQUAL", "LESS", "LESS_EQUAL", "INTERRO",
+	"IDENTIFIER", "STRING", "NUMBER", "INTERPOLATION",
+	"AND", "CLASS", "ELSE", "FALSE", "FUN", "FOR", "IF", "NIL", "OR", "PRINT", "RETURN", "SUPER", "THIS", "TRUE", "VAR", "WHILE",
+	"BREAK", "CONTINUE", "IMPORT", "FROM", "AS", "THROW", "TRY", "CATCH", "FINALLY",
+	"EOF", "ERROR", "COMMENT",
+}
+
+// Names the token type as it is spelled in this package, e.g. "LEFT_PAREN"
+func (t TokenType) String() string {
+	if t < 0 || int(t) >= len(names) {
+		return "TokenType(" + strconv.Itoa(int(t)) + ")"
+	}
+	return names[t]
+}
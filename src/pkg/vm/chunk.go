@@ -0,0 +1,258 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota // u16 constant
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_DUP
+	OP_GET_LOCAL // u8 slot
+	OP_SET_LOCAL // u8 slot
+	OP_GET_GLOBAL // u16 name
+	OP_DEFINE_GLOBAL // u16 name
+	OP_SET_GLOBAL // u16 name
+	OP_GET_UPVALUE // u8 index
+	OP_SET_UPVALUE // u8 index
+	OP_GET_PROPERTY // u16 name
+	OP_SET_PROPERTY // u16 name
+	OP_GET_SUPER // u16 name
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_STRINGIFY // for interpolated strings
+	OP_PRINT
+	OP_JUMP // u16 forward offset
+	OP_JUMP_IF_FALSE // u16 forward offset, leaves the condition on the stack
+	OP_LOOP // u16 backward offset
+	OP_CALL // u8 argument count
+	OP_INVOKE // u16 name, u8 argument count
+	OP_CLOSURE // u16 function, then a u8 pair (is local, index) per upvalue
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS // u16 name
+	OP_INHERIT
+	OP_METHOD // u16 name
+	OP_LIST // u16 element count
+	OP_MAP // u16 entry count
+	OP_THROW
+	OP_TRY // u16 catch offset, u16 finally offset, u16 stack height
+	OP_END_TRY
+	OP_RETHROW
+	OP_IMPORT // u16 path
+	OP_MODULE
+)
+
+// Marks a missing catch or finally target in OP_TRY
+const noTarget = 0xffff
+
+var opNames = [...]string{
+	OP_CONSTANT: "OP_CONSTANT",
+	OP_NIL: "OP_NIL",
+	OP_TRUE: "OP_TRUE",
+	OP_FALSE: "OP_FALSE",
+	OP_POP: "OP_POP",
+	OP_DUP: "OP_DUP",
+	OP_GET_LOCAL: "OP_GET_LOCAL",
+	OP_SET_LOCAL: "OP_SET_LOCAL",
+	OP_GET_GLOBAL: "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL: "OP_SET_GLOBAL",
+	OP_GET_UPVALUE: "OP_GET_UPVALUE",
+	OP_SET_UPVALUE: "OP_SET_UPVALUE",
+	OP_GET_PROPERTY: "OP_GET_PROPERTY",
+	OP_SET_PROPERTY: "OP_SET_PROPERTY",
+	OP_GET_SUPER: "OP_GET_SUPER",
+	OP_GET_INDEX: "OP_GET_INDEX",
+	OP_SET_INDEX: "OP_SET_INDEX",
+	OP_EQUAL: "OP_EQUAL",
+	OP_GREATER: "OP_GREATER",
+	OP_GREATER_EQUAL: "OP_GREATER_EQUAL",
+	OP_LESS: "OP_LESS",
+	OP_LESS_EQUAL: "OP_LESS_EQUAL",
+	OP_ADD: "OP_ADD",
+	OP_SUBTRACT: "OP_SUBTRACT",
+	OP_MULTIPLY: "OP_MULTIPLY",
+	OP_DIVIDE: "OP_DIVIDE",
+	OP_NOT: "OP_NOT",
+	OP_NEGATE: "OP_NEGATE",
+	OP_STRINGIFY: "OP_STRINGIFY",
+	OP_PRINT: "OP_PRINT",
+	OP_JUMP: "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP: "OP_LOOP",
+	OP_CALL: "OP_CALL",
+	OP_INVOKE: "OP_INVOKE",
+	OP_CLOSURE: "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN: "OP_RETURN",
+	OP_CLASS: "OP_CLASS",
+	OP_INHERIT: "OP_INHERIT",
+	OP_METHOD: "OP_METHOD",
+	OP_LIST: "OP_LIST",
+	OP_MAP: "OP_MAP",
+	OP_THROW: "OP_THROW",
+	OP_TRY: "OP_TRY",
+	OP_END_TRY: "OP_END_TRY",
+	OP_RETHROW: "OP_RETHROW",
+	OP_IMPORT: "OP_IMPORT",
+	OP_MODULE: "OP_MODULE",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", op)
+}
+
+// Chunk is the compiled code of one function
+type Chunk struct {
+	Code []byte
+	Constants []any
+	positions []position // run-length encoded, by offset
+	constants map[any]int // index of each string and number constant, to share them
+}
+
+// position is the token that the code from offset onwards was compiled
+// from, until the next position. Errors are reported at it.
+type position struct {
+	offset int
+	tok token.Token
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{constants: make(map[any]int)}
+}
+
+func (c *Chunk) Write(b byte, tok token.Token) {
+	last := len(c.positions) - 1
+	if last < 0 || c.positions[last].tok.Span != tok.Span || c.positions[last].tok.Lexeme != tok.Lexeme {
+		c.positions = append(c.positions, position{offset: len(c.Code), tok: tok})
+	}
+	c.Code = append(c.Code, b)
+}
+
+// Adds a value to the constants table and returns its index. Strings and
+// numbers are only stored once.
+func (c *Chunk) AddConstant(value any) int {
+	switch value.(type) {
+	case string, float64:
+		if index, ok := c.constants[value]; ok {
+			return index
+		}
+		c.constants[value] = len(c.Constants)
+	}
+
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// Returns the token the instruction at offset was compiled from
+func (c *Chunk) Token(offset int) token.Token {
+	i := sort.Search(len(c.positions), func(i int) bool {
+		return c.positions[i].offset > offset
+	})
+	if i == 0 {
+		return token.Token{}
+	}
+	return c.positions[i - 1].tok
+}
+
+func (c *Chunk) Line(offset int) int {
+	return c.Token(offset).Line
+}
+
+// Lists the chunk's instructions, one per line, for debugging the compiler
+func (c *Chunk) Disassemble(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "== %s ==\n", name)
+	for offset := 0; offset < len(c.Code); {
+		offset = c.disassembleInstruction(&b, offset)
+	}
+	return b.String()
+}
+
+func (c *Chunk) disassembleInstruction(b *strings.Builder, offset int) int {
+	fmt.Fprintf(b, "%04d ", offset)
+	if offset > 0 && c.Line(offset) == c.Line(offset - 1) {
+		b.WriteString("   | ")
+	} else {
+		fmt.Fprintf(b, "%4d ", c.Line(offset))
+	}
+
+	op := OpCode(c.Code[offset])
+	short := func(at int) int {
+		return int(c.Code[at]) << 8 | int(c.Code[at + 1])
+	}
+
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL, OP_GET_PROPERTY, OP_SET_PROPERTY,
+		OP_GET_SUPER, OP_CLASS, OP_METHOD, OP_IMPORT:
+		index := short(offset + 1)
+		fmt.Fprintf(b, "%-16s %4d '%v'\n", op, index, c.Constants[index])
+		return offset + 3
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		fmt.Fprintf(b, "%-16s %4d\n", op, c.Code[offset + 1])
+		return offset + 2
+	case OP_LIST, OP_MAP:
+		fmt.Fprintf(b, "%-16s %4d\n", op, short(offset + 1))
+		return offset + 3
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		fmt.Fprintf(b, "%-16s %4d -> %d\n", op, offset, offset + 3 + short(offset + 1))
+		return offset + 3
+	case OP_LOOP:
+		fmt.Fprintf(b, "%-16s %4d -> %d\n", op, offset, offset + 3 - short(offset + 1))
+		return offset + 3
+	case OP_INVOKE:
+		index := short(offset + 1)
+		fmt.Fprintf(b, "%-16s (%d args) %4d '%v'\n", op, c.Code[offset + 3], index, c.Constants[index])
+		return offset + 4
+	case OP_TRY:
+		target := func(jump int) string {
+			if jump == noTarget {
+				return "-"
+			}
+			return fmt.Sprint(offset + 7 + jump)
+		}
+		fmt.Fprintf(b, "%-16s catch %s finally %s height %d\n", op, target(short(offset + 1)), target(short(offset + 3)), short(offset + 5))
+		return offset + 7
+	case OP_CLOSURE:
+		index := short(offset + 1)
+		function := c.Constants[index].(*Function)
+		fmt.Fprintf(b, "%-16s %4d %v\n", op, index, function)
+		offset += 3
+		for i := 0; i < function.upvalueCount; i++ {
+			kind := "upvalue"
+			if c.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(b, "%04d    |                     %s %d\n", offset, kind, c.Code[offset + 1])
+			offset += 2
+		}
+		return offset
+	}
+
+	fmt.Fprintf(b, "%s\n", op)
+	return offset + 1
+}
@@ -0,0 +1,1238 @@
+package vm
+
+import (
+	"slices"
+
+	"github.com/lidanielm/glox/src/pkg/internal/ast"
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type local struct {
+	name string
+	depth int
+	isCaptured bool
+}
+
+type upvalue struct {
+	index uint8
+	isLocal bool
+}
+
+// loop is an enclosing while or for loop, for compiling break and continue
+type loop struct {
+	localCount int // locals declared outside the loop body
+	regionCount int
+	breaks []int
+	continues []int
+}
+
+// region is the body of a try statement or of its catch clause. Jumping out
+// of one has to pop its exception handler and run its finally block first.
+type region struct {
+	localCount int // locals declared outside the region
+	hasHandler bool
+	finally *stmt.Block
+	returnSlot int // hidden local a return value waits in while finally runs
+}
+
+// Compiler turns a resolved syntax tree into bytecode, one Compiler per
+// function being compiled. Variables are resolved to stack slots, upvalues
+// or globals here rather than at runtime.
+type Compiler struct {
+	enclosing *Compiler
+	function *Function
+	locals []local
+	upvalues []upvalue
+	scopeDepth int
+	loops []*loop
+	regions []region
+	tok token.Token // token the next instructions are attributed to
+}
+
+func newCompiler(enclosing *Compiler, function *Function) *Compiler {
+	// Slot zero holds the receiver in methods and the callee otherwise
+	receiver := ""
+	if function.kind == METHOD || function.kind == INITIALIZER {
+		receiver = "this"
+	}
+
+	return &Compiler{enclosing: enclosing, function: function, locals: []local{{name: receiver}}}
+}
+
+// Compiles the top-level code of a file. A module's code ends by packing
+// its globals into a module value for the importer.
+func Compile(statements []stmt.Stmt, kind FunctionType, globals map[string]any, path string) (*Function, error) {
+	function := newFunction(kind, "", globals, path)
+	c := newCompiler(nil, function)
+	for _, statement := range statements {
+		err := c.statement(statement)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if kind == MODULE {
+		c.emitOp(OP_MODULE)
+		c.emitOp(OP_RETURN)
+	} else {
+		c.emitReturn()
+	}
+	return function, nil
+}
+
+func (c *Compiler) statement(statement stmt.Stmt) error {
+	return statement.Accept(c)
+}
+
+func (c *Compiler) expression(expr ast.Expr) error {
+	_, err := expr.Accept(c)
+	return err
+}
+
+/** STATEMENTS */
+func (c *Compiler) VisitExpressionStmt(stmt stmt.Expression) error {
+	err := c.expression(stmt.Expr)
+	if err != nil {
+		return err
+	}
+
+	c.emitOp(OP_POP)
+	return nil
+}
+
+func (c *Compiler) VisitPrintStmt(stmt stmt.Print) error {
+	err := c.expression(stmt.Expr)
+	if err != nil {
+		return err
+	}
+
+	c.emitOp(OP_PRINT)
+	return nil
+}
+
+func (c *Compiler) VisitVarStmt(stmt stmt.Var) error {
+	// A local is declared before its initializer, as the resolver does, so
+	// a lambda in the initializer can refer to it. The initializer's value
+	// ends up in its slot.
+	if c.scopeDepth > 0 {
+		c.tok = stmt.Name
+		err := c.addLocal(stmt.Name.Lexeme)
+		if err != nil {
+			return err
+		}
+	}
+
+	if stmt.Initializer != nil {
+		err := c.expression(stmt.Initializer)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	if c.scopeDepth > 0 {
+		return nil
+	}
+	c.tok = stmt.Name
+	return c.defineVariable(stmt.Name)
+}
+
+func (c *Compiler) VisitBlockStmt(stmt stmt.Block) error {
+	c.beginScope()
+	for _, statement := range stmt.Statements {
+		err := c.statement(statement)
+		if err != nil {
+			return err
+		}
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *Compiler) VisitIfStmt(stmt stmt.If) error {
+	err := c.expression(stmt.Condition)
+	if err != nil {
+		return err
+	}
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	err = c.statement(stmt.ThenBranch)
+	if err != nil {
+		return err
+	}
+
+	elseJump := c.emitJump(OP_JUMP)
+	err = c.patchJump(thenJump)
+	if err != nil {
+		return err
+	}
+	c.emitOp(OP_POP)
+
+	if stmt.ElseBranch != nil {
+		err = c.statement(stmt.ElseBranch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.patchJump(elseJump)
+}
+
+func (c *Compiler) VisitWhileStmt(stmt stmt.While) error {
+	loopStart := len(c.function.chunk.Code)
+	if stmt.Condition != nil {
+		err := c.expression(stmt.Condition)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emitOp(OP_TRUE)
+	}
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+
+	l := &loop{localCount: len(c.locals), regionCount: len(c.regions)}
+	c.loops = append(c.loops, l)
+	err := c.statement(stmt.Body)
+	c.loops = c.loops[:len(c.loops) - 1]
+	if err != nil {
+		return err
+	}
+
+	// 'continue' still runs the increment of a for-loop
+	for _, jump := range l.continues {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	if stmt.Increment != nil {
+		err = c.expression(stmt.Increment)
+		if err != nil {
+			return err
+		}
+		c.emitOp(OP_POP)
+	}
+
+	err = c.emitLoop(loopStart)
+	if err != nil {
+		return err
+	}
+
+	err = c.patchJump(exitJump)
+	if err != nil {
+		return err
+	}
+	c.emitOp(OP_POP)
+
+	// Breaking skips the pop above, as the condition isn't on the stack then
+	for _, jump := range l.breaks {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) VisitBreakStmt(stmt stmt.Break) error {
+	if len(c.loops) == 0 {
+		return lox_error.NewParseError(keywordAt(token.BREAK, "break", stmt.Span()), "'break' statement has no enclosing loop.")
+	}
+
+	l := c.loops[len(c.loops) - 1]
+	err := c.exitRegions(l.regionCount, l.localCount)
+	if err != nil {
+		return err
+	}
+
+	l.breaks = append(l.breaks, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitContinueStmt(stmt stmt.Continue) error {
+	if len(c.loops) == 0 {
+		return lox_error.NewParseError(keywordAt(token.CONTINUE, "continue", stmt.Span()), "'continue' statement has no enclosing loop.")
+	}
+
+	l := c.loops[len(c.loops) - 1]
+	err := c.exitRegions(l.regionCount, l.localCount)
+	if err != nil {
+		return err
+	}
+
+	l.continues = append(l.continues, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt stmt.Function) error {
+	c.tok = stmt.Name
+	if c.scopeDepth == 0 {
+		err := c.compileFunction(FUNCTION, stmt.Name.Lexeme, "", stmt.Params, stmt.Body)
+		if err != nil {
+			return err
+		}
+		return c.defineVariable(stmt.Name)
+	}
+
+	// Declare the name first so the function can call itself
+	err := c.addLocal(stmt.Name.Lexeme)
+	if err != nil {
+		return err
+	}
+	return c.compileFunction(FUNCTION, stmt.Name.Lexeme, "", stmt.Params, stmt.Body)
+}
+
+func (c *Compiler) VisitReturnStmt(stmt stmt.Return) error {
+	if stmt.Value != nil {
+		err := c.expression(stmt.Value)
+		if err != nil {
+			return err
+		}
+	} else if c.function.kind == INITIALIZER {
+		c.emitBytes(byte(OP_GET_LOCAL), 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	// Run the finally blocks being returned through, innermost first, with
+	// the return value parked in a hidden local
+	locals, regions := c.locals, c.regions
+	for i := len(regions) - 1; i >= 0; i-- {
+		r := regions[i]
+		if r.finally == nil {
+			if r.hasHandler {
+				c.emitOp(OP_END_TRY)
+			}
+			continue
+		}
+
+		c.tok = stmt.Keyword
+		c.emitBytes(byte(OP_SET_LOCAL), byte(r.returnSlot))
+		c.emitOp(OP_POP)
+		err := c.inlineFinally(r, regions[:i])
+		if err != nil {
+			return err
+		}
+		c.emitBytes(byte(OP_GET_LOCAL), byte(r.returnSlot))
+	}
+	c.restore(locals, regions)
+
+	c.tok = stmt.Keyword
+	c.emitOp(OP_RETURN)
+	return nil
+}
+
+func (c *Compiler) VisitClassStmt(stmt stmt.Class) error {
+	c.tok = stmt.Name
+	name, err := c.identifierConstant(stmt.Name)
+	if err != nil {
+		return err
+	}
+
+	c.emitOp(OP_CLASS)
+	c.emitShort(name)
+	err = c.defineVariable(stmt.Name)
+	if err != nil {
+		return err
+	}
+
+	// Methods of a subclass capture "super" from a scope around them
+	if stmt.Superclass != nil {
+		_, err = c.VisitVariableExpr(*stmt.Superclass)
+		if err != nil {
+			return err
+		}
+
+		c.beginScope()
+		err = c.addLocal("super")
+		if err != nil {
+			return err
+		}
+
+		err = c.namedVariable(stmt.Name, false)
+		if err != nil {
+			return err
+		}
+		c.tok = stmt.Superclass.Name
+		c.emitOp(OP_INHERIT)
+	}
+
+	err = c.namedVariable(stmt.Name, false)
+	if err != nil {
+		return err
+	}
+
+	for _, method := range stmt.Methods {
+		kind := METHOD
+		if method.Name.Lexeme == "init" {
+			kind = INITIALIZER
+		}
+
+		c.tok = method.Name
+		err = c.compileFunction(kind, method.Name.Lexeme, stmt.Name.Lexeme, method.Params, method.Body)
+		if err != nil {
+			return err
+		}
+
+		c.tok = method.Name
+		name, err := c.identifierConstant(method.Name)
+		if err != nil {
+			return err
+		}
+		c.emitOp(OP_METHOD)
+		c.emitShort(name)
+	}
+	c.emitOp(OP_POP)
+
+	if stmt.Superclass != nil {
+		c.endScope()
+	}
+	return nil
+}
+
+func (c *Compiler) VisitImportStmt(stmt stmt.Import) error {
+	c.tok = stmt.Path
+	path, err := c.makeConstant(stmt.Path.Literal)
+	if err != nil {
+		return err
+	}
+	c.emitOp(OP_IMPORT)
+	c.emitShort(path)
+
+	if len(stmt.Names) == 0 {
+		c.tok = stmt.Alias
+		return c.defineVariable(stmt.Alias)
+	}
+
+	// Locals are defined from a hidden local holding the module
+	moduleSlot := -1
+	if c.scopeDepth > 0 {
+		err = c.addLocal("")
+		if err != nil {
+			return err
+		}
+		moduleSlot = len(c.locals) - 1
+	}
+
+	for _, name := range stmt.Names {
+		c.tok = name
+		if moduleSlot == -1 {
+			c.emitOp(OP_DUP)
+		} else {
+			c.emitBytes(byte(OP_GET_LOCAL), byte(moduleSlot))
+		}
+
+		property, err := c.identifierConstant(name)
+		if err != nil {
+			return err
+		}
+		c.emitOp(OP_GET_PROPERTY)
+		c.emitShort(property)
+
+		err = c.defineVariable(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if moduleSlot == -1 {
+		c.emitOp(OP_POP)
+	}
+	return nil
+}
+
+func (c *Compiler) VisitThrowStmt(stmt stmt.Throw) error {
+	err := c.expression(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	c.tok = stmt.Keyword
+	c.emitOp(OP_THROW)
+	return nil
+}
+
+// The try body runs under an exception handler. Its finally block is
+// compiled inline on every way out: falling off the end of the try or catch
+// block, break, continue and return, plus once more for errors passing
+// through, which are rethrown after it.
+func (c *Compiler) VisitTryStmt(stmt stmt.Try) error {
+	c.tok = stmt.Keyword
+	c.beginScope()
+
+	returnSlot := -1
+	if stmt.Finally != nil {
+		c.emitOp(OP_NIL)
+		err := c.addLocal("")
+		if err != nil {
+			return err
+		}
+		returnSlot = len(c.locals) - 1
+	}
+
+	height := len(c.locals)
+	tryHandler := c.emitTry(height)
+	c.regions = append(c.regions, region{localCount: height, hasHandler: true, finally: stmt.Finally, returnSlot: returnSlot})
+	err := c.VisitBlockStmt(*stmt.Body)
+	c.regions = c.regions[:len(c.regions) - 1]
+	if err != nil {
+		return err
+	}
+
+	c.tok = stmt.Keyword
+	c.emitOp(OP_END_TRY)
+	if stmt.Finally != nil {
+		err = c.VisitBlockStmt(*stmt.Finally)
+		if err != nil {
+			return err
+		}
+	}
+	exits := []int{c.emitJump(OP_JUMP)}
+
+	catchHandler := -1
+	if stmt.Catch != nil {
+		// The handler leaves the caught value on the stack as the catch variable
+		err = c.patchTry(tryHandler, 0)
+		if err != nil {
+			return err
+		}
+
+		c.tok = stmt.CatchName
+		c.beginScope()
+		err = c.addLocal(stmt.CatchName.Lexeme)
+		if err != nil {
+			return err
+		}
+
+		if stmt.Finally != nil {
+			catchHandler = c.emitTry(height)
+		}
+		c.regions = append(c.regions, region{localCount: height, hasHandler: stmt.Finally != nil, finally: stmt.Finally, returnSlot: returnSlot})
+		for _, statement := range stmt.Catch.Statements {
+			err = c.statement(statement)
+			if err != nil {
+				return err
+			}
+		}
+		c.regions = c.regions[:len(c.regions) - 1]
+		c.endScope()
+
+		if stmt.Finally != nil {
+			c.tok = stmt.Keyword
+			c.emitOp(OP_END_TRY)
+			err = c.VisitBlockStmt(*stmt.Finally)
+			if err != nil {
+				return err
+			}
+		}
+		exits = append(exits, c.emitJump(OP_JUMP))
+	}
+
+	if stmt.Finally != nil {
+		// Anything else thrown out of the try or catch blocks lands here as
+		// a pending error, which is rethrown once the finally block is done
+		err = c.patchTry(tryHandler, 2)
+		if err != nil {
+			return err
+		}
+		if catchHandler != -1 {
+			err = c.patchTry(catchHandler, 2)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.beginScope()
+		err = c.addLocal("")
+		if err != nil {
+			return err
+		}
+		err = c.VisitBlockStmt(*stmt.Finally)
+		if err != nil {
+			return err
+		}
+
+		c.tok = stmt.Keyword
+		c.emitBytes(byte(OP_GET_LOCAL), byte(len(c.locals) - 1))
+		c.emitOp(OP_RETHROW)
+
+		// Nothing runs after the rethrow, so the pending error is never popped
+		c.locals = c.locals[:len(c.locals) - 1]
+		c.scopeDepth--
+	}
+
+	for _, jump := range exits {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.endScope()
+	return nil
+}
+
+/** EXPRESSIONS */
+func (c *Compiler) VisitLiteralExpr(expr ast.Literal) (any, error) {
+	switch expr.Value {
+	case nil:
+		c.emitOp(OP_NIL)
+	case true:
+		c.emitOp(OP_TRUE)
+	case false:
+		c.emitOp(OP_FALSE)
+	default:
+		return nil, c.emitConstant(expr.Value)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitGroupingExpr(expr ast.Grouping) (any, error) {
+	return nil, c.expression(expr.Expression)
+}
+
+func (c *Compiler) VisitUnaryExpr(expr ast.Unary) (any, error) {
+	err := c.expression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Operator
+	switch expr.Operator.Type {
+	case token.MINUS:
+		c.emitOp(OP_NEGATE)
+	case token.BANG:
+		c.emitOp(OP_NOT)
+	default:
+		return nil, lox_error.NewParseError(expr.Operator, "Invalid operator.")
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitBinaryExpr(expr ast.Binary) (any, error) {
+	err := c.expression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	err = c.expression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Operator
+	switch expr.Operator.Type {
+	case token.PLUS:
+		c.emitOp(OP_ADD)
+	case token.INTERPOLATION:
+		// The left operand is always a string
+		c.emitOp(OP_STRINGIFY)
+		c.emitOp(OP_ADD)
+	case token.MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case token.STAR:
+		c.emitOp(OP_MULTIPLY)
+	case token.SLASH:
+		c.emitOp(OP_DIVIDE)
+	case token.GREATER:
+		c.emitOp(OP_GREATER)
+	case token.GREATER_EQUAL:
+		c.emitOp(OP_GREATER_EQUAL)
+	case token.LESS:
+		c.emitOp(OP_LESS)
+	case token.LESS_EQUAL:
+		c.emitOp(OP_LESS_EQUAL)
+	case token.EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case token.BANG_EQUAL:
+		c.emitOp(OP_EQUAL)
+		c.emitOp(OP_NOT)
+	default:
+		return nil, lox_error.NewParseError(expr.Operator, "Invalid operator.")
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitTernaryExpr(expr ast.Ternary) (any, error) {
+	err := c.expression(expr.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	err = c.expression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	endJump := c.emitJump(OP_JUMP)
+	err = c.patchJump(elseJump)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_POP)
+	err = c.expression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, c.patchJump(endJump)
+}
+
+func (c *Compiler) VisitVariableExpr(expr ast.Variable) (any, error) {
+	c.tok = expr.Name
+	return nil, c.namedVariable(expr.Name, false)
+}
+
+func (c *Compiler) VisitAssignExpr(expr ast.Assign) (any, error) {
+	err := c.expression(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Name
+	return nil, c.namedVariable(expr.Name, true)
+}
+
+func (c *Compiler) VisitLogicalExpr(expr ast.Logical) (any, error) {
+	err := c.expression(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	// The left operand is the result if it decides the expression
+	var endJump int
+	if expr.Operator.Type == token.OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump = c.emitJump(OP_JUMP)
+		err = c.patchJump(elseJump)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		endJump = c.emitJump(OP_JUMP_IF_FALSE)
+	}
+
+	c.emitOp(OP_POP)
+	err = c.expression(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.patchJump(endJump)
+}
+
+func (c *Compiler) VisitCallExpr(expr ast.Call) (any, error) {
+	// Calling a property directly skips creating a bound method
+	get, isInvoke := expr.Callee.(ast.Get)
+	if isInvoke {
+		err := c.expression(get.Object)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := c.expression(expr.Callee)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, argument := range expr.Arguments {
+		err := c.expression(argument)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.tok = expr.Paren
+	if isInvoke {
+		// The name's token is the constant so a missing property is
+		// reported at the name, not the paren
+		name, err := c.makeConstant(get.Name)
+		if err != nil {
+			return nil, err
+		}
+		c.emitOp(OP_INVOKE)
+		c.emitShort(name)
+		c.emitByte(byte(len(expr.Arguments)))
+		return nil, nil
+	}
+
+	c.emitBytes(byte(OP_CALL), byte(len(expr.Arguments)))
+	return nil, nil
+}
+
+func (c *Compiler) VisitGetExpr(expr ast.Get) (any, error) {
+	err := c.expression(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Name
+	name, err := c.identifierConstant(expr.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_GET_PROPERTY)
+	c.emitShort(name)
+	return nil, nil
+}
+
+func (c *Compiler) VisitSetExpr(expr ast.Set) (any, error) {
+	err := c.expression(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = c.expression(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Name
+	name, err := c.identifierConstant(expr.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_SET_PROPERTY)
+	c.emitShort(name)
+	return nil, nil
+}
+
+func (c *Compiler) VisitThisExpr(expr ast.This) (any, error) {
+	c.tok = expr.Keyword
+	return nil, c.namedVariable(expr.Keyword, false)
+}
+
+func (c *Compiler) VisitSuperExpr(expr ast.Super) (any, error) {
+	c.tok = expr.Keyword
+	err := c.namedVariable(keywordAt(token.THIS, "this", expr.Keyword.Span), false)
+	if err != nil {
+		return nil, err
+	}
+	err = c.namedVariable(expr.Keyword, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Method
+	name, err := c.identifierConstant(expr.Method)
+	if err != nil {
+		return nil, err
+	}
+	c.emitOp(OP_GET_SUPER)
+	c.emitShort(name)
+	return nil, nil
+}
+
+func (c *Compiler) VisitLambdaExpr(expr ast.Lambda) (any, error) {
+	c.tok = expr.Keyword
+	return nil, c.compileFunction(LAMBDA, "", "", expr.Params, expr.Body.([]stmt.Stmt))
+}
+
+func (c *Compiler) VisitListExpr(expr ast.List) (any, error) {
+	if len(expr.Elements) > 0xffff {
+		return nil, lox_error.NewCompileError(expr.Bracket, "Too many elements in list literal.")
+	}
+
+	for _, element := range expr.Elements {
+		err := c.expression(element)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.tok = expr.Bracket
+	c.emitOp(OP_LIST)
+	c.emitShort(len(expr.Elements))
+	return nil, nil
+}
+
+func (c *Compiler) VisitMapExpr(expr ast.Map) (any, error) {
+	if len(expr.Keys) > 0xffff {
+		return nil, lox_error.NewCompileError(expr.Brace, "Too many entries in map literal.")
+	}
+
+	for i := range expr.Keys {
+		err := c.expression(expr.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+		err = c.expression(expr.Values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.tok = expr.Brace
+	c.emitOp(OP_MAP)
+	c.emitShort(len(expr.Keys))
+	return nil, nil
+}
+
+func (c *Compiler) VisitSubscriptExpr(expr ast.Subscript) (any, error) {
+	err := c.expression(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = c.expression(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Bracket
+	c.emitOp(OP_GET_INDEX)
+	return nil, nil
+}
+
+func (c *Compiler) VisitSetSubscriptExpr(expr ast.SetSubscript) (any, error) {
+	err := c.expression(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = c.expression(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	err = c.expression(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tok = expr.Bracket
+	c.emitOp(OP_SET_INDEX)
+	return nil, nil
+}
+
+/** FUNCTIONS AND VARIABLES */
+
+// Compiles a function body into its own chunk and emits the closure
+// wrapping it
+func (c *Compiler) compileFunction(kind FunctionType, name string, class string, params []token.Token, body []stmt.Stmt) error {
+	function := newFunction(kind, name, c.function.globals, c.function.path)
+	function.class = class
+	function.line = c.tok.Line
+	function.arity = len(params)
+
+	fc := newCompiler(c, function)
+	fc.tok = c.tok
+	fc.beginScope()
+	for _, param := range params {
+		err := fc.addLocal(param.Lexeme)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range body {
+		err := fc.statement(statement)
+		if err != nil {
+			return err
+		}
+	}
+	fc.emitReturn()
+	function.upvalueCount = len(fc.upvalues)
+
+	index, err := c.makeConstant(function)
+	if err != nil {
+		return err
+	}
+	c.emitOp(OP_CLOSURE)
+	c.emitShort(index)
+	for _, upvalue := range fc.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emitBytes(isLocal, upvalue.index)
+	}
+	return nil
+}
+
+func (c *Compiler) emitReturn() {
+	if c.function.kind == INITIALIZER {
+		c.emitBytes(byte(OP_GET_LOCAL), 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+// Binds the value on top of the stack to name: a global at the top level,
+// otherwise a new local. Like the tree-walker, a local redeclared in the
+// same scope is a new variable shadowing the old one.
+func (c *Compiler) defineVariable(name token.Token) error {
+	if c.scopeDepth == 0 {
+		index, err := c.identifierConstant(name)
+		if err != nil {
+			return err
+		}
+		c.emitOp(OP_DEFINE_GLOBAL)
+		c.emitShort(index)
+		return nil
+	}
+
+	return c.addLocal(name.Lexeme)
+}
+
+// Emits a read of name, or a write of the value on top of the stack to it
+func (c *Compiler) namedVariable(name token.Token, assign bool) error {
+	getOp, setOp := OP_GET_LOCAL, OP_SET_LOCAL
+	slot := c.resolveLocal(name.Lexeme)
+	if slot == -1 {
+		var err error
+		slot, err = c.resolveUpvalue(name.Lexeme)
+		if err != nil {
+			return err
+		}
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	}
+
+	if slot == -1 {
+		index, err := c.identifierConstant(name)
+		if err != nil {
+			return err
+		}
+		if assign {
+			c.emitOp(OP_SET_GLOBAL)
+		} else {
+			c.emitOp(OP_GET_GLOBAL)
+		}
+		c.emitShort(index)
+		return nil
+	}
+
+	if assign {
+		c.emitBytes(byte(setOp), byte(slot))
+	} else {
+		c.emitBytes(byte(getOp), byte(slot))
+	}
+	return nil
+}
+
+func (c *Compiler) addLocal(name string) error {
+	if len(c.locals) > 0xff {
+		return lox_error.NewCompileError(c.tok, "Too many local variables in function.")
+	}
+
+	c.locals = append(c.locals, local{name: name, depth: c.scopeDepth})
+	return nil
+}
+
+func (c *Compiler) resolveLocal(name string) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Finds name in an enclosing function, capturing it in every function in
+// between. Returns -1 if it is a global.
+func (c *Compiler) resolveUpvalue(name string) (int, error) {
+	if c.enclosing == nil {
+		return -1, nil
+	}
+
+	if slot := c.enclosing.resolveLocal(name); slot != -1 {
+		c.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(uint8(slot), true)
+	}
+
+	index, err := c.enclosing.resolveUpvalue(name)
+	if err != nil || index == -1 {
+		return -1, err
+	}
+	return c.addUpvalue(uint8(index), false)
+}
+
+func (c *Compiler) addUpvalue(index uint8, isLocal bool) (int, error) {
+	for i, upvalue := range c.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i, nil
+		}
+	}
+
+	if len(c.upvalues) > 0xff {
+		return -1, lox_error.NewCompileError(c.tok, "Too many closure variables in function.")
+	}
+	c.upvalues = append(c.upvalues, upvalue{index: index, isLocal: isLocal})
+	return len(c.upvalues) - 1, nil
+}
+
+func (c *Compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	c.scopeDepth--
+	n := len(c.locals)
+	for n > 0 && c.locals[n - 1].depth > c.scopeDepth {
+		n--
+	}
+	c.emitPops(n)
+	c.locals = c.locals[:n]
+}
+
+// Emits pops for the locals above the first n, without forgetting them, for
+// code that jumps out of their scope
+func (c *Compiler) emitPops(n int) {
+	for i := len(c.locals) - 1; i >= n; i-- {
+		if c.locals[i].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+	}
+}
+
+/** TRY REGIONS */
+
+// Leaves every try region entered since the first regionCount, running
+// their finally blocks, then pops the locals above localCount. The
+// compiler's view of the scope is left as it was, since the code that
+// follows is only reached by jumping.
+func (c *Compiler) exitRegions(regionCount int, localCount int) error {
+	locals, regions := c.locals, c.regions
+	for i := len(regions) - 1; i >= regionCount; i-- {
+		err := c.inlineFinally(regions[i], regions[:i])
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emitPops(localCount)
+	c.restore(locals, regions)
+	return nil
+}
+
+// Pops the locals declared inside r and its handler, then compiles its
+// finally block as if outside it. Leaves c.locals and c.regions truncated.
+func (c *Compiler) inlineFinally(r region, outside []region) error {
+	c.emitPops(r.localCount)
+	c.locals = slices.Clone(c.locals[:min(r.localCount, len(c.locals))])
+	if r.hasHandler {
+		c.emitOp(OP_END_TRY)
+	}
+	if r.finally == nil {
+		return nil
+	}
+
+	c.regions = outside
+	return c.VisitBlockStmt(*r.finally)
+}
+
+// Restores the scope saved before inlining finally blocks, keeping track of
+// outer locals the inlined code captured
+func (c *Compiler) restore(locals []local, regions []region) {
+	for i := 0; i < len(c.locals) && i < len(locals); i++ {
+		if c.locals[i].isCaptured {
+			locals[i].isCaptured = true
+		}
+	}
+	c.locals, c.regions = locals, regions
+}
+
+/** EMITTING CODE */
+func (c *Compiler) emitByte(b byte) {
+	c.function.chunk.Write(b, c.tok)
+}
+
+func (c *Compiler) emitBytes(b1 byte, b2 byte) {
+	c.emitByte(b1)
+	c.emitByte(b2)
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitShort(n int) {
+	c.emitBytes(byte(n >> 8), byte(n))
+}
+
+func (c *Compiler) makeConstant(value any) (int, error) {
+	index := c.function.chunk.AddConstant(value)
+	if index > 0xffff {
+		return 0, lox_error.NewCompileError(c.tok, "Too many constants in one chunk.")
+	}
+	return index, nil
+}
+
+func (c *Compiler) identifierConstant(name token.Token) (int, error) {
+	return c.makeConstant(name.Lexeme)
+}
+
+func (c *Compiler) emitConstant(value any) error {
+	index, err := c.makeConstant(value)
+	if err != nil {
+		return err
+	}
+	c.emitOp(OP_CONSTANT)
+	c.emitShort(index)
+	return nil
+}
+
+// Emits a forward jump and returns the offset of its operand for patchJump
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOp(op)
+	c.emitShort(0xffff)
+	return len(c.function.chunk.Code) - 2
+}
+
+// Points the jump with its operand at offset to the next instruction
+func (c *Compiler) patchJump(offset int) error {
+	jump := len(c.function.chunk.Code) - offset - 2
+	if jump > 0xffff {
+		return lox_error.NewCompileError(c.tok, "Too much code to jump over.")
+	}
+
+	c.function.chunk.Code[offset] = byte(jump >> 8)
+	c.function.chunk.Code[offset + 1] = byte(jump)
+	return nil
+}
+
+func (c *Compiler) emitLoop(start int) error {
+	c.emitOp(OP_LOOP)
+	offset := len(c.function.chunk.Code) - start + 2
+	if offset > 0xffff {
+		return lox_error.NewCompileError(c.tok, "Loop body too large.")
+	}
+	c.emitShort(offset)
+	return nil
+}
+
+// Emits an exception handler with no targets yet, returning the offset of
+// its operands for patchTry. height is the number of locals left on the
+// stack when it catches something.
+func (c *Compiler) emitTry(height int) int {
+	c.emitOp(OP_TRY)
+	c.emitShort(noTarget)
+	c.emitShort(noTarget)
+	c.emitShort(height)
+	return len(c.function.chunk.Code) - 6
+}
+
+// Points the catch (which = 0) or finally (which = 2) target of the handler
+// at offset to the next instruction
+func (c *Compiler) patchTry(offset int, which int) error {
+	jump := len(c.function.chunk.Code) - (offset + 6)
+	if jump >= noTarget {
+		return lox_error.NewCompileError(c.tok, "Too much code to jump over.")
+	}
+
+	c.function.chunk.Code[offset + which] = byte(jump >> 8)
+	c.function.chunk.Code[offset + which + 1] = byte(jump)
+	return nil
+}
+
+// Makes a token for a keyword at the start of a statement's span
+func keywordAt(typ token.TokenType, lexeme string, span token.Span) token.Token {
+	span.End = span.Start + len(lexeme)
+	return *token.NewTokenAt(typ, lexeme, nil, span)
+}
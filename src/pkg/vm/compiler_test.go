@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+)
+
+func compileSource(t *testing.T, source string) error {
+	t.Helper()
+	tokens, err := scanner.NewScanner(source).ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(WithOutput(io.Discard), WithDiagnostics(io.Discard)).Interpret(statements)
+}
+
+// Programs that are valid Lox but don't fit in bytecode fail with a compile
+// error, not a syntax error
+func TestCompileLimits(t *testing.T) {
+	var locals strings.Builder
+	locals.WriteString("fun f() {\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&locals, "  var v%d = %d;\n", i, i)
+	}
+	locals.WriteString("}\n")
+
+	var constants strings.Builder
+	constants.WriteString("var x;\n")
+	for i := 0; i < 0x10001; i++ {
+		fmt.Fprintf(&constants, "x = %d;\n", i)
+	}
+
+	tests := []struct {
+		name string
+		source string
+		message string
+	}{
+		{"locals", locals.String(), "Too many local variables in function."},
+		{"constants", constants.String(), "Too many constants in one chunk."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := compileSource(t, test.source)
+			compileError, ok := err.(*lox_error.CompileError)
+			if !ok {
+				t.Fatalf("expected a compile error, got %T: %v", err, err)
+			}
+			if compileError.Message != test.message {
+				t.Errorf("message: %q", compileError.Message)
+			}
+			if !strings.HasPrefix(err.Error(), "Compile error at [line ") {
+				t.Errorf("error: %q", err.Error())
+			}
+		})
+	}
+}
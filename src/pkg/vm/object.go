@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+type FunctionType int
+
+const (
+	SCRIPT FunctionType = iota
+	MODULE
+	FUNCTION
+	LAMBDA
+	METHOD
+	INITIALIZER
+)
+
+// Function is a compiled function body. At runtime it is always wrapped
+// in a Closure holding its captured variables.
+type Function struct {
+	name string
+	class string // name of the class declaring this method, if it is one
+	kind FunctionType
+	line int // line the function was declared on
+	arity int
+	upvalueCount int
+	chunk *Chunk
+	globals map[string]any // top-level variables of the file it was declared in
+	path string // file it was declared in, empty for the REPL
+}
+
+func newFunction(kind FunctionType, name string, globals map[string]any, path string) *Function {
+	return &Function{name: name, kind: kind, chunk: NewChunk(), globals: globals, path: path}
+}
+
+// Names the function as it appears in stack traces, e.g. "Point.init"
+func (f *Function) Name() string {
+	switch {
+	case f.kind == LAMBDA:
+		return "anonymous"
+	case f.kind == SCRIPT || f.kind == MODULE:
+		return "<script>"
+	case f.class != "":
+		return f.class + "." + f.name
+	}
+	return f.name
+}
+
+func (f *Function) String() string {
+	switch f.kind {
+	case LAMBDA:
+		return "<fn anonymous>"
+	case SCRIPT, MODULE:
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", f.name)
+}
+
+// Upvalue is a variable captured by a closure. While the variable is still
+// on the stack the upvalue points at its slot; once the variable goes out
+// of scope its value moves into the upvalue.
+type Upvalue struct {
+	slot int
+	closed any
+	isClosed bool
+}
+
+type Closure struct {
+	function *Function
+	upvalues []*Upvalue
+}
+
+func newClosure(function *Function) *Closure {
+	return &Closure{function: function, upvalues: make([]*Upvalue, function.upvalueCount)}
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+type Class struct {
+	name string
+	superclass *Class
+	methods map[string]*Closure
+}
+
+func newClass(name string) *Class {
+	return &Class{name: name, methods: make(map[string]*Closure)}
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+// Returns the closure for a method, which may be inherited from any
+// superclass. OP_INHERIT copies nothing, so the chain is walked each time.
+func (c *Class) findMethod(name string) (*Closure, bool) {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+type Instance struct {
+	class *Class
+	fields map[string]any
+}
+
+func newInstance(class *Class) *Instance {
+	return &Instance{class: class, fields: make(map[string]any)}
+}
+
+func (i *Instance) String() string {
+	return i.class.name + " instance"
+}
+
+// Reads a property for OP_GET_PROPERTY: a field if the instance has one,
+// otherwise a BoundMethod pairing the closure with this receiver
+func (i *Instance) get(name token.Token) (any, error) {
+	if value, ok := i.fields[name.Lexeme]; ok {
+		return value, nil
+	}
+
+	if method, ok := i.class.findMethod(name.Lexeme); ok {
+		return &BoundMethod{receiver: i, method: method}, nil
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+}
+
+type BoundMethod struct {
+	receiver any
+	method *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+// pendingError is an error on its way through a finally block. The
+// compiler keeps it in a hidden local, so Lox code never sees it.
+type pendingError struct {
+	err error
+}
@@ -0,0 +1,791 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lidanielm/glox/src/pkg/internal/stmt"
+	"github.com/lidanielm/glox/src/pkg/interpreter"
+	"github.com/lidanielm/glox/src/pkg/lox_error"
+	"github.com/lidanielm/glox/src/pkg/parser"
+	"github.com/lidanielm/glox/src/pkg/scanner"
+	"github.com/lidanielm/glox/src/pkg/token"
+)
+
+// Same as the tree-walking interpreter's default, so deep recursion fails
+// the same way on both backends
+const maxCallDepth = 10000
+
+type callFrame struct {
+	closure *Closure
+	ip int
+	base int // stack slot of the callee, with the arguments above it
+}
+
+// handler is an active try statement, set up by OP_TRY
+type handler struct {
+	frame int
+	height int // stack height to unwind to before jumping
+	catchIP int // -1 if there is no catch clause
+	finallyIP int // -1 if there is no finally clause
+}
+
+// loadingModule is a file whose top-level code is running
+type loadingModule struct {
+	path string
+	frame int
+}
+
+// VM runs compiled Lox code on a value stack. Values are the same as in the
+// tree-walking interpreter, and lists, maps, modules and natives are
+// shared with it, so both backends behave alike.
+type VM struct {
+	stack []any
+	frames []callFrame
+	handlers []handler
+	openUpvalues []*Upvalue // by stack slot, ascending
+	globals map[string]any
+	modules map[string]*interpreter.Module // loaded modules by canonical path
+	loading []loadingModule
+	host *interpreter.Interpreter // natives are called with it, and it resolves programs
+	path string // file being run, empty for the REPL
+	source string // source being run, for rendering errors
+	stdout io.Writer
+	stderr io.Writer
+	stdin io.Reader
+	warnings func(err error)
+}
+
+type Option func(*VM)
+
+// Sends program output (print statements) to w instead of os.Stdout
+func WithOutput(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stdout = w
+	}
+}
+
+// Sends diagnostics (runtime errors and warnings) to w instead of os.Stderr
+func WithDiagnostics(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stderr = w
+	}
+}
+
+// Passes warnings, such as a variable declared twice in one scope, to handle
+// instead of writing them with the other diagnostics
+func WithWarnings(handle func(err error)) Option {
+	return func(vm *VM) {
+		vm.warnings = handle
+	}
+}
+
+// Reads input for input() and readLine() from r instead of os.Stdin
+func WithInput(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.stdin = r
+	}
+}
+
+func New(options ...Option) *VM {
+	vm := &VM{globals: make(map[string]any), modules: make(map[string]*interpreter.Module), stdout: os.Stdout, stderr: os.Stderr}
+	for _, option := range options {
+		option(vm)
+	}
+
+	hostOptions := []interpreter.Option{interpreter.WithOutput(vm.stdout), interpreter.WithDiagnostics(vm.stderr)}
+	if vm.stdin != nil {
+		hostOptions = append(hostOptions, interpreter.WithInput(vm.stdin))
+	}
+	if vm.warnings != nil {
+		hostOptions = append(hostOptions, interpreter.WithWarnings(vm.warnings))
+	}
+	vm.host = interpreter.NewInterpreter(hostOptions...)
+	return vm
+}
+
+// Sets the file being run, so imports inside it resolve relative to its
+// directory and importing it back is reported as a cycle. An empty
+// path means there's no file, as in the REPL.
+func (vm *VM) SetPath(path string) error {
+	if path == "" {
+		vm.path = ""
+		return nil
+	}
+
+	canonical, err := interpreter.CanonicalPath(path)
+	if err != nil {
+		return err
+	}
+
+	vm.path = canonical
+	return nil
+}
+
+// Sets the source the next statements were parsed from, so errors can show
+// the offending line
+func (vm *VM) SetSource(source string) {
+	vm.source = source
+	vm.host.SetSource(source)
+}
+
+// Returns the global variables defined so far, not including natives
+func (vm *VM) Globals() map[string]any {
+	globals := make(map[string]any, len(vm.globals))
+	for name, value := range vm.globals {
+		globals[name] = value
+	}
+	return globals
+}
+
+// Resolves, compiles and runs a program. Like the interpreter, errors are
+// reported before being returned, whether the program failed to compile or
+// to run. Globals persist between calls.
+func (vm *VM) Interpret(statements []stmt.Stmt) error {
+	err := vm.interpret(statements)
+	if err != nil {
+		fmt.Fprintln(vm.stderr, lox_error.Render(err, vm.source))
+		return err
+	}
+	return nil
+}
+
+func (vm *VM) interpret(statements []stmt.Stmt) error {
+	_, err := interpreter.NewResolver(vm.host).ResolveStmts(statements)
+	if err != nil {
+		return err
+	}
+
+	function, err := Compile(statements, SCRIPT, vm.globals, vm.path)
+	if err != nil {
+		return err
+	}
+
+	return vm.execute(function)
+}
+
+func (vm *VM) execute(function *Function) error {
+	// Start afresh in case the last run stopped with an error
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = nil
+	vm.loading = nil
+	if vm.path != "" {
+		vm.loading = append(vm.loading, loadingModule{path: vm.path, frame: 0})
+	}
+
+	closure := newClosure(function)
+	vm.push(closure)
+	vm.frames = append(vm.frames, callFrame{closure: closure})
+	return vm.run()
+}
+
+func (vm *VM) run() error {
+	var frame *callFrame
+	var code []byte
+	var constants []any
+	reload := func() {
+		frame = &vm.frames[len(vm.frames) - 1]
+		code = frame.closure.function.chunk.Code
+		constants = frame.closure.function.chunk.Constants
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(code[frame.ip - 2]) << 8 | int(code[frame.ip - 1])
+	}
+	reload()
+
+	for {
+		op := OpCode(code[frame.ip])
+		frame.ip++
+
+		var err error
+		switch op {
+		case OP_CONSTANT:
+			vm.push(constants[readShort()])
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.stack = vm.stack[:len(vm.stack) - 1]
+		case OP_DUP:
+			vm.push(vm.peek(0))
+		case OP_GET_LOCAL:
+			slot := int(code[frame.ip])
+			frame.ip++
+			vm.push(vm.stack[frame.base + slot])
+		case OP_SET_LOCAL:
+			slot := int(code[frame.ip])
+			frame.ip++
+			vm.stack[frame.base + slot] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := constants[readShort()].(string)
+			value, ok := frame.closure.function.globals[name]
+			if !ok {
+				value, ok = vm.host.LookupGlobal(name)
+			}
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Undefined variable '"+name+"'.")
+				break
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			name := constants[readShort()].(string)
+			frame.closure.function.globals[name] = vm.pop()
+		case OP_SET_GLOBAL:
+			name := constants[readShort()].(string)
+			if _, ok := frame.closure.function.globals[name]; !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Undefined variable '"+name+"'.")
+				break
+			}
+			frame.closure.function.globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			upvalue := frame.closure.upvalues[code[frame.ip]]
+			frame.ip++
+			if upvalue.isClosed {
+				vm.push(upvalue.closed)
+			} else {
+				vm.push(vm.stack[upvalue.slot])
+			}
+		case OP_SET_UPVALUE:
+			upvalue := frame.closure.upvalues[code[frame.ip]]
+			frame.ip++
+			if upvalue.isClosed {
+				upvalue.closed = vm.peek(0)
+			} else {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			}
+		case OP_GET_PROPERTY:
+			readShort()
+			var value any
+			value, err = vm.getProperty(vm.peek(0), vm.token())
+			if err == nil {
+				vm.stack[len(vm.stack) - 1] = value
+			}
+		case OP_SET_PROPERTY:
+			name := constants[readShort()].(string)
+			value := vm.pop()
+			instance, ok := vm.pop().(*Instance)
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Only instances have properties.")
+				break
+			}
+			instance.fields[name] = value
+			vm.push(value)
+		case OP_GET_SUPER:
+			name := constants[readShort()].(string)
+			superclass := vm.pop().(*Class)
+			receiver := vm.pop()
+			method, ok := superclass.findMethod(name)
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Undefined property '"+name+"'.")
+				break
+			}
+			vm.push(&BoundMethod{receiver: receiver, method: method})
+		case OP_GET_INDEX:
+			index := vm.pop()
+			var value any
+			switch object := vm.pop().(type) {
+			case *interpreter.List:
+				value, err = object.GetIndex(vm.token(), index)
+			case *interpreter.Map:
+				value, err = object.GetKey(vm.token(), index)
+			default:
+				err = lox_error.NewRuntimeError(vm.token(), "Only lists and maps can be indexed.")
+			}
+			vm.push(value)
+		case OP_SET_INDEX:
+			value := vm.pop()
+			index := vm.pop()
+			switch object := vm.pop().(type) {
+			case *interpreter.List:
+				err = object.SetIndex(vm.token(), index, value)
+			case *interpreter.Map:
+				err = object.SetKey(vm.token(), index, value)
+			default:
+				err = lox_error.NewRuntimeError(vm.token(), "Only lists and maps can be indexed.")
+			}
+			vm.push(value)
+		case OP_EQUAL:
+			right := vm.pop()
+			vm.stack[len(vm.stack) - 1] = interpreter.IsEqual(vm.peek(0), right)
+		case OP_GREATER, OP_GREATER_EQUAL, OP_LESS, OP_LESS_EQUAL, OP_SUBTRACT, OP_MULTIPLY, OP_DIVIDE:
+			err = vm.arithmetic(op)
+		case OP_ADD:
+			right := vm.pop()
+			switch left := vm.peek(0).(type) {
+			case float64:
+				if right, ok := right.(float64); ok {
+					vm.stack[len(vm.stack) - 1] = left + right
+					continue
+				}
+			case string:
+				if right, ok := right.(string); ok {
+					vm.stack[len(vm.stack) - 1] = left + right
+					continue
+				}
+			}
+			err = lox_error.NewRuntimeError(vm.token(), "Operands must be two numbers or two strings.")
+		case OP_NOT:
+			value, ok := vm.peek(0).(bool)
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Operand must be a boolean.")
+				break
+			}
+			vm.stack[len(vm.stack) - 1] = !value
+		case OP_NEGATE:
+			value, ok := vm.peek(0).(float64)
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Operand must be a number.")
+				break
+			}
+			vm.stack[len(vm.stack) - 1] = -value
+		case OP_STRINGIFY:
+			vm.stack[len(vm.stack) - 1] = interpreter.Stringify(vm.peek(0))
+		case OP_PRINT:
+			fmt.Fprintln(vm.stdout, interpreter.Stringify(vm.pop()))
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !interpreter.IsTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argCount := int(code[frame.ip])
+			frame.ip++
+			err = vm.callValue(vm.peek(argCount), argCount)
+			reload()
+		case OP_INVOKE:
+			name := constants[readShort()].(token.Token)
+			argCount := int(code[frame.ip])
+			frame.ip++
+			err = vm.invoke(name, argCount)
+			reload()
+		case OP_CLOSURE:
+			function := constants[readShort()].(*Function)
+			closure := newClosure(function)
+			for i := range closure.upvalues {
+				isLocal, index := code[frame.ip], int(code[frame.ip + 1])
+				frame.ip += 2
+				if isLocal == 1 {
+					closure.upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers) - 1].frame >= len(vm.frames) - 1 {
+				vm.handlers = vm.handlers[:len(vm.handlers) - 1]
+			}
+
+			vm.frames = vm.frames[:len(vm.frames) - 1]
+			if len(vm.frames) == 0 {
+				vm.stack = vm.stack[:0]
+				return nil
+			}
+
+			vm.stack = vm.stack[:frame.base]
+			vm.push(result)
+			reload()
+		case OP_CLASS:
+			vm.push(newClass(constants[readShort()].(string)))
+		case OP_INHERIT:
+			subclass := vm.pop().(*Class)
+			superclass, ok := vm.peek(0).(*Class)
+			if !ok {
+				err = lox_error.NewRuntimeError(vm.token(), "Superclass must be a class.")
+				break
+			}
+			subclass.superclass = superclass
+		case OP_METHOD:
+			name := constants[readShort()].(string)
+			method := vm.pop().(*Closure)
+			vm.peek(0).(*Class).methods[name] = method
+		case OP_LIST:
+			count := readShort()
+			elements := slices.Clone(vm.stack[len(vm.stack) - count:])
+			vm.stack = vm.stack[:len(vm.stack) - count]
+			vm.push(interpreter.NewList(elements))
+		case OP_MAP:
+			count := readShort()
+			entries := vm.stack[len(vm.stack) - 2 * count:]
+			m := interpreter.NewMap()
+			for i := 0; i < len(entries) && err == nil; i += 2 {
+				err = m.SetKey(vm.token(), entries[i], entries[i + 1])
+			}
+			vm.stack = vm.stack[:len(vm.stack) - 2 * count]
+			vm.push(m)
+		case OP_THROW:
+			err = lox_error.ThrowError{Token: vm.token(), Value: vm.pop()}
+		case OP_TRY:
+			catchOffset, finallyOffset, height := readShort(), readShort(), readShort()
+			h := handler{frame: len(vm.frames) - 1, height: frame.base + height, catchIP: -1, finallyIP: -1}
+			if catchOffset != noTarget {
+				h.catchIP = frame.ip + catchOffset
+			}
+			if finallyOffset != noTarget {
+				h.finallyIP = frame.ip + finallyOffset
+			}
+			vm.handlers = append(vm.handlers, h)
+		case OP_END_TRY:
+			vm.handlers = vm.handlers[:len(vm.handlers) - 1]
+		case OP_RETHROW:
+			err = vm.pop().(*pendingError).err
+		case OP_IMPORT:
+			path := constants[readShort()].(string)
+			err = vm.importModule(vm.token(), path)
+			reload()
+		case OP_MODULE:
+			vm.push(vm.finishModule(frame.closure.function))
+		default:
+			err = lox_error.NewRuntimeError(vm.token(), "Unknown opcode "+op.String()+".")
+		}
+
+		if err != nil {
+			err = vm.throw(err)
+			if err != nil {
+				return err
+			}
+			reload()
+		}
+	}
+}
+
+/** CALLS */
+func (vm *VM) callValue(callee any, argCount int) error {
+	switch callee := callee.(type) {
+	case *Closure:
+		return vm.call(callee, argCount)
+	case *BoundMethod:
+		vm.stack[len(vm.stack) - argCount - 1] = callee.receiver
+		return vm.call(callee.method, argCount)
+	case *Class:
+		vm.stack[len(vm.stack) - argCount - 1] = newInstance(callee)
+		if initializer, ok := callee.findMethod("init"); ok {
+			return vm.call(initializer, argCount)
+		}
+		if argCount != 0 {
+			return lox_error.NewRuntimeError(vm.token(), fmt.Sprintf("Expected 0 arguments but got %d.", argCount))
+		}
+		return nil
+	case interpreter.Callable:
+		if argCount != callee.Arity() {
+			return lox_error.NewRuntimeError(vm.token(), fmt.Sprintf("Expected %d arguments but got %d.", callee.Arity(), argCount))
+		}
+
+		arguments := slices.Clone(vm.stack[len(vm.stack) - argCount:])
+		result, err := callee.Call(vm.host, arguments)
+		if err != nil {
+			return interpreter.CallError(vm.token(), err)
+		}
+		vm.stack = vm.stack[:len(vm.stack) - argCount - 1]
+		vm.push(result)
+		return nil
+	}
+
+	return lox_error.NewRuntimeError(vm.token(), "Can only call functions and classes.")
+}
+
+func (vm *VM) call(closure *Closure, argCount int) error {
+	if argCount != closure.function.arity {
+		return lox_error.NewRuntimeError(vm.token(), fmt.Sprintf("Expected %d arguments but got %d.", closure.function.arity, argCount))
+	}
+	if len(vm.frames) > maxCallDepth {
+		return lox_error.NewRuntimeError(vm.token(), "Stack overflow.")
+	}
+
+	vm.frames = append(vm.frames, callFrame{closure: closure, base: len(vm.stack) - argCount - 1})
+	return nil
+}
+
+// Calls a property without binding it first when it's a method
+func (vm *VM) invoke(name token.Token, argCount int) error {
+	receiver := vm.peek(argCount)
+	if instance, ok := receiver.(*Instance); ok {
+		if value, ok := instance.fields[name.Lexeme]; ok {
+			vm.stack[len(vm.stack) - argCount - 1] = value
+			return vm.callValue(value, argCount)
+		}
+		if method, ok := instance.class.findMethod(name.Lexeme); ok {
+			return vm.call(method, argCount)
+		}
+		return lox_error.NewRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+	}
+
+	value, err := vm.getProperty(receiver, name)
+	if err != nil {
+		return err
+	}
+	vm.stack[len(vm.stack) - argCount - 1] = value
+	return vm.callValue(value, argCount)
+}
+
+func (vm *VM) getProperty(object any, name token.Token) (any, error) {
+	switch object := object.(type) {
+	case *Instance:
+		return object.get(name)
+	case interface{ Get(token.Token) (any, error) }:
+		// Lists, maps, modules and error objects from the interpreter
+		return object.Get(name)
+	}
+
+	return nil, lox_error.NewRuntimeError(name, "Only instances have properties.")
+}
+
+/** ERRORS */
+
+// Unwinds to the innermost handler that can take err: a catch clause for
+// errors Lox code can catch, otherwise a finally clause. Returns err if
+// there is none.
+func (vm *VM) throw(err error) error {
+	if path := vm.modulePath(vm.frames[len(vm.frames) - 1].closure.function); path != "" {
+		err = lox_error.InModule(err, path)
+	}
+	if runtimeError, ok := err.(*lox_error.RuntimeError); ok && runtimeError.Trace == nil {
+		vm.attachTrace(runtimeError)
+	}
+
+	for len(vm.handlers) > 0 {
+		h := vm.handlers[len(vm.handlers) - 1]
+		vm.handlers = vm.handlers[:len(vm.handlers) - 1]
+
+		var value any
+		var target int
+		if caught, ok := interpreter.CaughtValue(err); ok && h.catchIP != -1 {
+			value, target = caught, h.catchIP
+		} else if h.finallyIP != -1 {
+			value, target = &pendingError{err: err}, h.finallyIP
+		} else {
+			continue
+		}
+
+		vm.closeUpvalues(h.height)
+		vm.frames = vm.frames[:h.frame + 1]
+		vm.stack = vm.stack[:h.height]
+		for len(vm.loading) > 0 && vm.loading[len(vm.loading) - 1].frame > h.frame {
+			vm.loading = vm.loading[:len(vm.loading) - 1]
+		}
+
+		vm.push(value)
+		vm.frames[h.frame].ip = target
+		return nil
+	}
+
+	return err
+}
+
+// Records the Lox calls the error was raised in, as the interpreter does.
+// Top-level code of imported modules isn't a call, so it is skipped.
+func (vm *VM) attachTrace(err *lox_error.RuntimeError) {
+	trace := []lox_error.Frame{}
+	line := err.Token.Line
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		function := frame.closure.function
+		switch function.kind {
+		case SCRIPT:
+			if len(trace) > 0 {
+				trace = append(trace, lox_error.Frame{Function: function.Name(), Line: line, File: vm.modulePath(function)})
+			}
+			i = 0
+		case MODULE:
+		default:
+			trace = append(trace, lox_error.Frame{Function: function.Name(), Line: line, Defined: function.line, File: vm.modulePath(function)})
+		}
+
+		if i > 0 {
+			caller := vm.frames[i - 1]
+			line = caller.closure.function.chunk.Line(caller.ip - 1)
+		}
+	}
+
+	if len(trace) > 0 {
+		err.Trace = trace
+	}
+}
+
+// Returns the path errors in a function are reported against: its file if
+// that was imported, or "" for the file being run
+func (vm *VM) modulePath(function *Function) string {
+	if function.path == vm.path {
+		return ""
+	}
+	return function.path
+}
+
+// Returns the token the current instruction was compiled from
+func (vm *VM) token() token.Token {
+	frame := vm.frames[len(vm.frames) - 1]
+	return frame.closure.function.chunk.Token(frame.ip - 1)
+}
+
+/** MODULES */
+
+// Pushes the module at the given path, relative to the importing file. The
+// first import of a file runs its top-level code as a call, which ends by
+// pushing the module for the importer.
+func (vm *VM) importModule(pathToken token.Token, path string) error {
+	importer := vm.frames[len(vm.frames) - 1].closure.function.path
+	if !filepath.IsAbs(path) && importer != "" {
+		path = filepath.Join(filepath.Dir(importer), path)
+	}
+
+	canonical, err := interpreter.CanonicalPath(path)
+	if err != nil {
+		return lox_error.NewRuntimeError(pathToken, "Can't find module '"+pathToken.Literal.(string)+"'.")
+	}
+
+	if module, ok := vm.modules[canonical]; ok {
+		vm.push(module)
+		return nil
+	}
+
+	// Any file still running its top-level code is a cycle
+	for i, loading := range vm.loading {
+		if loading.path == canonical {
+			cycle := []string{}
+			for _, l := range vm.loading[i:] {
+				cycle = append(cycle, interpreter.DisplayPath(vm.loading[0].path, l.path))
+			}
+			cycle = append(cycle, interpreter.DisplayPath(vm.loading[0].path, canonical))
+			return lox_error.NewRuntimeError(pathToken, "Import cycle: "+strings.Join(cycle, " -> ")+".")
+		}
+	}
+
+	data, err := os.ReadFile(canonical)
+	if err != nil {
+		return lox_error.NewRuntimeError(pathToken, "Can't read module '"+pathToken.Literal.(string)+"'.")
+	}
+
+	// Errors in the module are reported against its file
+	tokens, err := scanner.NewScanner(string(data)).ScanTokens()
+	if err != nil {
+		return lox_error.InModule(err, canonical)
+	}
+
+	statements, err := parser.NewParser(tokens).Parse()
+	if err != nil {
+		return lox_error.InModule(err, canonical)
+	}
+
+	_, err = interpreter.NewResolver(vm.host).ResolveStmts(statements)
+	if err != nil {
+		return lox_error.InModule(err, canonical)
+	}
+
+	function, err := Compile(statements, MODULE, make(map[string]any), canonical)
+	if err != nil {
+		return lox_error.InModule(err, canonical)
+	}
+
+	closure := newClosure(function)
+	vm.push(closure)
+	vm.loading = append(vm.loading, loadingModule{path: canonical, frame: len(vm.frames)})
+	return vm.call(closure, 0)
+}
+
+// Wraps a module's globals in the value its importer receives. The module
+// shares them with its functions, so it sees later assignments.
+func (vm *VM) finishModule(function *Function) *interpreter.Module {
+	globals := interpreter.NewEnvOf(function.globals)
+	name := strings.TrimSuffix(filepath.Base(function.path), filepath.Ext(function.path))
+	module := interpreter.NewModule(name, function.path, globals)
+	vm.modules[function.path] = module
+	vm.loading = vm.loading[:len(vm.loading) - 1]
+	return module
+}
+
+/** STACK AND UPVALUES */
+func (vm *VM) push(value any) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() any {
+	value := vm.stack[len(vm.stack) - 1]
+	vm.stack = vm.stack[:len(vm.stack) - 1]
+	return value
+}
+
+func (vm *VM) peek(distance int) any {
+	return vm.stack[len(vm.stack) - 1 - distance]
+}
+
+// Returns the upvalue for a stack slot, sharing it between closures that
+// capture the same variable
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i - 1].slot >= slot {
+		if vm.openUpvalues[i - 1].slot == slot {
+			return vm.openUpvalues[i - 1]
+		}
+		i--
+	}
+
+	upvalue := &Upvalue{slot: slot}
+	vm.openUpvalues = slices.Insert(vm.openUpvalues, i, upvalue)
+	return upvalue
+}
+
+// Moves the variables in slots from last upwards off the stack into the
+// upvalues capturing them
+func (vm *VM) closeUpvalues(last int) {
+	for len(vm.openUpvalues) > 0 && vm.openUpvalues[len(vm.openUpvalues) - 1].slot >= last {
+		upvalue := vm.openUpvalues[len(vm.openUpvalues) - 1]
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.isClosed = true
+		vm.openUpvalues = vm.openUpvalues[:len(vm.openUpvalues) - 1]
+	}
+}
+
+/** HELPER METHODS */
+func (vm *VM) arithmetic(op OpCode) error {
+	left, lok := vm.peek(1).(float64)
+	right, rok := vm.peek(0).(float64)
+	if !lok || !rok {
+		return lox_error.NewRuntimeError(vm.token(), "Operands must be numbers.")
+	}
+
+	var result any
+	switch op {
+	case OP_GREATER:
+		result = left > right
+	case OP_GREATER_EQUAL:
+		result = left >= right
+	case OP_LESS:
+		result = left < right
+	case OP_LESS_EQUAL:
+		result = left <= right
+	case OP_SUBTRACT:
+		result = left - right
+	case OP_MULTIPLY:
+		result = left * right
+	case OP_DIVIDE:
+		if right == 0 {
+			return lox_error.NewRuntimeError(vm.token(), "Invalid divison by zero.")
+		}
+		result = left / right
+	}
+
+	vm.stack = vm.stack[:len(vm.stack) - 1]
+	vm.stack[len(vm.stack) - 1] = result
+	return nil
+}